@@ -1,6 +1,7 @@
 package invoker
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gotomicro/ego/core/econf"
@@ -9,23 +10,63 @@ import (
 	sqlitestore "aichatoffice/pkg/models/sqlite"
 	"aichatoffice/pkg/models/store"
 	aisvc "aichatoffice/pkg/services/ai"
+	auditsvc "aichatoffice/pkg/services/audit"
+	blobsvc "aichatoffice/pkg/services/blob"
+	chartsvc "aichatoffice/pkg/services/chart"
 	chatsvc "aichatoffice/pkg/services/chat"
+	docsvc "aichatoffice/pkg/services/doc"
 	filesvc "aichatoffice/pkg/services/file"
+	importsvc "aichatoffice/pkg/services/import"
+	jobsvc "aichatoffice/pkg/services/job"
+	limitsvc "aichatoffice/pkg/services/limit"
 	officesvc "aichatoffice/pkg/services/office"
+	quotasvc "aichatoffice/pkg/services/quota"
+	templatesvc "aichatoffice/pkg/services/template"
+	translatesvc "aichatoffice/pkg/services/translate"
+	trashsvc "aichatoffice/pkg/services/trash"
+	uploadsvc "aichatoffice/pkg/services/upload"
+	usagesvc "aichatoffice/pkg/services/usage"
+	usersvc "aichatoffice/pkg/services/user"
 	"aichatoffice/ui"
 )
 
 var (
-	Gin         *egin.Component
-	FileService *filesvc.FileService
-	ChatService *chatsvc.ChatSvc
-	OfficeSvc   officesvc.OfficeSvc
-	AiConfigSvc *aisvc.AiConfigSvc
+	Gin          *egin.Component
+	FileService  *filesvc.FileService
+	ChatService  *chatsvc.ChatSvc
+	OfficeSvc    officesvc.OfficeSvc
+	AiConfigSvc  *aisvc.AiConfigSvc
+	UserService  *usersvc.UserSvc
+	AuditSvc     *auditsvc.AuditSvc
+	QuotaSvc     *quotasvc.QuotaSvc
+	UsageSvc     *usagesvc.UsageSvc
+	LimitSvc     *limitsvc.LimitSvc
+	DocSvc       *docsvc.DocSvc
+	ChartSvc     *chartsvc.ChartSvc
+	TemplateSvc  *templatesvc.TemplateSvc
+	TranslateSvc *translatesvc.TranslateSvc
+	JobSvc       *jobsvc.JobSvc
+	UploadSvc    *uploadsvc.UploadSvc
+	TrashSvc     *trashsvc.TrashSvc
+	ImportSvc    *importsvc.ImportSvc
 
 	// store
-	FileStore     store.FileStore
-	ChatStore     store.ChatStore
-	AiConfigStore store.AiConfigStore
+	FileStore        store.FileStore
+	FileVersionStore store.FileVersionStore
+	StorageStore     store.StorageStore
+	ContentStore     store.ContentStore
+	FolderStore      store.FolderStore
+	TagStore         store.TagStore
+	ChatStore        store.ChatStore
+	AiConfigStore    store.AiConfigStore
+	UserStore        store.UserStore
+	AuditStore       store.AuditStore
+	QuotaStore       store.QuotaStore
+	UsageStore       store.UsageStore
+	TemplateStore    store.TemplateStore
+	UploadStore      store.UploadStore
+	JobStore         store.JobStore
+	BlobStore        blobsvc.BlobStore
 )
 
 func Init() (err error) {
@@ -35,11 +76,27 @@ func Init() (err error) {
 		return fmt.Errorf("service init store failed: %w", err)
 	}
 
-	FileService = filesvc.NewFileService(FileStore)
+	BlobStore, err = blobsvc.NewBlobStoreFromConfig()
+	if err != nil {
+		return fmt.Errorf("service init blob store failed: %w", err)
+	}
+	FileService = filesvc.NewFileService(FileStore, FileVersionStore, StorageStore, ContentStore, FolderStore, TagStore, BlobStore)
 	FileService.InitCaseFile()
+	UploadSvc = uploadsvc.NewUploadSvc(UploadStore, FileService)
+	UploadSvc.Start(context.Background())
+	TrashSvc = trashsvc.NewTrashSvc(FileService, ChatStore)
+	TrashSvc.Start(context.Background())
+	ImportSvc = importsvc.NewImportSvc(FileService)
 
 	AiConfigSvc = aisvc.NewAiConfigSvc(AiConfigStore)
 
+	UserService = usersvc.NewUserSvc(UserStore)
+	err = UserService.InitAdmin(context.Background(), econf.GetString("auth.adminToken"))
+	if err != nil {
+		return fmt.Errorf("service init admin failed: %w", err)
+	}
+	AuditSvc = auditsvc.NewAuditSvc(AuditStore)
+
 	// todo 支持多种 ai 协议，可根据配置切换, 目前只取了第一个 配置
 	aiSvc, err := aisvc.NewOpenAI(AiConfigSvc)
 	if err != nil {
@@ -48,7 +105,21 @@ func Init() (err error) {
 	OfficeSvc = officesvc.NewOfficeSDK(officesvc.OfficeSDKConfig{
 		BaseURL: "http://localhost:9101", //todo 放到哪个配置里
 	})
-	ChatService = chatsvc.NewChatSvc(ChatStore, aiSvc, OfficeSvc)
+	QuotaSvc = quotasvc.NewQuotaSvc(QuotaStore)
+	UsageSvc = usagesvc.NewUsageSvc(UsageStore)
+	LimitSvc = limitsvc.NewLimitSvcFromConfig()
+	DocSvc = docsvc.NewDocSvc(FileService, OfficeSvc)
+	ChartSvc = chartsvc.NewChartSvc(FileService)
+	ChatService = chatsvc.NewChatSvc(ChatStore, aiSvc, OfficeSvc, QuotaSvc, UsageSvc, DocSvc, ChartSvc)
+	TemplateSvc = templatesvc.NewTemplateSvc(TemplateStore, FileService)
+	JobSvc = jobsvc.NewJobSvc(JobStore)
+	JobSvc.SetDiscard(FileService.DeleteFile)
+	TranslateSvc = translatesvc.NewTranslateSvc(FileService, DocSvc, ChatService, JobSvc)
+	// 各类任务的处理函数注册完成后再启动 worker
+	err = JobSvc.Start(context.Background())
+	if err != nil {
+		return fmt.Errorf("service start jobs failed: %w", err)
+	}
 
 	return nil
 }
@@ -61,8 +132,20 @@ func initStore() (err error) {
 			return fmt.Errorf("service init sqlite failed: %w", err)
 		}
 		FileStore = sqlite
+		FileVersionStore = sqlite
+		StorageStore = sqlite
+		ContentStore = sqlite
+		FolderStore = sqlite
+		TagStore = sqlite
 		ChatStore = sqlite
 		AiConfigStore = sqlite
+		UserStore = sqlite
+		AuditStore = sqlite
+		QuotaStore = sqlite
+		UsageStore = sqlite
+		TemplateStore = sqlite
+		UploadStore = sqlite
+		JobStore = sqlite
 	default:
 		panic(fmt.Sprintf("store type %s not supported", econf.GetString("store.type")))
 	}
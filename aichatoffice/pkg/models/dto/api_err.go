@@ -48,4 +48,21 @@ var (
 	ErrPackageTypeUnsupported         = &ApiError{Code: 10013, Message: "package type unsupported"}
 	ErrUserSeatPptPermissionDenied    = &ApiError{Code: 10014, Message: "user seat ppt permission denied"}
 	ErrUserSeatNewDocPermissionDenied = &ApiError{Code: 10015, Message: "user seat new doc permission denied"}
+	ErrQuotaExhausted                 = &ApiError{Code: 10016, Message: "free quota exhausted, please configure an ai model"}
+	ErrAiNotConfigured                = &ApiError{Code: 10017, Message: "ai model not configured"}
+	ErrBudgetExceeded                 = &ApiError{Code: 10018, Message: "monthly budget exceeded"}
+	ErrAiAuth                         = &ApiError{Code: 10019, Message: "ai provider rejected the api key, please check the ai config"}
+	ErrAiRateLimit                    = &ApiError{Code: 10020, Message: "ai provider is rate limiting requests, please retry later"}
+	ErrAiContentFilter                = &ApiError{Code: 10021, Message: "content was blocked by the ai provider's content filter"}
+	ErrAiNetwork                      = &ApiError{Code: 10022, Message: "cannot reach the ai provider, please check the network or proxy"}
+	ErrAiServer                       = &ApiError{Code: 10023, Message: "ai provider is temporarily unavailable, please retry later"}
+	ErrVersionNotFound                = &ApiError{Code: 10024, Message: "file version not found"}
+	ErrTemplateNotFound               = &ApiError{Code: 10025, Message: "template not found"}
+	ErrFileTooLarge                   = &ApiError{Code: 10026, Message: "file too large"}
+	ErrFolderNotEmpty                 = &ApiError{Code: 10027, Message: "folder is not empty"}
+	ErrFileInTrash                    = &ApiError{Code: 10028, Message: "file is in trash"}
+	ErrFileNotInTrash                 = &ApiError{Code: 10029, Message: "file not found in trash"}
+	ErrInvalidSignature               = &ApiError{Code: 10030, Message: "invalid or expired signature"}
+	ErrNoPreviousVersion              = &ApiError{Code: 10031, Message: "no previous version to compare with"}
+	ErrFilePermissionDenied           = &ApiError{Code: 10032, Message: "only the creator or an admin can modify the file"}
 )
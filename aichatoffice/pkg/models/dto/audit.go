@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	AuditActionAiConfigUpdate = "ai_config.update"
+	AuditActionUserCreate     = "user.create"
+	AuditActionUserUpdate     = "user.update"
+	AuditActionUserDelete     = "user.delete"
+	AuditActionUserResetToken = "user.reset_token"
+	AuditActionQuotaUpdate    = "quota.update"
+	AuditActionBudgetUpdate   = "budget.update"
+	AuditActionStorageUpdate  = "storage.update"
+)
+
+// AuditLog 记录谁在什么时候改了什么
+type AuditLog struct {
+	ID         int64        `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId     string       `json:"user_id" gorm:"index"`
+	UserName   string       `json:"user_name"`
+	Action     string       `json:"action" gorm:"index"`
+	Target     string       `json:"target"`
+	Changes    FieldChanges `json:"changes" gorm:"type:text"` // JSON 存储，不包含密钥类字段的值
+	CreateTime int64        `json:"create_time" gorm:"index"`
+}
+
+func (a *AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// FieldChange 单个字段的变更，Secret 字段只标记是否变化，不记录值
+type FieldChange struct {
+	Item   string `json:"item"`
+	Field  string `json:"field"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// FieldChanges 是 FieldChange 切片，实现 GORM JSON 存储
+type FieldChanges []FieldChange
+
+func (fc FieldChanges) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(fc)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (fc *FieldChanges) Scan(value interface{}) error {
+	if value == nil {
+		*fc = FieldChanges{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported scan type for FieldChanges: %T", value)
+	}
+
+	return json.Unmarshal(bytes, fc)
+}
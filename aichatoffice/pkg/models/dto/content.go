@@ -0,0 +1,14 @@
+package dto
+
+// Content 按 SHA-256 保存的文件内容，内容相同的版本共用一份，RefCount 为引用它的版本数
+type Content struct {
+	Hash       string `json:"hash" gorm:"primaryKey"`
+	Size       int64  `json:"size"`
+	RefCount   int64  `json:"ref_count"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+func (c *Content) TableName() string {
+	return "contents"
+}
@@ -1,19 +1,65 @@
 package dto
 
 type FileMeta struct {
-	ID         string `json:"-" gorm:"primaryKey;autoIncrement"`
-	FileID     string `json:"id" gorm:"uniqueIndex"` // 唯一索引
-	Name       string `json:"name"`
-	Version    int64  `json:"version"`
-	Type       string `json:"type"`
-	Size       int64  `json:"size"`
-	Ext        string `json:"ext"`
-	CreateTime int64  `json:"create_time"`
-	ModifyTime int64  `json:"modify_time"`
-	CreatorId  string `json:"creator_id"`
-	ModifierId string `json:"modifier_id"`
+	ID         string   `json:"-" gorm:"primaryKey;autoIncrement"`
+	FileID     string   `json:"id" gorm:"uniqueIndex"` // 唯一索引
+	Name       string   `json:"name"`
+	Version    int64    `json:"version"`
+	Type       string   `json:"type"`
+	Size       int64    `json:"size"`
+	Ext        string   `json:"ext"`
+	CreateTime int64    `json:"create_time"`
+	ModifyTime int64    `json:"modify_time"`
+	CreatorId  string   `json:"creator_id"`
+	ModifierId string   `json:"modifier_id"`
+	Hash       string   `json:"hash" gorm:"index"` // 当前版本内容的 SHA-256，十六进制
+	Kind       string   `json:"kind" gorm:"index"`
+	FolderId   string   `json:"folder_id" gorm:"index"` // 所在文件夹，空为根目录
+	Tags       []string `json:"tags" gorm:"-"`
+	DeleteTime int64    `json:"delete_time,omitempty" gorm:"index"` // 移入回收站的时间，0 为未删除
+	DeleterId  string   `json:"deleter_id,omitempty" gorm:"index"`
+	// DownloadUrl 当前版本的签名下载地址，只在接口返回时填充
+	DownloadUrl string `json:"download_url,omitempty" gorm:"-"`
 }
 
 func (f *FileMeta) TableName() string {
 	return "files"
 }
+
+// 文件类别
+const (
+	FileKindUser   = "user"   // 用户上传或生成的文件
+	FileKindCase   = "case"   // 资源目录中的示例文件
+	FileKindSystem = "system" // 服务内部使用的文件，默认不在列表中展示
+)
+
+// 版本来源
+const (
+	VersionSourceUpload  = "upload"
+	VersionSourceSdk     = "sdk"
+	VersionSourceAi      = "ai"
+	VersionSourceRestore = "restore"
+	VersionSourceCase    = "case" // 示例文件的初始版本，即资源目录中的文件
+)
+
+// FileVersion 文件的一个不可变版本，内容按 SHA-256 去重保存，相同内容的版本共用一份
+type FileVersion struct {
+	ID          int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	FileId      string `json:"fileId" gorm:"uniqueIndex:idx_file_version"`
+	Version     int64  `json:"version" gorm:"uniqueIndex:idx_file_version"`
+	Size        int64  `json:"size"`
+	Type        string `json:"type"`
+	Ext         string `json:"ext"`
+	Source      string `json:"source"`
+	ObjectName  string `json:"objectName,omitempty"` // sdk 保存时上传的对象名
+	RestoreFrom int64  `json:"restoreFrom,omitempty"`
+	Hash        string `json:"hash,omitempty"` // 内容的 SHA-256，十六进制
+	ContentKey  string `json:"-"`              // 去重保存的内容对象，为空时内容在版本目录中
+	CreatorId   string `json:"creatorId"`
+	CreateTime  int64  `json:"createTime"`
+	DownloadUrl string `json:"downloadUrl,omitempty" gorm:"-"` // 该版本的签名下载地址，只在接口返回时填充
+}
+
+func (v *FileVersion) TableName() string {
+	return "file_versions"
+}
@@ -0,0 +1,74 @@
+package dto
+
+// Folder 文件夹，ParentId 为空时在根目录
+type Folder struct {
+	ID         int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	FolderId   string `json:"id" gorm:"uniqueIndex"`
+	Name       string `json:"name"`
+	ParentId   string `json:"parent_id" gorm:"index"`
+	CreatorId  string `json:"creator_id"`
+	CreateTime int64  `json:"create_time"`
+	ModifyTime int64  `json:"modify_time"`
+}
+
+func (f *Folder) TableName() string {
+	return "folders"
+}
+
+// FileTag 用户给文件添加的标签
+type FileTag struct {
+	ID         int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	FileId     string `json:"file_id" gorm:"uniqueIndex:idx_file_tag"`
+	Tag        string `json:"tag" gorm:"uniqueIndex:idx_file_tag;index"`
+	CreateTime int64  `json:"create_time"`
+}
+
+func (t *FileTag) TableName() string {
+	return "file_tags"
+}
+
+// TagCount 标签及使用它的文件数
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// 文件列表的排序字段
+const (
+	FileSortName       = "name"
+	FileSortSize       = "size"
+	FileSortCreateTime = "create_time"
+	FileSortModifyTime = "modify_time"
+	FileSortDeleteTime = "delete_time"
+)
+
+// FileQuery 文件列表的查询条件，为空的条件不过滤；时间为 unix 秒，包含首尾
+type FileQuery struct {
+	Kind      string
+	Trashed   bool    // 只查回收站中的文件，否则只查未删除的文件
+	DeleterId string  // 回收站中由该用户删除的文件
+	FolderId  *string // nil 不限文件夹，空串为根目录
+	Type      string  // 扩展名（如 docx）或 MIME 类型前缀（如 image/）
+	Tag       string
+	CreatorId string
+	TimeField string // create_time 或 modify_time
+	FromTime  int64
+	ToTime    int64
+	Sort      string
+	Desc      bool
+	After     *FileCursor // 上一页最后一个文件
+	Limit     int
+}
+
+// FileCursor 分页位置：排序字段的值及文件 id
+type FileCursor struct {
+	Value  string `json:"v"`
+	FileId string `json:"id"`
+}
+
+// FileList 一页文件，NextCursor 为空表示没有下一页；Total 为满足条件的文件总数
+type FileList struct {
+	Files      []FileMeta `json:"files"`
+	Total      int64      `json:"total"`
+	NextCursor string     `json:"next_cursor"`
+}
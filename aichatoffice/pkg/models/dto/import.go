@@ -0,0 +1,17 @@
+package dto
+
+// ImportEntry 压缩包中一个文件的导入结果，Error 为空表示成功
+type ImportEntry struct {
+	Path   string `json:"path"`
+	FileId string `json:"file_id,omitempty"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportResult 导入压缩包的结果，压缩包的目录结构在 Folder 下重建
+type ImportResult struct {
+	Folder    Folder        `json:"folder"`
+	Entries   []ImportEntry `json:"entries"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// 后台任务状态
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// Job 后台任务，Payload 为任务参数的 JSON；失败后按 MaxAttempts 重试，RunAt 为下次可以执行的时间
+type Job struct {
+	ID              int64      `json:"-" gorm:"primaryKey;autoIncrement"`
+	JobId           string     `json:"id" gorm:"uniqueIndex"`
+	Type            string     `json:"type" gorm:"index"`
+	Status          string     `json:"status" gorm:"index"`
+	Payload         string     `json:"payload" gorm:"type:text"`
+	Progress        int        `json:"progress"` // 0-100
+	Message         string     `json:"message,omitempty"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	Error           string     `json:"error,omitempty"`
+	ResultFileIds   StringList `json:"result_file_ids" gorm:"type:text"` // JSON 存储
+	CancelRequested bool       `json:"cancel_requested"`
+	CreatorId       string     `json:"creator_id" gorm:"index"`
+	RunAt           int64      `json:"run_at" gorm:"index"`
+	CreateTime      int64      `json:"create_time"`
+	UpdateTime      int64      `json:"update_time"`
+	StartTime       int64      `json:"start_time,omitempty"`
+	FinishTime      int64      `json:"finish_time,omitempty"`
+}
+
+func (j *Job) TableName() string {
+	return "jobs"
+}
+
+// Finished 任务已结束，不会再变化
+func (j *Job) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCanceled
+}
+
+// StringList 是字符串切片，实现 GORM JSON 存储
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*l = StringList{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported scan type for StringList: %T", value)
+	}
+
+	return json.Unmarshal(bytes, l)
+}
@@ -0,0 +1,37 @@
+package dto
+
+// UserQuota 用户在未配置 AI 模型时可使用的试用额度
+type UserQuota struct {
+	UserId       string `json:"user_id" gorm:"primaryKey"`
+	FreeRequests int64  `json:"free_requests"`
+	FreeTokens   int64  `json:"free_tokens"` // <= 0 表示不限制 token
+	UsedRequests int64  `json:"used_requests"`
+	UsedTokens   int64  `json:"used_tokens"`
+	UpdateTime   int64  `json:"update_time"`
+}
+
+func (q *UserQuota) TableName() string {
+	return "user_quotas"
+}
+
+func (q *UserQuota) RemainingRequests() int64 {
+	if q.UsedRequests >= q.FreeRequests {
+		return 0
+	}
+	return q.FreeRequests - q.UsedRequests
+}
+
+// RemainingTokens 不限制 token 时返回 -1
+func (q *UserQuota) RemainingTokens() int64 {
+	if q.FreeTokens <= 0 {
+		return -1
+	}
+	if q.UsedTokens >= q.FreeTokens {
+		return 0
+	}
+	return q.FreeTokens - q.UsedTokens
+}
+
+func (q *UserQuota) Exhausted() bool {
+	return q.RemainingRequests() == 0 || q.RemainingTokens() == 0
+}
@@ -0,0 +1,13 @@
+package dto
+
+// UserStorage 用户占用的存储空间，按其创建的文件各版本的大小累计
+type UserStorage struct {
+	UserId     string `json:"user_id" gorm:"primaryKey"`
+	UsedBytes  int64  `json:"used_bytes"`
+	LimitBytes int64  `json:"limit_bytes"` // 0 使用配置中的默认值，< 0 不限制
+	UpdateTime int64  `json:"update_time"`
+}
+
+func (s *UserStorage) TableName() string {
+	return "user_storages"
+}
@@ -0,0 +1,66 @@
+package dto
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// 模板字段类型
+const (
+	TemplateFieldText = "text" // {{name}}
+	TemplateFieldList = "list" // {{#name}}…{{/name}} 中引用了子字段，按数组逐项重复
+	TemplateFieldBool = "bool" // {{#name}}…{{/name}} 中没有引用字段，作为条件
+)
+
+// Template 用户上传的 docx 报告模板，内容保存在模板目录中
+type Template struct {
+	ID         int64          `json:"-" gorm:"primaryKey;autoIncrement"`
+	TemplateId string         `json:"id" gorm:"uniqueIndex"`
+	Name       string         `json:"name"`
+	Size       int64          `json:"size"`
+	Fields     TemplateFields `json:"fields" gorm:"type:text"` // JSON 存储
+	CreatorId  string         `json:"creator_id" gorm:"index"`
+	CreateTime int64          `json:"create_time"`
+}
+
+func (t *Template) TableName() string {
+	return "templates"
+}
+
+// TemplateField 模板中引用的字段，Name 可以是 a.b 形式的路径，列表的子字段相对于每一项
+type TemplateField struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Fields []TemplateField `json:"fields,omitempty"`
+}
+
+// TemplateFields 是 TemplateField 切片，实现 GORM JSON 存储
+type TemplateFields []TemplateField
+
+func (tf TemplateFields) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(tf)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (tf *TemplateFields) Scan(value interface{}) error {
+	if value == nil {
+		*tf = TemplateFields{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("unsupported scan type for TemplateFields: %T", value)
+	}
+
+	return json.Unmarshal(bytes, tf)
+}
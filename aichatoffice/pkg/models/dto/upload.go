@@ -0,0 +1,25 @@
+package dto
+
+// Upload 断点续传（tus）的上传，已接收的内容按分片保存在存储的 uploads/<id>/ 下，全部接收后登记为文件
+type Upload struct {
+	ID         int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	UploadId   string `json:"id" gorm:"uniqueIndex"`
+	Name       string `json:"name"`
+	Length     int64  `json:"length"`
+	Offset     int64  `json:"offset"`
+	Metadata   string `json:"metadata"`          // Upload-Metadata 原文，HEAD 时原样返回
+	FileId     string `json:"file_id,omitempty"` // 完成后生成的文件
+	CreatorId  string `json:"creator_id" gorm:"index"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+	ExpireTime int64  `json:"expire_time" gorm:"index"` // 超过该时间未完成的上传被清理
+}
+
+func (u *Upload) TableName() string {
+	return "uploads"
+}
+
+// Completed 内容已全部接收并登记为文件
+func (u *Upload) Completed() bool {
+	return u.FileId != ""
+}
@@ -0,0 +1,55 @@
+package dto
+
+// UsageRecord 每次模型调用的用量及费用
+type UsageRecord struct {
+	ID               int64   `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId           string  `json:"user_id" gorm:"index"`
+	ConversationId   string  `json:"conversation_id" gorm:"index"`
+	Model            string  `json:"model" gorm:"index"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	LatencyMs        int64   `json:"latency_ms"`
+	FinishReason     string  `json:"finish_reason"`
+	Cost             float64 `json:"cost"`
+	Trial            bool    `json:"trial"`
+	Day              string  `json:"day" gorm:"index"` // 2006-01-02，方便按天汇总
+	CreateTime       int64   `json:"create_time"`
+}
+
+func (u *UsageRecord) TableName() string {
+	return "usage_records"
+}
+
+// UsageAggregate 按用户/天/模型汇总的用量，不落表
+type UsageAggregate struct {
+	Key              string  `json:"key"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// UsageQuery 汇总查询条件，Day 格式为 2006-01-02，包含首尾
+type UsageQuery struct {
+	GroupBy string
+	UserId  string
+	Model   string
+	FromDay string
+	ToDay   string
+}
+
+// UserBudget 用户月度预算，未设置时使用配置中的默认值
+type UserBudget struct {
+	UserId      string  `json:"user_id" gorm:"primaryKey"`
+	MonthlySoft float64 `json:"monthly_soft"` // 超出后降级模型，<= 0 不限制
+	MonthlyHard float64 `json:"monthly_hard"` // 超出后拒绝请求，<= 0 不限制
+	UpdateTime  int64   `json:"update_time"`
+}
+
+func (b *UserBudget) TableName() string {
+	return "user_budgets"
+}
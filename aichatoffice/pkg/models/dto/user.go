@@ -0,0 +1,33 @@
+package dto
+
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// AnonymousUserId 未携带 token 的请求共用的身份，试用额度、预算、存储空间及限流按此身份单独限制，
+// 所有匿名请求共享这些限制
+const AnonymousUserId = "anonymous"
+
+// User 代表一个可访问服务的用户
+type User struct {
+	ID         int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	UserId     string `json:"id" gorm:"uniqueIndex"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	TokenHash  string `json:"-" gorm:"uniqueIndex"` // 只存 token 的 sha256，明文只在创建/重置时返回一次
+	CreateTime int64  `json:"create_time"`
+	ModifyTime int64  `json:"modify_time"`
+}
+
+func (u *User) TableName() string {
+	return "users"
+}
+
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember
+}
@@ -0,0 +1,23 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddAuditLog(ctx context.Context, log dto.AuditLog) error {
+	return s.DB.Create(&log).Error
+}
+
+func (s *SqliteStore) ListAuditLogs(ctx context.Context, action string, limit int, offset int) (logs []dto.AuditLog, err error) {
+	db := s.DB.Order("id DESC")
+	if action != "" {
+		db = db.Where("action = ?", action)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err = db.Offset(offset).Find(&logs).Error
+	return
+}
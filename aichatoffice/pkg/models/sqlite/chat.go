@@ -149,6 +149,16 @@ func (s *SqliteStore) DeleteConversation(ctx context.Context, userId string, con
 	return nil
 }
 
+func (s *SqliteStore) DeleteFileConversations(ctx context.Context, fileGuid string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		conversations := tx.Model(&dto.ChatConversation{}).Select("conversation_id").Where("file_guid = ?", fileGuid)
+		if err := tx.Where("conversation_id IN (?)", conversations).Delete(&dto.ChatMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("file_guid = ?", fileGuid).Delete(&dto.ChatConversation{}).Error
+	})
+}
+
 func (s *SqliteStore) conversationKey(userId string, conversationId string) string {
 	return fmt.Sprintf("ai:conversation:%s:%s", userId, conversationId)
 }
@@ -0,0 +1,55 @@
+package sqlitestore
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AcquireContent(ctx context.Context, hash string, size int64) (bool, error) {
+	var created bool
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dto.Content{Hash: hash, Size: size, RefCount: 1, CreateTime: now, UpdateTime: now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			created = true
+			return nil
+		}
+		return tx.Model(&dto.Content{}).Where("hash = ?", hash).Updates(map[string]interface{}{
+			"ref_count":   gorm.Expr("ref_count + 1"),
+			"update_time": now,
+		}).Error
+	})
+	return created, err
+}
+
+func (s *SqliteStore) ReleaseContent(ctx context.Context, hash string) (int64, error) {
+	var remaining int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&dto.Content{}).Where("hash = ? AND ref_count > 0", hash).Updates(map[string]interface{}{
+			"ref_count":   gorm.Expr("ref_count - 1"),
+			"update_time": time.Now().Unix(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		var content dto.Content
+		res := tx.Where("hash = ?", hash).Limit(1).Find(&content)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		remaining = content.RefCount
+		if remaining > 0 {
+			return nil
+		}
+		return tx.Where("hash = ? AND ref_count <= 0", hash).Delete(&dto.Content{}).Error
+	})
+	return remaining, err
+}
@@ -29,8 +29,22 @@ func NewSqliteStore() (*SqliteStore, error) {
 }
 
 func (s *SqliteStore) AutoMigrate() error {
-	// 文件存储
-	err := s.DB.AutoMigrate(&dto.FileMeta{})
+	// 文件存储、按内容去重的引用计数及用户占用空间
+	err := s.DB.AutoMigrate(&dto.FileMeta{}, &dto.FileVersion{}, &dto.Content{}, &dto.UserStorage{})
+	if err != nil {
+		return err
+	}
+	// 文件夹及标签
+	err = s.DB.AutoMigrate(&dto.Folder{}, &dto.FileTag{})
+	if err != nil {
+		return err
+	}
+	// 增加类别之前的文件，按 id 前缀补上
+	err = s.DB.Model(&dto.FileMeta{}).Where("kind = '' OR kind IS NULL").
+		Update("kind", gorm.Expr(`CASE
+			WHEN file_id LIKE 'case\_%' ESCAPE '\' THEN ?
+			WHEN file_id LIKE 'convert\_%' ESCAPE '\' OR file_id LIKE 'custom_tool%' THEN ?
+			ELSE ? END`, dto.FileKindCase, dto.FileKindSystem, dto.FileKindUser)).Error
 	if err != nil {
 		return err
 	}
@@ -48,5 +62,35 @@ func (s *SqliteStore) AutoMigrate() error {
 	if err != nil {
 		return err
 	}
+	// 用户及审计日志
+	err = s.DB.AutoMigrate(&dto.User{}, &dto.AuditLog{})
+	if err != nil {
+		return err
+	}
+	// 试用额度
+	err = s.DB.AutoMigrate(&dto.UserQuota{})
+	if err != nil {
+		return err
+	}
+	// 用量及预算
+	err = s.DB.AutoMigrate(&dto.UsageRecord{}, &dto.UserBudget{})
+	if err != nil {
+		return err
+	}
+	// 报告模板
+	err = s.DB.AutoMigrate(&dto.Template{})
+	if err != nil {
+		return err
+	}
+	// 后台任务
+	err = s.DB.AutoMigrate(&dto.Job{})
+	if err != nil {
+		return err
+	}
+	// 断点续传
+	err = s.DB.AutoMigrate(&dto.Upload{})
+	if err != nil {
+		return err
+	}
 	return nil
 }
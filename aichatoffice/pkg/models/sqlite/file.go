@@ -3,6 +3,9 @@ package sqlitestore
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -34,16 +37,118 @@ func (s *SqliteStore) DeleteFileMeta(ctx context.Context, fileID string) error {
 	return s.DB.Delete(&dto.FileMeta{}, "file_id = ?", fileID).Error
 }
 
-func (s *SqliteStore) GetFilesList(ctx context.Context) (files []dto.FileMeta, err error) {
-	query := `
-		file_id NOT LIKE ? AND
-		file_id NOT LIKE ? AND
-		file_id NOT LIKE ? AND
-		file_id NOT LIKE ?
-	`
-	err = s.DB.
-		Where(query, "%custom_tool%", "%ai%", "%convert_%", "%case_%").
-		Find(&files).Error
+// fileSortColumns 文件列表可排序的字段
+var fileSortColumns = map[string]string{
+	dto.FileSortName:       "name",
+	dto.FileSortSize:       "size",
+	dto.FileSortCreateTime: "create_time",
+	dto.FileSortModifyTime: "modify_time",
+	dto.FileSortDeleteTime: "delete_time",
+}
+
+func (s *SqliteStore) QueryFiles(ctx context.Context, query dto.FileQuery) (files []dto.FileMeta, total int64, err error) {
+	column, ok := fileSortColumns[query.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported sort: %s", query.Sort)
+	}
+	db := s.DB.Model(&dto.FileMeta{})
+	if query.Trashed {
+		db = db.Where("delete_time > 0")
+		if query.DeleterId != "" {
+			db = db.Where("deleter_id = ?", query.DeleterId)
+		}
+	} else {
+		db = db.Where("delete_time = 0 OR delete_time IS NULL")
+	}
+	if query.Kind != "" {
+		db = db.Where("kind = ?", query.Kind)
+	}
+	if query.FolderId != nil {
+		db = db.Where("folder_id = ?", *query.FolderId)
+	}
+	if query.Type != "" {
+		if strings.Contains(query.Type, "/") {
+			db = db.Where("type LIKE ? ESCAPE '\\'", escapeLike(query.Type)+"%")
+		} else {
+			db = db.Where("LOWER(ext) = ?", "."+strings.ToLower(strings.TrimPrefix(query.Type, ".")))
+		}
+	}
+	if query.Tag != "" {
+		db = db.Where("file_id IN (?)", s.DB.Model(&dto.FileTag{}).Select("file_id").Where("tag = ?", query.Tag))
+	}
+	if query.CreatorId != "" {
+		db = db.Where("creator_id = ?", query.CreatorId)
+	}
+	if query.FromTime > 0 || query.ToTime > 0 {
+		timeColumn, ok := fileSortColumns[query.TimeField]
+		if !ok || timeColumn == "name" || timeColumn == "size" || timeColumn == "delete_time" {
+			return nil, 0, fmt.Errorf("unsupported time field: %s", query.TimeField)
+		}
+		if query.FromTime > 0 {
+			db = db.Where(timeColumn+" >= ?", query.FromTime)
+		}
+		if query.ToTime > 0 {
+			db = db.Where(timeColumn+" <= ?", query.ToTime)
+		}
+	}
+	// 之后的统计与分页各自在副本上追加条件
+	db = db.Session(&gorm.Session{})
+	if err = db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 
+	direction, op := "ASC", ">"
+	if query.Desc {
+		direction, op = "DESC", "<"
+	}
+	page := db
+	if query.After != nil {
+		var value interface{} = query.After.Value
+		if column != "name" {
+			if value, err = strconv.ParseInt(query.After.Value, 10, 64); err != nil {
+				return nil, 0, fmt.Errorf("invalid cursor value: %w", err)
+			}
+		}
+		page = page.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND file_id %[2]s ?))", column, op), value, value, query.After.FileId)
+	}
+	if query.Limit > 0 {
+		page = page.Limit(query.Limit)
+	}
+	err = page.Order(column + " " + direction + ", file_id " + direction).Find(&files).Error
+	return files, total, err
+}
+
+func (s *SqliteStore) MoveFile(ctx context.Context, fileID string, folderId string) error {
+	return s.DB.Model(&dto.FileMeta{}).Where("file_id = ?", fileID).Update("folder_id", folderId).Error
+}
+
+func (s *SqliteStore) RenameFile(ctx context.Context, fileID string, name string) error {
+	return s.DB.Model(&dto.FileMeta{}).Where("file_id = ?", fileID).Update("name", name).Error
+}
+
+func (s *SqliteStore) TrashFile(ctx context.Context, fileID string, deleterId string, deleteTime int64) (bool, error) {
+	res := s.DB.Model(&dto.FileMeta{}).Where("file_id = ? AND (delete_time = 0 OR delete_time IS NULL)", fileID).Updates(map[string]interface{}{
+		"delete_time": deleteTime,
+		"deleter_id":  deleterId,
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *SqliteStore) RestoreFile(ctx context.Context, fileID string, folderId string) (bool, error) {
+	res := s.DB.Model(&dto.FileMeta{}).Where("file_id = ? AND delete_time > 0", fileID).Updates(map[string]interface{}{
+		"delete_time": 0,
+		"deleter_id":  "",
+		"folder_id":   folderId,
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *SqliteStore) ListTrashedFiles(ctx context.Context, before int64, limit int) (files []dto.FileMeta, err error) {
+	err = s.DB.Where("delete_time > 0 AND delete_time <= ?", before).Order("delete_time, file_id").Limit(limit).Find(&files).Error
 	return files, err
 }
+
+// escapeLike 转义 LIKE 中的通配符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
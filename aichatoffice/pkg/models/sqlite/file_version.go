@@ -0,0 +1,39 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddFileVersion(ctx context.Context, v dto.FileVersion) error {
+	return s.DB.Create(&v).Error
+}
+
+func (s *SqliteStore) GetFileVersion(ctx context.Context, fileId string, version int64) (*dto.FileVersion, error) {
+	var v dto.FileVersion
+	err := s.DB.Where("file_id = ? AND version = ?", fileId, version).First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *SqliteStore) ListFileVersions(ctx context.Context, fileId string) (versions []dto.FileVersion, err error) {
+	err = s.DB.Where("file_id = ?", fileId).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+func (s *SqliteStore) DeleteFileVersion(ctx context.Context, fileId string, version int64) error {
+	return s.DB.Delete(&dto.FileVersion{}, "file_id = ? AND version = ?", fileId, version).Error
+}
+
+func (s *SqliteStore) DeleteFileVersions(ctx context.Context, fileId string) error {
+	return s.DB.Delete(&dto.FileVersion{}, "file_id = ?", fileId).Error
+}
@@ -0,0 +1,97 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddFolder(ctx context.Context, folder dto.Folder) error {
+	return s.DB.Create(&folder).Error
+}
+
+func (s *SqliteStore) GetFolder(ctx context.Context, folderId string) (*dto.Folder, error) {
+	var folder dto.Folder
+	err := s.DB.Where("folder_id = ?", folderId).First(&folder).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func (s *SqliteStore) ListFolders(ctx context.Context, parentId string) (folders []dto.Folder, err error) {
+	err = s.DB.Where("parent_id = ?", parentId).Order("name, folder_id").Find(&folders).Error
+	return folders, err
+}
+
+func (s *SqliteStore) UpdateFolder(ctx context.Context, folder dto.Folder) error {
+	return s.DB.Model(&dto.Folder{}).Where("folder_id = ?", folder.FolderId).Updates(map[string]interface{}{
+		"name":        folder.Name,
+		"parent_id":   folder.ParentId,
+		"modify_time": folder.ModifyTime,
+	}).Error
+}
+
+func (s *SqliteStore) DeleteFolder(ctx context.Context, folderId string) error {
+	return s.DB.Delete(&dto.Folder{}, "folder_id = ?", folderId).Error
+}
+
+func (s *SqliteStore) CountFolderChildren(ctx context.Context, folderId string) (int64, error) {
+	var files, folders int64
+	if err := s.DB.Model(&dto.FileMeta{}).Where("folder_id = ? AND (delete_time = 0 OR delete_time IS NULL)", folderId).Count(&files).Error; err != nil {
+		return 0, err
+	}
+	if err := s.DB.Model(&dto.Folder{}).Where("parent_id = ?", folderId).Count(&folders).Error; err != nil {
+		return 0, err
+	}
+	return files + folders, nil
+}
+
+func (s *SqliteStore) SetFileTags(ctx context.Context, fileId string, tags []string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&dto.FileTag{}, "file_id = ?", fileId).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		now := time.Now().Unix()
+		rows := make([]dto.FileTag, 0, len(tags))
+		for _, tag := range tags {
+			rows = append(rows, dto.FileTag{FileId: fileId, Tag: tag, CreateTime: now})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (s *SqliteStore) ListFileTags(ctx context.Context, fileIds []string) (map[string][]string, error) {
+	res := make(map[string][]string, len(fileIds))
+	if len(fileIds) == 0 {
+		return res, nil
+	}
+	var tags []dto.FileTag
+	err := s.DB.Where("file_id IN ?", fileIds).Order("tag").Find(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		res[t.FileId] = append(res[t.FileId], t.Tag)
+	}
+	return res, nil
+}
+
+func (s *SqliteStore) ListTags(ctx context.Context) (tags []dto.TagCount, err error) {
+	err = s.DB.Model(&dto.FileTag{}).Select("tag, COUNT(*) AS count").Group("tag").Order("tag").Scan(&tags).Error
+	return tags, err
+}
+
+func (s *SqliteStore) DeleteFileTags(ctx context.Context, fileId string) error {
+	return s.DB.Delete(&dto.FileTag{}, "file_id = ?", fileId).Error
+}
@@ -0,0 +1,120 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddJob(ctx context.Context, job dto.Job) error {
+	return s.DB.Create(&job).Error
+}
+
+func (s *SqliteStore) GetJob(ctx context.Context, jobId string) (*dto.Job, error) {
+	var job dto.Job
+	err := s.DB.Where("job_id = ?", jobId).First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *SqliteStore) ListJobs(ctx context.Context, creatorId string, limit int) (jobs []dto.Job, err error) {
+	err = s.DB.Where("creator_id = ?", creatorId).Order("create_time DESC, id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimJob 先查出候选任务，再按状态条件更新，多个 worker 同时领取时只有一个成功；
+// 不放在事务中，避免 sqlite 读锁升级为写锁时互相等待
+func (s *SqliteStore) ClaimJob(ctx context.Context, now int64) (*dto.Job, error) {
+	// 轮询时通常没有任务，用 Find 避免 First 记录 record not found 日志
+	var jobs []dto.Job
+	err := s.DB.Where("status = ? AND run_at <= ?", dto.JobStatusPending, now).Order("run_at, id").Limit(1).Find(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	job := jobs[0]
+	res := s.DB.Model(&dto.Job{}).
+		Where("job_id = ? AND status = ?", job.JobId, dto.JobStatusPending).
+		Updates(map[string]interface{}{
+			"status":      dto.JobStatusRunning,
+			"attempts":    gorm.Expr("attempts + 1"),
+			"start_time":  now,
+			"update_time": now,
+			"error":       "",
+			"progress":    0,
+			"message":     "",
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	job.Status = dto.JobStatusRunning
+	job.Attempts++
+	job.StartTime, job.UpdateTime, job.Error = now, now, ""
+	job.Progress, job.Message = 0, ""
+	return &job, nil
+}
+
+func (s *SqliteStore) UpdateJobProgress(ctx context.Context, jobId string, progress int, message string, now int64) error {
+	return s.DB.Model(&dto.Job{}).Where("job_id = ?", jobId).Updates(map[string]interface{}{
+		"progress":    progress,
+		"message":     message,
+		"update_time": now,
+	}).Error
+}
+
+func (s *SqliteStore) UpdateJobState(ctx context.Context, job dto.Job) error {
+	return s.DB.Model(&dto.Job{}).Where("job_id = ?", job.JobId).
+		Select("status", "progress", "message", "error", "result_file_ids", "run_at", "update_time", "finish_time").
+		Updates(&job).Error
+}
+
+func (s *SqliteStore) CancelJob(ctx context.Context, jobId string, now int64) (*dto.Job, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&dto.Job{}).Where("job_id = ? AND status = ?", jobId, dto.JobStatusPending).Updates(map[string]interface{}{
+			"status":           dto.JobStatusCanceled,
+			"cancel_requested": true,
+			"update_time":      now,
+			"finish_time":      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&dto.Job{}).Where("job_id = ? AND status = ?", jobId, dto.JobStatusRunning).Updates(map[string]interface{}{
+			"cancel_requested": true,
+			"update_time":      now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetJob(ctx, jobId)
+}
+
+func (s *SqliteStore) ResetRunningJobs(ctx context.Context, now int64) (int64, error) {
+	var affected int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&dto.Job{}).Where("status = ? AND cancel_requested = ?", dto.JobStatusRunning, true).Updates(map[string]interface{}{
+			"status":      dto.JobStatusCanceled,
+			"update_time": now,
+			"finish_time": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Model(&dto.Job{}).Where("status = ?", dto.JobStatusRunning).Updates(map[string]interface{}{
+			"status":      dto.JobStatusPending,
+			"run_at":      now,
+			"update_time": now,
+		})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	return affected, err
+}
@@ -0,0 +1,57 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) GetUserQuota(ctx context.Context, userId string) (*dto.UserQuota, error) {
+	var quota dto.UserQuota
+	err := s.DB.Where("user_id = ?", userId).First(&quota).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (s *SqliteStore) InitUserQuota(ctx context.Context, quota dto.UserQuota) error {
+	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&quota).Error
+}
+
+func (s *SqliteStore) SetUserQuotaAllowance(ctx context.Context, userId string, freeRequests int64, freeTokens int64) error {
+	return s.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"free_requests", "free_tokens", "update_time"}),
+		},
+	).Create(&dto.UserQuota{
+		UserId:       userId,
+		FreeRequests: freeRequests,
+		FreeTokens:   freeTokens,
+		UpdateTime:   time.Now().Unix(),
+	}).Error
+}
+
+// ConsumeUserQuota 次数及 token 都有剩余时才扣减，free_tokens <= 0 不限制 token
+func (s *SqliteStore) ConsumeUserQuota(ctx context.Context, userId string, tokens int64) (bool, error) {
+	res := s.DB.Model(&dto.UserQuota{}).
+		Where("user_id = ? AND used_requests < free_requests AND (free_tokens <= 0 OR used_tokens < free_tokens)", userId).
+		Updates(map[string]interface{}{
+			"used_requests": gorm.Expr("used_requests + 1"),
+			"used_tokens":   gorm.Expr("used_tokens + ?", tokens),
+			"update_time":   time.Now().Unix(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -0,0 +1,57 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) GetUserStorage(ctx context.Context, userId string) (*dto.UserStorage, error) {
+	var storage dto.UserStorage
+	err := s.DB.Where("user_id = ?", userId).First(&storage).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &storage, nil
+}
+
+func (s *SqliteStore) AddUserStorage(ctx context.Context, userId string, delta int64, limit int64) (bool, error) {
+	now := time.Now().Unix()
+	err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&dto.UserStorage{UserId: userId, UpdateTime: now}).Error
+	if err != nil {
+		return false, err
+	}
+	query := s.DB.Model(&dto.UserStorage{}).Where("user_id = ?", userId)
+	if delta > 0 && limit > 0 {
+		query = query.Where("used_bytes + ? <= ?", delta, limit)
+	}
+	res := query.Updates(map[string]interface{}{
+		"used_bytes":  gorm.Expr("MAX(used_bytes + ?, 0)", delta),
+		"update_time": now,
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *SqliteStore) SetUserStorageLimit(ctx context.Context, userId string, limit int64) error {
+	return s.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"limit_bytes", "update_time"}),
+		},
+	).Create(&dto.UserStorage{
+		UserId:     userId,
+		LimitBytes: limit,
+		UpdateTime: time.Now().Unix(),
+	}).Error
+}
@@ -0,0 +1,35 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddTemplate(ctx context.Context, t dto.Template) error {
+	return s.DB.Create(&t).Error
+}
+
+func (s *SqliteStore) GetTemplate(ctx context.Context, templateId string) (*dto.Template, error) {
+	var t dto.Template
+	err := s.DB.Where("template_id = ?", templateId).First(&t).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *SqliteStore) ListTemplates(ctx context.Context) (templates []dto.Template, err error) {
+	err = s.DB.Order("create_time DESC").Find(&templates).Error
+	return templates, err
+}
+
+func (s *SqliteStore) DeleteTemplate(ctx context.Context, templateId string) error {
+	return s.DB.Delete(&dto.Template{}, "template_id = ?", templateId).Error
+}
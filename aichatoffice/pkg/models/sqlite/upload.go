@@ -0,0 +1,58 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) AddUpload(ctx context.Context, u dto.Upload) error {
+	return s.DB.Create(&u).Error
+}
+
+func (s *SqliteStore) GetUpload(ctx context.Context, uploadId string) (*dto.Upload, error) {
+	var u dto.Upload
+	err := s.DB.Where("upload_id = ?", uploadId).First(&u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *SqliteStore) AdvanceUpload(ctx context.Context, uploadId string, from int64, to int64, expireTime int64, now int64) (bool, error) {
+	res := s.DB.Model(&dto.Upload{}).
+		Where("upload_id = ? AND `offset` = ?", uploadId, from).
+		Updates(map[string]interface{}{
+			"offset":      to,
+			"expire_time": expireTime,
+			"update_time": now,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (s *SqliteStore) CompleteUpload(ctx context.Context, uploadId string, fileId string, now int64) error {
+	return s.DB.Model(&dto.Upload{}).
+		Where("upload_id = ?", uploadId).
+		Updates(map[string]interface{}{
+			"file_id":     fileId,
+			"update_time": now,
+		}).Error
+}
+
+func (s *SqliteStore) DeleteUpload(ctx context.Context, uploadId string) error {
+	return s.DB.Delete(&dto.Upload{}, "upload_id = ?", uploadId).Error
+}
+
+func (s *SqliteStore) ListExpiredUploads(ctx context.Context, now int64, limit int) (uploads []dto.Upload, err error) {
+	err = s.DB.Where("expire_time < ?", now).Order("expire_time").Limit(limit).Find(&uploads).Error
+	return uploads, err
+}
@@ -0,0 +1,85 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+// 可汇总的维度
+var usageGroupColumns = map[string]string{
+	"user":         "user_id",
+	"day":          "day",
+	"model":        "model",
+	"conversation": "conversation_id",
+}
+
+func (s *SqliteStore) AddUsageRecord(ctx context.Context, record dto.UsageRecord) error {
+	return s.DB.Create(&record).Error
+}
+
+func (s *SqliteStore) AggregateUsage(ctx context.Context, query dto.UsageQuery) (result []dto.UsageAggregate, err error) {
+	column, ok := usageGroupColumns[query.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported group by: %s", query.GroupBy)
+	}
+	db := s.DB.Model(&dto.UsageRecord{}).
+		Select(column + ` AS "key",
+			COUNT(*) AS requests,
+			SUM(prompt_tokens) AS prompt_tokens,
+			SUM(completion_tokens) AS completion_tokens,
+			SUM(reasoning_tokens) AS reasoning_tokens,
+			SUM(total_tokens) AS total_tokens,
+			SUM(cost) AS cost`).
+		Group(column).
+		Order(column)
+	if query.UserId != "" {
+		db = db.Where("user_id = ?", query.UserId)
+	}
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.FromDay != "" {
+		db = db.Where("day >= ?", query.FromDay)
+	}
+	if query.ToDay != "" {
+		db = db.Where("day <= ?", query.ToDay)
+	}
+	err = db.Scan(&result).Error
+	return
+}
+
+func (s *SqliteStore) SumUserCost(ctx context.Context, userId string, fromDay string) (float64, error) {
+	var cost float64
+	err := s.DB.Model(&dto.UsageRecord{}).
+		Select("COALESCE(SUM(cost), 0)").
+		Where("user_id = ? AND day >= ?", userId, fromDay).
+		Scan(&cost).Error
+	return cost, err
+}
+
+func (s *SqliteStore) GetUserBudget(ctx context.Context, userId string) (*dto.UserBudget, error) {
+	var budget dto.UserBudget
+	err := s.DB.Where("user_id = ?", userId).First(&budget).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func (s *SqliteStore) SetUserBudget(ctx context.Context, budget dto.UserBudget) error {
+	return s.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			UpdateAll: true,
+		},
+	).Create(&budget).Error
+}
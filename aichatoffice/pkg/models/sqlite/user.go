@@ -0,0 +1,62 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+func (s *SqliteStore) GetUser(ctx context.Context, userId string) (*dto.User, error) {
+	var user dto.User
+	err := s.DB.Where("user_id = ?", userId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *SqliteStore) GetUserByTokenHash(ctx context.Context, tokenHash string) (*dto.User, error) {
+	var user dto.User
+	err := s.DB.Where("token_hash = ?", tokenHash).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *SqliteStore) ListUsers(ctx context.Context) (users []dto.User, err error) {
+	err = s.DB.Order("id").Find(&users).Error
+	return
+}
+
+func (s *SqliteStore) CountUsersByRole(ctx context.Context, role string) (int, error) {
+	var count int64
+	err := s.DB.Model(&dto.User{}).Where("role = ?", role).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (s *SqliteStore) SetUser(ctx context.Context, user dto.User) error {
+	return s.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "role", "token_hash", "modify_time"}),
+		},
+	).Create(&user).Error
+}
+
+func (s *SqliteStore) DeleteUser(ctx context.Context, userId string) error {
+	return s.DB.Delete(&dto.User{}, "user_id = ?", userId).Error
+}
@@ -14,7 +14,65 @@ type FileStore interface {
 	GetFileMeta(ctx context.Context, fileID string) (file dto.FileMeta, err error)
 	SetFileMeta(ctx context.Context, f dto.FileMeta) error
 	DeleteFileMeta(ctx context.Context, fileID string) error
-	GetFilesList(ctx context.Context) (files []dto.FileMeta, err error)
+	// QueryFiles returns one page of files matching the query and the total count ignoring the cursor
+	QueryFiles(ctx context.Context, query dto.FileQuery) (files []dto.FileMeta, total int64, err error)
+	MoveFile(ctx context.Context, fileID string, folderId string) error
+	RenameFile(ctx context.Context, fileID string, name string) error
+	// TrashFile marks the file as deleted, returns false if it is already in trash
+	TrashFile(ctx context.Context, fileID string, deleterId string, deleteTime int64) (bool, error)
+	// RestoreFile clears the deleted mark and moves the file to folderId, returns false if it is not in trash
+	RestoreFile(ctx context.Context, fileID string, folderId string) (bool, error)
+	// ListTrashedFiles returns files moved to trash at or before the given time, oldest first
+	ListTrashedFiles(ctx context.Context, before int64, limit int) ([]dto.FileMeta, error)
+}
+
+// FolderStore defines the abstraction of folder storage
+type FolderStore interface {
+	AddFolder(ctx context.Context, folder dto.Folder) error
+	// GetFolder returns nil if the folder does not exist
+	GetFolder(ctx context.Context, folderId string) (*dto.Folder, error)
+	ListFolders(ctx context.Context, parentId string) ([]dto.Folder, error)
+	UpdateFolder(ctx context.Context, folder dto.Folder) error
+	DeleteFolder(ctx context.Context, folderId string) error
+	// CountFolderChildren returns the number of files not in trash and sub folders directly in the folder
+	CountFolderChildren(ctx context.Context, folderId string) (int64, error)
+}
+
+// TagStore defines the abstraction of file tags
+type TagStore interface {
+	// SetFileTags replaces all tags of the file
+	SetFileTags(ctx context.Context, fileId string, tags []string) error
+	// ListFileTags returns tags grouped by file id, sorted by tag
+	ListFileTags(ctx context.Context, fileIds []string) (map[string][]string, error)
+	ListTags(ctx context.Context) ([]dto.TagCount, error)
+	DeleteFileTags(ctx context.Context, fileId string) error
+}
+
+// FileVersionStore 文件版本记录，版本一旦写入不再修改
+type FileVersionStore interface {
+	AddFileVersion(ctx context.Context, v dto.FileVersion) error
+	GetFileVersion(ctx context.Context, fileId string, version int64) (*dto.FileVersion, error)
+	ListFileVersions(ctx context.Context, fileId string) ([]dto.FileVersion, error)
+	DeleteFileVersion(ctx context.Context, fileId string, version int64) error
+	DeleteFileVersions(ctx context.Context, fileId string) error
+}
+
+// StorageStore defines the abstraction of per-user storage accounting
+type StorageStore interface {
+	// GetUserStorage returns nil if the user has no record yet
+	GetUserStorage(ctx context.Context, userId string) (*dto.UserStorage, error)
+	// AddUserStorage atomically adds delta to the used bytes, returns false if the result would exceed limit (limit <= 0 means no limit);
+	// negative deltas always succeed and never go below zero
+	AddUserStorage(ctx context.Context, userId string, delta int64, limit int64) (bool, error)
+	SetUserStorageLimit(ctx context.Context, userId string, limit int64) error
+}
+
+// ContentStore defines the abstraction of reference counts of content-addressed file content
+type ContentStore interface {
+	// AcquireContent adds a reference to the content, returns true if the content had no reference before and must be stored
+	AcquireContent(ctx context.Context, hash string, size int64) (bool, error)
+	// ReleaseContent removes a reference, returns the remaining references; the record is deleted when none is left
+	ReleaseContent(ctx context.Context, hash string) (int64, error)
 }
 
 type AiConfigStore interface {
@@ -35,6 +93,80 @@ type ChatStore interface {
 	IsConversationBreak(ctx context.Context, userId string, conversationId string) (bool, error)
 	ResumeConversation(ctx context.Context, userId string, conversationId string) error
 	DeleteConversation(ctx context.Context, userId string, conversationId string) error
+	// DeleteFileConversations deletes all users' conversations about the file and their messages
+	DeleteFileConversations(ctx context.Context, fileGuid string) error
 	DeleteExpireKeys() error
 	RunDeleteExpireKeysCronjob(interval time.Duration)
 }
+
+// UserStore defines the abstraction of user storage and retrieval
+type UserStore interface {
+	GetUser(ctx context.Context, userId string) (*dto.User, error)
+	GetUserByTokenHash(ctx context.Context, tokenHash string) (*dto.User, error)
+	ListUsers(ctx context.Context) ([]dto.User, error)
+	CountUsersByRole(ctx context.Context, role string) (int, error)
+	SetUser(ctx context.Context, user dto.User) error
+	DeleteUser(ctx context.Context, userId string) error
+}
+
+// AuditStore defines the abstraction of audit log storage and retrieval
+type AuditStore interface {
+	AddAuditLog(ctx context.Context, log dto.AuditLog) error
+	ListAuditLogs(ctx context.Context, action string, limit int, offset int) ([]dto.AuditLog, error)
+}
+
+// QuotaStore defines the abstraction of user quota storage and retrieval
+type QuotaStore interface {
+	GetUserQuota(ctx context.Context, userId string) (*dto.UserQuota, error)
+	// InitUserQuota creates the quota row if it does not exist yet
+	InitUserQuota(ctx context.Context, quota dto.UserQuota) error
+	SetUserQuotaAllowance(ctx context.Context, userId string, freeRequests int64, freeTokens int64) error
+	// ConsumeUserQuota atomically uses one request and the given tokens, returns false if nothing is left
+	ConsumeUserQuota(ctx context.Context, userId string, tokens int64) (bool, error)
+}
+
+// UsageStore defines the abstraction of usage accounting storage and retrieval
+type UsageStore interface {
+	AddUsageRecord(ctx context.Context, record dto.UsageRecord) error
+	AggregateUsage(ctx context.Context, query dto.UsageQuery) ([]dto.UsageAggregate, error)
+	SumUserCost(ctx context.Context, userId string, fromDay string) (float64, error)
+	GetUserBudget(ctx context.Context, userId string) (*dto.UserBudget, error)
+	SetUserBudget(ctx context.Context, budget dto.UserBudget) error
+}
+
+// TemplateStore defines the abstraction of report template storage and retrieval
+type TemplateStore interface {
+	AddTemplate(ctx context.Context, t dto.Template) error
+	GetTemplate(ctx context.Context, templateId string) (*dto.Template, error)
+	ListTemplates(ctx context.Context) ([]dto.Template, error)
+	DeleteTemplate(ctx context.Context, templateId string) error
+}
+
+// JobStore defines the abstraction of background job storage and retrieval
+type JobStore interface {
+	AddJob(ctx context.Context, job dto.Job) error
+	GetJob(ctx context.Context, jobId string) (*dto.Job, error)
+	ListJobs(ctx context.Context, creatorId string, limit int) ([]dto.Job, error)
+	// ClaimJob atomically marks the earliest runnable pending job as running, returns nil if there is none
+	ClaimJob(ctx context.Context, now int64) (*dto.Job, error)
+	UpdateJobProgress(ctx context.Context, jobId string, progress int, message string, now int64) error
+	// UpdateJobState saves status, error, results and scheduling fields, but not the cancel flag
+	UpdateJobState(ctx context.Context, job dto.Job) error
+	// CancelJob cancels a pending job directly and flags a running one, returns the job after the change
+	CancelJob(ctx context.Context, jobId string, now int64) (*dto.Job, error)
+	// ResetRunningJobs requeues jobs left running by a previous process
+	ResetRunningJobs(ctx context.Context, now int64) (int64, error)
+}
+
+// UploadStore defines the abstraction of resumable upload state storage
+type UploadStore interface {
+	AddUpload(ctx context.Context, u dto.Upload) error
+	// GetUpload returns nil if the upload does not exist
+	GetUpload(ctx context.Context, uploadId string) (*dto.Upload, error)
+	// AdvanceUpload moves the offset from `from` to `to` and extends the expiry, returns false if the offset is no longer `from`
+	AdvanceUpload(ctx context.Context, uploadId string, from int64, to int64, expireTime int64, now int64) (bool, error)
+	CompleteUpload(ctx context.Context, uploadId string, fileId string, now int64) error
+	DeleteUpload(ctx context.Context, uploadId string) error
+	// ListExpiredUploads returns at most limit uploads that expired before now
+	ListExpiredUploads(ctx context.Context, now int64, limit int) ([]dto.Upload, error)
+}
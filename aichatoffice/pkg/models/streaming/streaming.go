@@ -1,6 +1,7 @@
 package streaming
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -124,6 +125,52 @@ func FormatDataContent(data string, dataType StreamPartType) string {
 	}
 }
 
+// FormatJSONContent 用于 JSON 类型的部分（数据、注释、工具调用、完成等），不做字符串转义
+func FormatJSONContent(v interface{}, dataType StreamPartType) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s\n", dataType, data), nil
+}
+
+// FinishMessage 消息完成部分的内容
+type FinishMessage struct {
+	FinishReason FinishReason `json:"finishReason"`
+	Usage        Usage        `json:"usage"`
+}
+
+// StartStep 步骤开始部分的内容
+type StartStep struct {
+	MessageId string `json:"messageId"`
+}
+
+// FinishStep 步骤完成部分的内容，IsContinued 表示下一步继续当前消息
+type FinishStep struct {
+	FinishReason FinishReason `json:"finishReason"`
+	Usage        Usage        `json:"usage"`
+	IsContinued  bool         `json:"isContinued"`
+}
+
+// ToolCall 工具调用部分的内容
+type ToolCall struct {
+	ToolCallId string      `json:"toolCallId"`
+	ToolName   string      `json:"toolName"`
+	Args       interface{} `json:"args"`
+}
+
+// ToolResult 工具结果部分的内容
+type ToolResult struct {
+	ToolCallId string      `json:"toolCallId"`
+	Result     interface{} `json:"result"`
+}
+
+// Usage 流协议中的 token 用量
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+}
+
 // -------- 以下测试
 func GenTestStreamData(dataType StreamPartType, event chan string) {
 	// 单独处理推理签名部分 (需要现有推理数据, 然后生成签名)
@@ -3,6 +3,7 @@ package api
 import (
 	"aichatoffice/pkg/invoker"
 	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
 	"net/http"
 
 	aisvc "aichatoffice/pkg/services/ai"
@@ -26,11 +27,17 @@ func UpdateAIConfig(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	before, err := invoker.AiConfigSvc.GetAIConfig(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	err = invoker.AiConfigSvc.UpdateAIConfig(ctx, aiConfigs)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	invoker.AuditSvc.Record(ctx, middlewares.CurrentUser(ctx), dto.AuditActionAiConfigUpdate, "ai_configs", aisvc.DiffAIConfig(before, aiConfigs))
 	// 更新后重新初始化 ai 服务
 	aiSvc, err := aisvc.NewOpenAI(invoker.AiConfigSvc)
 	if err != nil {
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	chartsvc "aichatoffice/pkg/services/chart"
+)
+
+// maxChartSpecSize 图表定义的大小上限，数据以 data.values 内联在定义中
+const maxChartSpecSize = 1 << 20
+
+// CreateChart 按 Vega-Lite 定义渲染图表，保存为文件的附件资源，返回图片地址及对象名，用于插入文档
+func CreateChart(c *gin.Context) {
+	fileId := c.Param("guid")
+	if _, err := invoker.FileService.GetFileMeta(c, fileId); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get file: " + err.Error()})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxChartSpecSize)
+	body, err := io.ReadAll(c.Request.Body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "chart spec too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	spec, err := chartsvc.ParseSpec(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	chart, err := invoker.ChartSvc.Save(c, fileId, spec)
+	if errors.Is(err, chartsvc.ErrInvalidSpec) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chart: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, chart)
+}
@@ -1,16 +1,17 @@
 package api
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"aichatoffice/pkg/invoker"
-	aisvc "aichatoffice/pkg/services/ai"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	chatsvc "aichatoffice/pkg/services/chat"
+	limitsvc "aichatoffice/pkg/services/limit"
 	"github.com/gin-gonic/gin"
-	"github.com/gotomicro/cetus/l"
 	"github.com/gotomicro/ego/core/elog"
 	"go.uber.org/zap"
 )
@@ -37,28 +38,17 @@ type ChatRequest struct {
 }
 
 func Completions(ctx *gin.Context) {
-	// 检查是否有ai配置
-	aiConfigs, err := invoker.AiConfigSvc.GetAIConfig(ctx)
-	userId := ctx.Query("userId")
-	var isFree bool
-	if err != nil || len(aiConfigs) == 0 {
-		if !CheckFreeTimes(userId) {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error() + ", 暂无免费次数, 请先配置AI模型"})
-			return
-		}
-		isFree = true
+	userId := ctx.GetString(middlewares.CtxUserGuid)
+	opts, release, ok := prepareAi(ctx, userId)
+	if !ok {
+		return
 	}
 
-	ctx.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
-	ctx.Writer.Header().Set("Cache-Control", "no-cache")
-	ctx.Writer.Header().Set("Connection", "keep-alive")
-	ctx.Writer.Header().Set("Transfer-Encoding", "chunked")
-	ctx.Writer.Header().Set("x-vercel-ai-data-stream", "v1")
-
 	conversionId := ctx.Param("conversation_id")
 	chatRequest := ChatRequest{}
-	err = ctx.ShouldBindJSON(&chatRequest)
+	err := ctx.ShouldBindJSON(&chatRequest)
 	if err != nil {
+		release()
 		elog.Error("should bind json", zap.Error(err))
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -67,6 +57,7 @@ func Completions(ctx *gin.Context) {
 	// 最后一条里的content，作为输入内容
 	chatInput, err := handleChatRequest(chatRequest)
 	if err != nil {
+		release()
 		elog.Error("handle chat request", zap.Error(err))
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -77,7 +68,73 @@ func Completions(ctx *gin.Context) {
 	// chatInput = "你好，你是谁"
 
 	// 对接 openai 协议
-	go invoker.ChatService.Chat(ctx.Request.Context(), userId, conversionId, chatInput, event, isFree)
+	go func() {
+		defer release()
+		invoker.ChatService.Chat(ctx.Request.Context(), userId, conversionId, chatInput, event, opts)
+	}()
+	streamEvents(ctx, event)
+}
+
+// prepareAi 选择 ai 服务并检查试用额度、月度预算及限流，成功时占用服务方并发名额，调用方结束后 release
+func prepareAi(ctx *gin.Context, userId string) (opts chatsvc.ChatOptions, release func(), ok bool) {
+	// 检查是否有ai配置，没有则使用试用额度
+	aiConfigs, err := invoker.AiConfigSvc.GetAIConfig(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(aiConfigs) == 0 {
+		err = invoker.QuotaSvc.Check(ctx, userId)
+		if err != nil {
+			apiErr := dto.FromError(err)
+			ctx.JSON(http.StatusForbidden, gin.H{"error": apiErr.Message, "code": apiErr.Code})
+			return
+		}
+		opts.AiSvc = invoker.QuotaSvc.TrialAiSvc()
+		opts.Trial = true
+	}
+
+	// 月度预算：超过硬预算拒绝，超过软预算降级模型
+	budget, err := invoker.UsageSvc.CheckBudget(ctx, userId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if budget.Blocked {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": dto.ErrBudgetExceeded.Message, "code": dto.ErrBudgetExceeded.Code})
+		return
+	}
+	if opts.AiSvc == nil {
+		opts.AiSvc = invoker.ChatService.AiSvc
+	}
+	if budget.Downgrade {
+		opts.AiSvc = opts.AiSvc.WithModel(budget.DowngradeModel)
+	}
+
+	// 按用户、API Key 限流，并占用服务方并发名额，生成结束后释放
+	err = invoker.LimitSvc.AllowUser(userId)
+	if err == nil {
+		err = invoker.LimitSvc.AllowKey(opts.AiSvc.KeyId())
+	}
+	if err != nil {
+		abortLimited(ctx, err)
+		return
+	}
+	release, err = invoker.LimitSvc.Acquire(ctx.Request.Context(), opts.AiSvc.Provider())
+	if err != nil {
+		abortLimited(ctx, err)
+		return
+	}
+	return opts, release, true
+}
+
+// streamEvents 以流协议把事件写给前端，直到 event 关闭
+func streamEvents(ctx *gin.Context, event <-chan string) {
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.Header().Set("Transfer-Encoding", "chunked")
+	ctx.Writer.Header().Set("x-vercel-ai-data-stream", "v1")
 
 	ctx.Stream(func(w io.Writer) bool {
 		e, ok := <-event
@@ -92,6 +149,22 @@ func Completions(ctx *gin.Context) {
 	})
 }
 
+// abortLimited 限流时返回 429 及 Retry-After
+func abortLimited(ctx *gin.Context, err error) {
+	var limitErr *limitsvc.LimitError
+	if errors.As(err, &limitErr) {
+		ctx.Header("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": limitErr.Error()})
+		return
+	}
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+}
+
+// GetLimits 当前用户的限流状态及各服务方并发情况
+func GetLimits(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, invoker.LimitSvc.Status(ctx.GetString(middlewares.CtxUserGuid)))
+}
+
 // 处理输入，特别是自定义 key
 func handleChatRequest(chatRequest ChatRequest) (chatInput string, err error) {
 	if len(chatRequest.Messages) == 0 {
@@ -116,6 +189,11 @@ func GetConversation(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "fileId is required"})
 		return
 	}
+	// 回收站中的文件恢复前不能查看对话
+	if _, err := invoker.FileService.GetFileMeta(ctx, fileId); errors.Is(err, dto.ErrFileInTrash) {
+		ctx.JSON(http.StatusGone, gin.H{"error": err.Error(), "code": dto.ErrFileInTrash.Code})
+		return
+	}
 	// todo
 	userId := "111"
 
@@ -132,54 +210,51 @@ func GetConversation(ctx *gin.Context) {
 	})
 }
 
-type UserInfo struct {
-	FreeTimes int64 `json:"freeTimes"`
-}
-
-type AIConfig struct {
-	Token     string `json:"token"`
-	TextModel string `json:"textModel"`
-	BaseUrl   string `json:"baseUrl"`
+// GetQuota 获取当前用户的试用额度
+func GetQuota(ctx *gin.Context) {
+	userId := ctx.GetString(middlewares.CtxUserGuid)
+	if userId == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+	status, err := invoker.QuotaSvc.Status(ctx, userId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
 }
 
-type FreeConfig struct {
-	User UserInfo `json:"user"`
-	AI   AIConfig `json:"ai"`
+type QuotaRequest struct {
+	FreeRequests int64 `json:"freeRequests"`
+	FreeTokens   int64 `json:"freeTokens"`
 }
 
-func CheckFreeTimes(userId string) bool {
-	if userId == "" {
-		return false
+// UpdateUserQuota 管理员调整用户试用额度
+func UpdateUserQuota(ctx *gin.Context) {
+	userId := ctx.Param("userId")
+	req := QuotaRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	// 请求免费次数信息
-	resp, err := http.Get(fmt.Sprintf("http://localhost:9001/api/auth/%s/free/config", userId))
-	if err != nil {
-		elog.Error("Request failed:", l.E(err))
-		return false
+	if err := checkUserExists(ctx, userId); err != nil {
+		ctx.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
+	before, err := invoker.QuotaSvc.Status(ctx, userId)
 	if err != nil {
-		elog.Error("Read body failed:", l.E(err))
-		return false
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	var fConfig FreeConfig
-	err = json.Unmarshal(body, &fConfig)
+	status, err := invoker.QuotaSvc.SetAllowance(ctx, userId, req.FreeRequests, req.FreeTokens)
 	if err != nil {
-		elog.Error("fConfig unmarshal failed:", l.E(err))
-		return false
-	}
-	if fConfig.User.FreeTimes <= 0 {
-		return false
-	}
-	// 重新初始化ai配置
-	openAIManager := aisvc.OpenAISvc{}
-	openAIManager.LoadConfig(aisvc.OpenAiConfig{
-		Token:     fConfig.AI.Token,
-		TextModel: fConfig.AI.TextModel,
-		BaseUrl:   fConfig.AI.BaseUrl,
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invoker.AuditSvc.Record(ctx, middlewares.CurrentUser(ctx), dto.AuditActionQuotaUpdate, userId, dto.FieldChanges{
+		{Item: userId, Field: "freeRequests", Old: strconv.FormatInt(before.FreeRequests, 10), New: strconv.FormatInt(status.FreeRequests, 10)},
+		{Item: userId, Field: "freeTokens", Old: strconv.FormatInt(before.FreeTokens, 10), New: strconv.FormatInt(status.FreeTokens, 10)},
 	})
-	invoker.ChatService.AiSvc = openAIManager
-	return true
+	ctx.JSON(http.StatusOK, status)
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/server/http/middlewares"
+	chatsvc "aichatoffice/pkg/services/chat"
+	docsvc "aichatoffice/pkg/services/doc"
+)
+
+// GenerateDeckRequest outline 不为空时直接按大纲生成，否则由 ai 根据 prompt 及 sourceFileId 对应的文档撰写大纲；
+// templateFileId 为空时使用配置中的母版
+type GenerateDeckRequest struct {
+	Name           string                 `json:"name"`
+	Prompt         string                 `json:"prompt"`
+	SourceFileId   string                 `json:"sourceFileId"`
+	Outline        []chatsvc.SlideOutline `json:"outline"`
+	TemplateFileId string                 `json:"templateFileId"`
+}
+
+// GenerateDeck 生成 pptx 演示文稿，逐页以步骤流式返回进度，最后返回新文件的信息
+func GenerateDeck(c *gin.Context) {
+	var req GenerateDeckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Outline) == 0 && req.Prompt == "" && req.SourceFileId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "outline, prompt or sourceFileId is required"})
+		return
+	}
+	template, err := invoker.DocSvc.DeckTemplate(c, req.TemplateFileId)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, docsvc.ErrInvalidDeckTemplate) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Failed to load deck template: " + err.Error()})
+		return
+	}
+
+	userId := c.GetString(middlewares.CtxUserGuid)
+	var opts chatsvc.ChatOptions
+	release := func() {}
+	if len(req.Outline) == 0 {
+		var ok bool
+		opts, release, ok = prepareAi(c, userId)
+		if !ok {
+			return
+		}
+	}
+	event := make(chan string)
+	go func() {
+		defer release()
+		invoker.ChatService.GenerateDeck(c.Request.Context(), userId, chatsvc.DeckRequest{
+			Name:         req.Name,
+			Prompt:       req.Prompt,
+			SourceFileId: req.SourceFileId,
+			Outline:      req.Outline,
+			Template:     template,
+		}, event, opts)
+	}()
+	streamEvents(c, event)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	blobsvc "aichatoffice/pkg/services/blob"
+	docsvc "aichatoffice/pkg/services/doc"
+)
+
+// DiffFile 比较文件的两个版本，或与另一个文件比较
+// from、to 为版本号（可带 v 前缀），file 为另一个文件的 id；
+// 同一文件不传 from 时与上一个版本比较，不传 to 时使用当前版本；summary=true 时以流协议返回变更及 ai 总结
+func DiffFile(c *gin.Context) {
+	fileId := c.Param("guid")
+	from, err := parseVersion(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseVersion(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	toFileId := c.Query("file")
+	if toFileId == "" {
+		toFileId = fileId
+	}
+	if from == nil && toFileId == fileId {
+		file, err := invoker.FileService.GetFileMeta(c, fileId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file: " + err.Error()})
+			return
+		}
+		current := file.Version
+		if to != nil {
+			current = *to
+		}
+		prev, err := invoker.FileService.PreviousVersion(c, file, current)
+		if errors.Is(err, dto.ErrNoPreviousVersion) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": dto.ErrNoPreviousVersion.Code})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file: " + err.Error()})
+			return
+		}
+		from = &prev
+	}
+
+	diff, err := invoker.DocSvc.Diff(c, docsvc.DiffTarget{FileId: fileId, Version: from}, docsvc.DiffTarget{FileId: toFileId, Version: to})
+	switch {
+	case errors.Is(err, dto.ErrVersionNotFound), errors.Is(err, blobsvc.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, docsvc.ErrUnsupportedKind), errors.Is(err, docsvc.ErrIncomparable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to diff file: " + err.Error()})
+		return
+	}
+	if c.Query("summary") != "true" {
+		c.JSON(http.StatusOK, diff)
+		return
+	}
+
+	userId := c.GetString(middlewares.CtxUserGuid)
+	opts, release, ok := prepareAi(c, userId)
+	if !ok {
+		return
+	}
+	event := make(chan string)
+	go func() {
+		defer release()
+		invoker.ChatService.SummarizeDiff(c.Request.Context(), userId, diff, event, opts)
+	}()
+	streamEvents(c, event)
+}
+
+// parseVersion 解析版本号，空字符串返回 nil
+func parseVersion(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(s), "v"), 10, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+	return &v, nil
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -14,15 +16,48 @@ import (
 
 	"aichatoffice/pkg/invoker"
 	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	blobsvc "aichatoffice/pkg/services/blob"
+	filesvc "aichatoffice/pkg/services/file"
 	"aichatoffice/pkg/utils"
 )
 
+// GetFiles 按条件分页查询文件，按 cursor 翻页；folderId 参数存在时只查该文件夹（空为根目录），from、to 为 unix 秒；
+// 每个文件带有签名的下载地址
 func GetFiles(c *gin.Context) {
-	files, err := invoker.FileService.GetFilesList(c)
+	query := dto.FileQuery{
+		Kind:      c.Query("kind"),
+		Type:      c.Query("type"),
+		Tag:       c.Query("tag"),
+		CreatorId: c.Query("creatorId"),
+		TimeField: c.Query("timeField"),
+		Sort:      c.Query("sort"),
+		Desc:      c.DefaultQuery("order", "desc") != "asc",
+	}
+	if folderId, ok := c.GetQuery("folderId"); ok {
+		query.FolderId = &folderId
+	}
+	var err error
+	for param, value := range map[string]*int64{"from": &query.FromTime, "to": &query.ToTime} {
+		if v := c.Query(param); v != "" {
+			if *value, err = strconv.ParseInt(v, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	files, err := invoker.FileService.QueryFiles(c, query, c.Query("cursor"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "GetFilesList failed: " + err.Error()})
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to query files: " + err.Error()})
 		return
 	}
+	invoker.FileService.FillDownloadUrls(files.Files)
 	c.JSON(200, files)
 }
 
@@ -34,10 +69,73 @@ func GetFile(c *gin.Context) {
 	}
 	file, err := invoker.FileService.GetFileMeta(c, fileId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file: " + err.Error()})
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to get file: " + err.Error()})
 		return
 	}
-	c.JSON(200, file)
+	files := []dto.FileMeta{file}
+	if err = invoker.FileService.FillTags(c, files); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file tags: " + err.Error()})
+		return
+	}
+	invoker.FileService.FillDownloadUrls(files)
+	c.JSON(200, files[0])
+}
+
+// UpdateFileRequest 为 nil 的字段不修改，folder_id 为空串时移动到根目录
+type UpdateFileRequest struct {
+	Name     *string `json:"name"`
+	FolderId *string `json:"folder_id"`
+}
+
+// UpdateFile 重命名或移动文件，只能修改自己创建的文件，管理员除外
+func UpdateFile(c *gin.Context) {
+	var req UpdateFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fileId := c.Param("guid")
+	userId, admin := c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin()
+	file, err := invoker.FileService.GetFileMeta(c, fileId)
+	if req.Name != nil && err == nil {
+		file, err = invoker.FileService.RenameFile(c, fileId, *req.Name, userId, admin)
+	}
+	if req.FolderId != nil && err == nil {
+		file, err = invoker.FileService.MoveFile(c, fileId, *req.FolderId, userId, admin)
+	}
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to update file: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// SetFileTagsRequest 替换文件的所有标签
+type SetFileTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func SetFileTags(c *gin.Context) {
+	var req SetFileTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags, err := invoker.FileService.SetTags(c, c.Param("guid"), req.Tags, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin())
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to set file tags: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func GetTags(c *gin.Context) {
+	tags, err := invoker.FileService.ListTags(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tags: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tags)
 }
 
 func DeleteFile(c *gin.Context) {
@@ -46,84 +144,222 @@ func DeleteFile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get fileId"})
 		return
 	}
-	err := invoker.FileService.DeleteFile(c, fileId)
+	// 移入当前用户的回收站，可恢复；只能删除自己创建的文件，管理员除外
+	_, err := invoker.TrashSvc.Trash(c, fileId, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file: " + err.Error()})
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to delete file: " + err.Error()})
 		return
 	}
-	c.JSON(204, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// multipartOverhead 表单中除文件内容外的部分（分隔符、其他字段）允许的大小
+const multipartOverhead = 1 << 20
+
+// limitUploadBody 按单个文件上限限制请求体，声明的长度已超过上限时直接返回 413
+func limitUploadBody(c *gin.Context, overhead int64) bool {
+	limit := filesvc.MaxFileSize()
+	if limit <= 0 {
+		return true
+	}
+	if c.Request.ContentLength > limit+overhead {
+		respondUploadErr(c, dto.ErrFileTooLarge, "")
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+overhead)
+	return true
+}
+
+// respondUploadErr 超过文件大小上限返回 413，超过用户存储空间返回 403，均带有错误码
+func respondUploadErr(c *gin.Context, err error, message string) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, dto.ErrFileTooLarge) || errors.As(err, &maxBytesErr):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": dto.ErrFileTooLarge.Message, "code": dto.ErrFileTooLarge.Code})
+	case errors.Is(err, dto.ErrDiskVolumeExceed):
+		c.JSON(http.StatusForbidden, gin.H{"error": dto.ErrDiskVolumeExceed.Message, "code": dto.ErrDiskVolumeExceed.Code})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": message + err.Error()})
+	}
 }
 
+// UploadFile 流式读取表单中的 file 字段并写入存储，不在内存中缓存整个文件；folderId 参数指定保存到的文件夹，
+// 只能是当前用户创建的文件夹（管理员不限）
 func UploadFile(c *gin.Context) {
-	_file, err := c.FormFile("file")
+	folderId := c.Query("folderId")
+	if folderId != "" {
+		if _, err := invoker.FileService.GetWritableFolder(c, folderId, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin()); err != nil {
+			c.JSON(fileErrStatus(err), gin.H{"error": "Failed to get folder: " + err.Error()})
+			return
+		}
+	}
+	if !limitUploadBody(c, multipartOverhead) {
+		return
+	}
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		c.JSON(400, gin.H{"error": "Failed to get file from form"})
 		return
 	}
-	file, err := _file.Open()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "file open failed"})
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": "Failed to get file from form"})
+			return
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				respondUploadErr(c, err, "")
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"message": "file read failed"})
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		fileName := part.FileName()
+		f := dto.FileMeta{
+			Name:       fileName,
+			FileID:     utils.GenFileGuid(),
+			CreateTime: time.Now().Unix(),
+			Ext:        filepath.Ext(fileName),
+			CreatorId:  c.GetString(middlewares.CtxUserGuid),
+			FolderId:   folderId,
+		}
+		err = invoker.FileService.UploadStream(c, &f, part)
+		part.Close()
+		if err != nil {
+			respondUploadErr(c, err, "file upload failed")
+			return
+		}
+		f.DownloadUrl = invoker.FileService.GetDownloadUrl(f.FileID, 0)
+		c.JSON(200, f)
+		return
+	}
+}
+
+// GetStorage 当前用户已用及可用的存储空间
+func GetStorage(c *gin.Context) {
+	userId := c.GetString(middlewares.CtxUserGuid)
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
 		return
 	}
-	defer file.Close()
-	content, err := io.ReadAll(file)
+	status, err := invoker.FileService.StorageStatus(c, userId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "file read failed"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+type StorageRequest struct {
+	LimitBytes int64 `json:"limitBytes"` // 0 恢复为默认值，< 0 不限制
+}
+
+// UpdateUserStorage 管理员设置用户的存储空间
+func UpdateUserStorage(c *gin.Context) {
+	userId := c.Param("userId")
+	req := StorageRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkUserExists(c, userId); err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
 	}
-	mimeType := mimetype.Detect(content).String()
-	fileName := _file.Filename
-	ext := filepath.Ext(fileName)
-	f := dto.FileMeta{
-		Name:       fileName,
-		Size:       int64(len(content)),
-		FileID:     utils.GenFileGuid(),
-		Type:       mimeType,
-		CreateTime: time.Now().Unix(),
-		Ext:        ext,
+	before, err := invoker.FileService.StorageStatus(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	err = invoker.FileService.UploadFile(c, f, content)
+	status, err := invoker.FileService.SetStorageLimit(c, userId, req.LimitBytes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "file upload failed" + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	c.JSON(200, f)
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionStorageUpdate, userId, dto.FieldChanges{
+		{Item: userId, Field: "limitBytes", Old: strconv.FormatInt(before.LimitBytes, 10), New: strconv.FormatInt(status.LimitBytes, 10)},
+	})
+	c.JSON(http.StatusOK, status)
 }
 
 func UploadPathFile(c *gin.Context) {
 	fileId := c.Param("guid")
+	if _, err := invoker.FileService.GetFileMeta(c, fileId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "get file error: " + err.Error()})
+		return
+	}
+	if !limitUploadBody(c, 0) {
+		return
+	}
 	path := c.Query("path")
-	outFile, err := os.Create(fmt.Sprintf("%s/%s%s", econf.GetString("case.filepath"), fileId, path))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": path + "file upload failed" + err.Error()})
+	// 将 Body 直接写入存储，带有 Content-MD5 时校验内容
+	err := invoker.FileService.PutSdkObject(c, fileId, path, c.Request.Body, c.Request.ContentLength, c.ContentType(), c.GetHeader("Content-MD5"))
+	if errors.Is(err, blobsvc.ErrInvalidKey) || errors.Is(err, blobsvc.ErrInvalidDigest) || errors.Is(err, blobsvc.ErrDigestMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	// 将 Body 直接写入文件
-	if _, err := io.Copy(outFile, c.Request.Body); err != nil {
-		c.String(http.StatusInternalServerError, "failed to write file: %v", err)
+	if err != nil {
+		respondUploadErr(c, err, path+"file upload failed")
 		return
 	}
 	c.JSON(200, nil)
 }
 
+// DownloadPathFile 下载编辑器上传的对象及附件资源，支持 Range 及条件请求
 func DownloadPathFile(c *gin.Context) {
 	fileId := c.Param("guid")
 	file, err := invoker.FileService.GetFileMeta(c, fileId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "get file error: " + err.Error()})
+		c.JSON(fileErrStatus(err), gin.H{"message": "get file error: " + err.Error()})
 		return
 	}
 	path := c.Query("path")
 	disposition := c.Query("disposition")
-	if disposition == "" {
+	if disposition != "inline" {
 		disposition = "attachment"
 	}
-	content, err := os.ReadFile(fmt.Sprintf("%s/%s%s", econf.GetString("case.filepath"), fileId, path))
+	key, err := filesvc.SdkObjectKey(fileId, path)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	content, info, err := invoker.FileService.OpenObjectSeeker(c, key)
+	if errors.Is(err, blobsvc.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": path + " not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": path + "file read failed" + err.Error()})
+		return
 	}
-	c.Header("Content-Type", file.Type)
-	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.Name))
-	c.Data(200, file.Type, content)
+	defer content.Close()
+	// 附件资源（如图表图片）按内容识别类型，便于直接内联显示
+	contentType := info.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		mt, err := mimetype.DetectReader(content)
+		if err == nil {
+			_, err = content.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": path + "file read failed" + err.Error()})
+			return
+		}
+		contentType = mt.String()
+	}
+	etag := info.ETag
+	if etag == "" {
+		etag = fmt.Sprintf("%x-%x", info.Size, info.ModTime.UnixNano())
+	}
+	serveContent(c, file.Name, disposition, contentType, strconv.Quote(etag), info.ModTime, content)
 }
 
+// DownloadFile 下载文件的当前版本或 version 指定的历史版本，支持 Range 及条件请求
 func DownloadFile(c *gin.Context) {
 	fileId := c.Param("guid")
 	if fileId == "" {
@@ -132,18 +368,111 @@ func DownloadFile(c *gin.Context) {
 	}
 	file, err := invoker.FileService.GetFileMeta(c, fileId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "get file error: " + err.Error()})
+		c.JSON(fileErrStatus(err), gin.H{"message": "get file error: " + err.Error()})
+		return
+	}
+	// 默认下载当前版本，可通过 version 参数下载历史版本
+	version := file.Version
+	if v := c.Query("version"); v != "" {
+		version, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+	}
+	fileVersion, content, err := invoker.FileService.OpenVersion(c, file, version)
+	if errors.Is(err, dto.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	content, err := invoker.FileService.GetFileContent(c, fileId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "get file content error: " + err.Error()})
 		return
 	}
+	defer content.Close()
 
-	c.Header("Content-Type", file.Type)
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.Name))
-	c.Data(200, file.Type, content)
+	modifyTime := fileVersion.CreateTime
+	if version == file.Version || modifyTime == 0 {
+		modifyTime = file.ModifyTime
+	}
+	// 版本内容写入后不再修改，内容的 SHA-256 加版本号即可唯一标识；没有 SHA-256 的旧版本使用修改时间
+	etag := fmt.Sprintf("%s-%d-%d", fileId, version, modifyTime)
+	if fileVersion.Hash != "" {
+		etag = fmt.Sprintf("%s-%d", fileVersion.Hash, version)
+	}
+	serveContent(c, file.Name, "attachment", fileVersion.Type, strconv.Quote(etag), time.Unix(modifyTime, 0), content)
+}
+
+// serveContent 由 http.ServeContent 处理 Range、If-None-Match、If-Modified-Since 等，返回 206、304 或 416
+func serveContent(c *gin.Context, name string, disposition string, contentType string, etag string, modTime time.Time, content io.ReadSeeker) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", contentDisposition(disposition, name))
+	header.Set("ETag", etag)
+	// 可以缓存，但每次使用前需要验证
+	header.Set("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, name, modTime, content)
+}
+
+// contentDisposition 按 RFC 6266 编码文件名：filename 为替换了非 ASCII 字符的回退名，filename* 为 UTF-8 编码的原名
+func contentDisposition(disposition string, name string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(name) {
+		// RFC 5987 attr-char
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	value := fmt.Sprintf(`%s; filename="%s"`, disposition, fallback.String())
+	if fallback.String() != name {
+		value += "; filename*=UTF-8''" + encoded.String()
+	}
+	return value
+}
+
+func GetFileVersions(c *gin.Context) {
+	fileId := c.Param("guid")
+	versions, err := invoker.FileService.ListVersions(c, fileId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file versions: " + err.Error()})
+		return
+	}
+	for i := range versions {
+		versions[i].ObjectName = ""
+	}
+	invoker.FileService.FillVersionDownloadUrls(versions)
+	c.JSON(200, gin.H{
+		"versions": versions,
+	})
+}
+
+// RestoreFileVersion 恢复到指定版本，生成一个新的版本
+func RestoreFileVersion(c *gin.Context) {
+	fileId := c.Param("guid")
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+	file, err := invoker.FileService.RestoreVersion(c, fileId, version, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin())
+	if errors.Is(err, dto.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to restore file version: " + err.Error()})
+		return
+	}
+	c.JSON(200, file)
 }
 
 func GetPageParams(c *gin.Context) {
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	sqlitestore "aichatoffice/pkg/models/sqlite"
+	"aichatoffice/pkg/server/http/middlewares"
+	blobsvc "aichatoffice/pkg/services/blob"
+	filesvc "aichatoffice/pkg/services/file"
+)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &sqlitestore.SqliteStore{DB: db}
+	if err = st.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	invoker.FileService = filesvc.NewFileService(st, st, st, st, st, st, blobsvc.NewLocalStore(filepath.Join(dir, "blobs")))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	g := r.Group("/showcase")
+	g.GET("/files", GetFiles)
+	g.GET("/files/:guid/versions", GetFileVersions)
+	g.GET("/:guid/download", middlewares.SignedURL(filesvc.SignScopeGet), DownloadFile)
+	return r
+}
+
+func serve(r *gin.Engine, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestDownloadListedFile(t *testing.T) {
+	r := newTestRouter(t)
+	file := dto.FileMeta{Name: "a.txt", FileID: "f1", Ext: ".txt", CreatorId: "u1"}
+	if err := invoker.FileService.UploadFile(context.Background(), &file, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(r, "/showcase/files")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list files = %d %s", w.Code, w.Body)
+	}
+	var list dto.FileList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Files) != 1 || list.Files[0].DownloadUrl == "" {
+		t.Fatalf("list files = %+v, want f1 with download_url", list.Files)
+	}
+	downloadUrl := list.Files[0].DownloadUrl
+
+	w = serve(r, downloadUrl)
+	if body, _ := io.ReadAll(w.Body); w.Code != http.StatusOK || string(body) != "hello" {
+		t.Errorf("download %s = %d %q, want 200 hello", downloadUrl, w.Code, body)
+	}
+
+	unsigned, _, _ := strings.Cut(downloadUrl, "?")
+	if w = serve(r, unsigned); w.Code != http.StatusForbidden {
+		t.Errorf("download without signature = %d, want 403", w.Code)
+	}
+	if w = serve(r, strings.Replace(downloadUrl, "/f1/", "/f2/", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("download other file with f1 signature = %d, want 403", w.Code)
+	}
+}
+
+func TestDownloadListedVersion(t *testing.T) {
+	r := newTestRouter(t)
+	file := dto.FileMeta{Name: "a.txt", FileID: "f1", Ext: ".txt", CreatorId: "u1"}
+	if err := invoker.FileService.UploadFile(context.Background(), &file, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(r, "/showcase/files/f1/versions")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list versions = %d %s", w.Code, w.Body)
+	}
+	var res struct {
+		Versions []dto.FileVersion `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Versions) != 1 || res.Versions[0].DownloadUrl == "" {
+		t.Fatalf("list versions = %+v, want version 1 with downloadUrl", res.Versions)
+	}
+	w = serve(r, res.Versions[0].DownloadUrl)
+	if body, _ := io.ReadAll(w.Body); w.Code != http.StatusOK || string(body) != "hello" {
+		t.Errorf("download version = %d %q, want 200 hello", w.Code, body)
+	}
+}
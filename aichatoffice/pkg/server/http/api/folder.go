@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+)
+
+// GetFolders 列出 parentId 下的子文件夹，parentId 为空时列出根目录
+func GetFolders(c *gin.Context) {
+	folders, err := invoker.FileService.ListFolders(c, c.Query("parentId"))
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to list folders: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, folders)
+}
+
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	ParentId string `json:"parent_id"`
+}
+
+func CreateFolder(c *gin.Context) {
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	folder, err := invoker.FileService.CreateFolder(c, req.Name, req.ParentId, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin())
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to create folder: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// UpdateFolderRequest 为 nil 的字段不修改，parent_id 为空串时移动到根目录
+type UpdateFolderRequest struct {
+	Name     *string `json:"name"`
+	ParentId *string `json:"parent_id"`
+}
+
+// UpdateFolder 重命名或移动文件夹，只能修改自己创建的文件夹，管理员除外
+func UpdateFolder(c *gin.Context) {
+	var req UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	folder, err := invoker.FileService.UpdateFolder(c, c.Param("id"), req.Name, req.ParentId, c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin())
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to update folder: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// DeleteFolder 只能删除自己创建的空文件夹，管理员除外
+func DeleteFolder(c *gin.Context) {
+	if err := invoker.FileService.DeleteFolder(c, c.Param("id"), c.GetString(middlewares.CtxUserGuid), middlewares.CurrentUser(c).IsAdmin()); err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to delete folder: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// fileErrStatus 文件及文件夹操作的错误对应的状态码
+func fileErrStatus(err error) int {
+	switch {
+	case errors.Is(err, dto.ErrInvalidParam):
+		return http.StatusBadRequest
+	case errors.Is(err, dto.ErrTargetFolderNotFoundOrNoPerm):
+		return http.StatusNotFound
+	case errors.Is(err, dto.ErrFolderNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, dto.ErrFileInTrash):
+		return http.StatusGone
+	case errors.Is(err, dto.ErrFileNotInTrash):
+		return http.StatusNotFound
+	case errors.Is(err, dto.ErrFilePermissionDenied):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+)
+
+// ImportArchive 导入表单 file 字段中的 zip 压缩包，folderId 参数指定导入到的文件夹，只能是当前用户创建的文件夹（管理员不限）；
+// 压缩包先暂存到本地临时文件，返回每个条目的导入结果
+func ImportArchive(c *gin.Context) {
+	folderId := c.Query("folderId")
+	userId := c.GetString(middlewares.CtxUserGuid)
+	admin := middlewares.CurrentUser(c).IsAdmin()
+	if folderId != "" {
+		if _, err := invoker.FileService.GetWritableFolder(c, folderId, userId, admin); err != nil {
+			c.JSON(fileErrStatus(err), gin.H{"error": "Failed to get folder: " + err.Error()})
+			return
+		}
+	}
+	limit := invoker.ImportSvc.MaxArchiveSize()
+	if c.Request.ContentLength > limit+multipartOverhead {
+		respondUploadErr(c, dto.ErrFileTooLarge, "")
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from form"})
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from form"})
+			return
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				respondUploadErr(c, err, "")
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"message": "file read failed"})
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		tmp, err := os.CreateTemp("", "import-*.zip")
+		if err != nil {
+			part.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		size, err := io.Copy(tmp, part)
+		part.Close()
+		if err != nil {
+			respondUploadErr(c, err, "file upload failed")
+			return
+		}
+		result, err := invoker.ImportSvc.Import(c, tmp, size, part.FileName(), folderId, userId, admin)
+		if errors.Is(err, dto.ErrImportFile) || errors.Is(err, dto.ErrImportFileMaxChildrenExceed) {
+			apiErr := dto.FromError(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiErr.Code})
+			return
+		}
+		if err != nil {
+			c.JSON(fileErrStatus(err), gin.H{"error": "Failed to import archive: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+}
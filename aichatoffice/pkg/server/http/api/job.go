@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/server/http/middlewares"
+	jobsvc "aichatoffice/pkg/services/job"
+)
+
+// GetJobs 当前用户最近的任务，limit 默认 20，最多 100
+func GetJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	jobs, err := invoker.JobSvc.List(c, c.GetString(middlewares.CtxUserGuid), min(limit, 100))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list jobs: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob 查询任务状态、进度及生成的文件
+func GetJob(c *gin.Context) {
+	job, err := invoker.JobSvc.Get(c, c.GetString(middlewares.CtxUserGuid), c.Param("id"))
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": "Failed to get job: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob 取消等待中或执行中的任务，已结束的任务不变
+func CancelJob(c *gin.Context) {
+	job, err := invoker.JobSvc.Cancel(c, c.GetString(middlewares.CtxUserGuid), c.Param("id"))
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": "Failed to cancel job: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// SubscribeJob 以 SSE 推送任务的变化，先发送当前状态，任务结束后关闭连接
+func SubscribeJob(c *gin.Context) {
+	jobId := c.Param("id")
+	userId := c.GetString(middlewares.CtxUserGuid)
+	// 先订阅再读取当前状态，避免错过两者之间的变化
+	updates, unsubscribe := invoker.JobSvc.Subscribe(jobId)
+	defer unsubscribe()
+	job, err := invoker.JobSvc.Get(c, userId, jobId)
+	if err != nil {
+		c.JSON(jobErrStatus(err), gin.H{"error": "Failed to get job: " + err.Error()})
+		return
+	}
+
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.SSEvent("job", job)
+	c.Writer.Flush()
+	if job.Finished() {
+		return
+	}
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case job := <-updates:
+			c.SSEvent("job", job)
+			return !job.Finished()
+		}
+	})
+}
+
+func jobErrStatus(err error) int {
+	if errors.Is(err, jobsvc.ErrJobNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
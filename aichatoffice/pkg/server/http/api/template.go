@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	chatsvc "aichatoffice/pkg/services/chat"
+	docsvc "aichatoffice/pkg/services/doc"
+	templatesvc "aichatoffice/pkg/services/template"
+)
+
+// CreateTemplate 上传 docx 模板，返回模板中的字段
+func CreateTemplate(c *gin.Context) {
+	if !limitUploadBody(c, multipartOverhead) {
+		return
+	}
+	_file, err := c.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondUploadErr(c, err, "")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from form"})
+		return
+	}
+	if !strings.EqualFold(filepath.Ext(_file.Filename), templatesvc.TemplateExt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only docx templates are supported"})
+		return
+	}
+	file, err := _file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file open failed"})
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file read failed"})
+		return
+	}
+	tpl, err := invoker.TemplateSvc.Create(c, _file.Filename, c.GetString(middlewares.CtxUserGuid), content)
+	if err != nil {
+		c.JSON(templateErrStatus(err), gin.H{"error": "Failed to create template: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+func GetTemplates(c *gin.Context) {
+	templates, err := invoker.TemplateSvc.List(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list templates: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+func GetTemplate(c *gin.Context) {
+	tpl, err := invoker.TemplateSvc.Get(c, c.Param("id"))
+	if err != nil {
+		c.JSON(templateErrStatus(err), gin.H{"error": "Failed to get template: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tpl)
+}
+
+func DeleteTemplate(c *gin.Context) {
+	templateId := c.Param("id")
+	if _, err := invoker.TemplateSvc.Get(c, templateId); err != nil {
+		c.JSON(templateErrStatus(err), gin.H{"error": "Failed to get template: " + err.Error()})
+		return
+	}
+	if err := invoker.TemplateSvc.Delete(c, templateId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// GenerateReportRequest data 为结构化数据；数据中缺少的字段在提供 prompt 或 sourceFileId 时由 ai 填写
+type GenerateReportRequest struct {
+	Name         string                 `json:"name"`
+	Data         map[string]interface{} `json:"data"`
+	Prompt       string                 `json:"prompt"`
+	SourceFileId string                 `json:"sourceFileId"`
+}
+
+// GenerateReport 用模板生成新的 docx 文件，返回文件信息，可直接在 office 预览中打开
+func GenerateReport(c *gin.Context) {
+	var req GenerateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tpl, err := invoker.TemplateSvc.Get(c, c.Param("id"))
+	if err != nil {
+		c.JSON(templateErrStatus(err), gin.H{"error": "Failed to get template: " + err.Error()})
+		return
+	}
+	if req.Data == nil {
+		req.Data = map[string]interface{}{}
+	}
+	userId := c.GetString(middlewares.CtxUserGuid)
+
+	missing := templatesvc.MissingFields(tpl.Fields, req.Data)
+	if len(missing) > 0 && (req.Prompt != "" || req.SourceFileId != "") {
+		opts, release, ok := prepareAi(c, userId)
+		if !ok {
+			return
+		}
+		values, err := invoker.ChatService.FillTemplate(c.Request.Context(), userId, chatsvc.TemplateFill{
+			Fields:       missing,
+			Data:         req.Data,
+			Prompt:       req.Prompt,
+			SourceFileId: req.SourceFileId,
+		}, opts)
+		release()
+		if err != nil {
+			apiErr := dto.FromError(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fill template: " + err.Error(), "code": apiErr.Code})
+			return
+		}
+		for k, v := range values {
+			req.Data[k] = v
+		}
+	}
+
+	content, err := invoker.TemplateSvc.Render(c, tpl, req.Data)
+	if err != nil {
+		c.JSON(templateErrStatus(err), gin.H{"error": "Failed to render template: " + err.Error()})
+		return
+	}
+	name := req.Name
+	if name == "" {
+		name = strings.TrimSuffix(tpl.Name, filepath.Ext(tpl.Name)) + "-" + time.Now().Format("20060102150405")
+	}
+	if !strings.EqualFold(filepath.Ext(name), templatesvc.TemplateExt) {
+		name += templatesvc.TemplateExt
+	}
+	f, err := invoker.DocSvc.CreateFile(c, name, userId, content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save report: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+func templateErrStatus(err error) int {
+	switch {
+	case errors.Is(err, dto.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, docsvc.ErrInvalidTemplate):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
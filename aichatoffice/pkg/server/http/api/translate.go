@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/server/http/middlewares"
+	docsvc "aichatoffice/pkg/services/doc"
+	translatesvc "aichatoffice/pkg/services/translate"
+)
+
+// TranslateFileRequest glossary 为固定译法的术语，译文为空表示保留原文；name 为生成文件的名称
+type TranslateFileRequest struct {
+	TargetLang string            `json:"targetLang" binding:"required"`
+	Glossary   map[string]string `json:"glossary"`
+	Name       string            `json:"name"`
+}
+
+// TranslateFile 创建翻译任务，译文保持原格式并保存为新文件，通过任务接口查询进度及结果
+func TranslateFile(c *gin.Context) {
+	var req TranslateFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userId := c.GetString(middlewares.CtxUserGuid)
+	// 创建任务时检查额度、预算及限流，任务在后台执行，不占用并发名额
+	opts, release, ok := prepareAi(c, userId)
+	if !ok {
+		return
+	}
+	release()
+	job, err := invoker.TranslateSvc.Start(c, userId, translatesvc.Request{
+		FileId:     c.Param("guid"),
+		TargetLang: req.TargetLang,
+		Glossary:   req.Glossary,
+		Name:       req.Name,
+		Trial:      opts.Trial,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, translatesvc.ErrInvalidTargetLang) || errors.Is(err, docsvc.ErrUnsupportedKind) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Failed to start translation: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+)
+
+// GetTrash 分页列出当前用户回收站中的文件，retention 为保留的秒数，文件在 delete_time + retention 后被彻底删除
+func GetTrash(c *gin.Context) {
+	query := dto.FileQuery{
+		Sort: c.Query("sort"),
+		Desc: c.DefaultQuery("order", "desc") != "asc",
+	}
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	list, err := invoker.TrashSvc.List(c, c.GetString(middlewares.CtxUserGuid), query, c.Query("cursor"))
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to list trash: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"files":       list.Files,
+		"total":       list.Total,
+		"next_cursor": list.NextCursor,
+		"retention":   int64(invoker.TrashSvc.Retention().Seconds()),
+	})
+}
+
+func RestoreTrashFile(c *gin.Context) {
+	file, err := invoker.TrashSvc.Restore(c, c.Param("guid"), c.GetString(middlewares.CtxUserGuid))
+	if err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to restore file: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// PurgeTrashFile 彻底删除回收站中的文件，不可恢复
+func PurgeTrashFile(c *gin.Context) {
+	if err := invoker.TrashSvc.Purge(c, c.Param("guid"), c.GetString(middlewares.CtxUserGuid)); err != nil {
+		c.JSON(fileErrStatus(err), gin.H{"error": "Failed to purge file: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EmptyTrash 清空当前用户的回收站
+func EmptyTrash(c *gin.Context) {
+	n, err := invoker.TrashSvc.Empty(c, c.GetString(middlewares.CtxUserGuid))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to empty trash: " + err.Error(), "deleted": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": n})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	filesvc "aichatoffice/pkg/services/file"
+	uploadsvc "aichatoffice/pkg/services/upload"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	// tusContentType PATCH 请求体的类型
+	tusContentType = "application/offset+octet-stream"
+)
+
+// TusResumable 校验 tus 协议版本，OPTIONS 用于查询服务端支持的版本，不校验
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
+
+// TusOptions 返回支持的协议版本、扩展及文件大小上限
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if limit := filesvc.MaxFileSize(); limit > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(limit, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload 创建上传，请求体不为空时同时作为第一段内容（creation-with-upload）
+func CreateUpload(c *gin.Context) {
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Defer-Length is not supported"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Length"})
+		return
+	}
+	userId := c.GetString(middlewares.CtxUserGuid)
+	upload, err := invoker.UploadSvc.Create(c, userId, length, c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		respondTusErr(c, err)
+		return
+	}
+	c.Header("Location", uploadUrl(upload.UploadId))
+	if c.ContentType() == tusContentType && c.Request.ContentLength != 0 && !upload.Completed() {
+		upload, err = invoker.UploadSvc.Append(c, userId, upload.UploadId, 0, c.Request.Body)
+		if err != nil {
+			respondTusErr(c, err)
+			return
+		}
+	}
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// HeadUpload 查询已接收的偏移量，客户端从该位置继续上传
+func HeadUpload(c *gin.Context) {
+	upload, err := invoker.UploadSvc.Get(c, c.GetString(middlewares.CtxUserGuid), c.Param("id"))
+	if err != nil {
+		respondTusErr(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload 从 Upload-Offset 处追加内容，全部接收后登记为文件，文件 id 在 X-File-Id 中返回
+func PatchUpload(c *gin.Context) {
+	if c.ContentType() != tusContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Upload-Offset"})
+		return
+	}
+	upload, err := invoker.UploadSvc.Append(c, c.GetString(middlewares.CtxUserGuid), c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		respondTusErr(c, err)
+		return
+	}
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload 取消上传（termination）
+func DeleteUpload(c *gin.Context) {
+	err := invoker.UploadSvc.Terminate(c, c.GetString(middlewares.CtxUserGuid), c.Param("id"))
+	if err != nil {
+		respondTusErr(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func uploadUrl(uploadId string) string {
+	return fmt.Sprintf("%s/showcase/uploads/%s", econf.GetString("host.downloadUrlPrefix"), uploadId)
+}
+
+func setUploadHeaders(c *gin.Context, upload *dto.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.Completed() {
+		c.Header("X-File-Id", upload.FileId)
+	} else {
+		c.Header("Upload-Expires", time.Unix(upload.ExpireTime, 0).UTC().Format(http.TimeFormat))
+	}
+}
+
+func respondTusErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, uploadsvc.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, uploadsvc.ErrOffsetMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, uploadsvc.ErrUploadBusy):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, uploadsvc.ErrChunkTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, uploadsvc.ErrInvalidLength) || errors.Is(err, uploadsvc.ErrInvalidMetadata):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, dto.ErrFileTooLarge) || errors.Is(err, dto.ErrDiskVolumeExceed):
+		respondUploadErr(c, err, "")
+	default:
+		elog.Error("tus upload failed", zap.Error(err), zap.String("uploadId", c.Param("id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+)
+
+// GetUsage 管理员按 user/day/model/conversation 汇总用量
+func GetUsage(c *gin.Context) {
+	query := dto.UsageQuery{
+		GroupBy: c.DefaultQuery("groupBy", "user"),
+		UserId:  c.Query("userId"),
+		Model:   c.Query("model"),
+		FromDay: c.Query("from"),
+		ToDay:   c.Query("to"),
+	}
+	result, err := invoker.UsageSvc.Aggregate(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMyUsage 当前用户自己的用量及当月预算
+func GetMyUsage(c *gin.Context) {
+	userId := c.GetString(middlewares.CtxUserGuid)
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return
+	}
+	query := dto.UsageQuery{
+		GroupBy: c.DefaultQuery("groupBy", "day"),
+		UserId:  userId,
+		FromDay: c.Query("from"),
+		ToDay:   c.Query("to"),
+	}
+	if query.GroupBy == "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported group by: user"})
+		return
+	}
+	result, err := invoker.UsageSvc.Aggregate(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	budget, err := invoker.UsageSvc.CheckBudget(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"usage":  result,
+		"budget": budget,
+	})
+}
+
+type BudgetRequest struct {
+	MonthlySoft float64 `json:"monthlySoft"`
+	MonthlyHard float64 `json:"monthlyHard"`
+}
+
+// UpdateUserBudget 管理员设置用户月度预算
+func UpdateUserBudget(c *gin.Context) {
+	userId := c.Param("userId")
+	req := BudgetRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkUserExists(c, userId); err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	before, err := invoker.UsageSvc.Budget(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	budget, err := invoker.UsageSvc.SetBudget(c, userId, req.MonthlySoft, req.MonthlyHard)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	formatCost := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionBudgetUpdate, userId, dto.FieldChanges{
+		{Item: userId, Field: "monthlySoft", Old: formatCost(before.MonthlySoft), New: formatCost(budget.MonthlySoft)},
+		{Item: userId, Field: "monthlyHard", Old: formatCost(before.MonthlyHard), New: formatCost(budget.MonthlyHard)},
+	})
+	c.JSON(http.StatusOK, budget)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/server/http/middlewares"
+	usersvc "aichatoffice/pkg/services/user"
+)
+
+type UserRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+func GetCurrentUser(c *gin.Context) {
+	user := middlewares.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func GetUsers(c *gin.Context) {
+	users, err := invoker.UserService.ListUsers(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func CreateUser(c *gin.Context) {
+	req := UserRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = dto.RoleMember
+	}
+	user, token, err := invoker.UserService.CreateUser(c, req.Name, req.Role)
+	if err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionUserCreate, user.UserId, dto.FieldChanges{
+		{Item: user.UserId, Field: "name", New: user.Name},
+		{Item: user.UserId, Field: "role", New: user.Role},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"token": token,
+	})
+}
+
+func UpdateUser(c *gin.Context) {
+	userId := c.Param("userId")
+	req := UserRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, after, err := invoker.UserService.UpdateUser(c, userId, req.Name, req.Role)
+	if err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	changes := dto.FieldChanges{}
+	if before.Name != after.Name {
+		changes = append(changes, dto.FieldChange{Item: userId, Field: "name", Old: before.Name, New: after.Name})
+	}
+	if before.Role != after.Role {
+		changes = append(changes, dto.FieldChange{Item: userId, Field: "role", Old: before.Role, New: after.Role})
+	}
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionUserUpdate, userId, changes)
+	c.JSON(http.StatusOK, after)
+}
+
+func DeleteUser(c *gin.Context) {
+	userId := c.Param("userId")
+	user, err := invoker.UserService.DeleteUser(c, userId)
+	if err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionUserDelete, userId, dto.FieldChanges{
+		{Item: userId, Field: "name", Old: user.Name},
+		{Item: userId, Field: "role", Old: user.Role},
+	})
+	c.Status(http.StatusNoContent)
+}
+
+func ResetUserToken(c *gin.Context) {
+	userId := c.Param("userId")
+	user, token, err := invoker.UserService.ResetToken(c, userId)
+	if err != nil {
+		c.JSON(userErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	invoker.AuditSvc.Record(c, middlewares.CurrentUser(c), dto.AuditActionUserResetToken, userId, dto.FieldChanges{
+		{Item: userId, Field: "token", Secret: true},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"token": token,
+	})
+}
+
+func GetAuditLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	logs, err := invoker.AuditSvc.ListAuditLogs(c, c.Query("action"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// checkUserExists 管理员调整额度等设置的对象只能是已有用户或匿名用户，不为不存在的用户创建记录
+func checkUserExists(c *gin.Context, userId string) error {
+	if userId == dto.AnonymousUserId {
+		return nil
+	}
+	_, err := invoker.UserService.GetUser(c, userId)
+	return err
+}
+
+func userErrStatus(err error) int {
+	switch {
+	case errors.Is(err, usersvc.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usersvc.ErrInvalidRole), errors.Is(err, usersvc.ErrLastAdmin):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
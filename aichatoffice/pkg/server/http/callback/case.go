@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"aichatoffice/pkg/invoker"
@@ -16,9 +17,14 @@ import (
 
 type FileProvider struct{}
 
-func (f *FileProvider) VerifyFile(c *gin.Context, fileId string) (*officesdk.VerifyResponse, error) {
+// sdkUserId 鉴权中间件从 token 中解析出的用户
+func sdkUserId(c *gin.Context) string {
 	_userId, _ := c.Get("userId")
-	userId := fmt.Sprintf("%d", _userId)
+	return fmt.Sprintf("%d", _userId)
+}
+
+func (f *FileProvider) VerifyFile(c *gin.Context, fileId string) (*officesdk.VerifyResponse, error) {
+	userId := sdkUserId(c)
 	return &officesdk.VerifyResponse{
 		CurrentUserInfo: officesdk.UserInfo{
 			ID:    userId,
@@ -47,7 +53,7 @@ func (f *FileProvider) GetFile(c *gin.Context, fileId string) (*officesdk.FileRe
 }
 
 func (f *FileProvider) GetFileDownload(c *gin.Context, fileId string) (*officesdk.DownloadResponse, error) {
-	downloadUrl := invoker.FileService.GetDownloadUrl(fileId)
+	downloadUrl := invoker.FileService.GetDownloadUrl(fileId, 0)
 	elog.Info("GetFileDownload", l.S("downloadUrl", downloadUrl))
 	return &officesdk.DownloadResponse{
 		URL: downloadUrl,
@@ -67,6 +73,19 @@ func (f *FileProvider) GetFileWatermark(c *gin.Context, fileId string) (*offices
 	}, nil
 }
 
+// queryExpiresIn 编辑器通过 expires_in（秒）指定下载地址的有效期，未指定时为 0 即使用默认有效期
+func queryExpiresIn(c *gin.Context) (time.Duration, error) {
+	expS := c.Query("expires_in")
+	if expS == "" {
+		return 0, nil
+	}
+	exp, err := strconv.ParseInt(expS, 10, 64)
+	if err != nil || exp < 0 {
+		return 0, fmt.Errorf("invalid expires_in %q", expS)
+	}
+	return time.Duration(exp) * time.Second, nil
+}
+
 type UploadBody struct {
 	ObjectName  string            `json:"object_name"`
 	ContentType string            `json:"content_type"`
@@ -82,7 +101,7 @@ func (f *FileProvider) GetUploadURL(c *gin.Context, fileId string) (*officesdk.U
 		return nil, fmt.Errorf("parameter parsing error %w", err)
 	}
 
-	url := invoker.FileService.GetUploadPathUrl(fileId, body.ObjectName)
+	url := invoker.FileService.GetUploadPathUrl(fileId, body.ObjectName, 0)
 
 	return &officesdk.UploadURLResponse{
 		URL:    url,
@@ -91,9 +110,6 @@ func (f *FileProvider) GetUploadURL(c *gin.Context, fileId string) (*officesdk.U
 			"Content-Type": body.ContentType,
 			"Content-MD5":  body.Digest["md5"], // 目前只支持md5
 		},
-		Params: map[string]string{
-			"X-Test-Token": "test",
-		},
 		CompletionParams: map[string]string{
 			"test1": "test1",
 			"test2": "test2",
@@ -104,7 +120,6 @@ func (f *FileProvider) GetUploadURL(c *gin.Context, fileId string) (*officesdk.U
 
 // CompleteUpload 上传文件转码完成
 func (f *FileProvider) CompleteUpload(c *gin.Context, fileId string) (*officesdk.UploadCompletionResponse, error) {
-	file, _ := invoker.FileService.GetFileMeta(c, fileId)
 	// 打印请求参数
 	elog.Info("CompleteUpload request params",
 		l.S("file_id", fileId),
@@ -128,6 +143,12 @@ func (f *FileProvider) CompleteUpload(c *gin.Context, fileId string) (*officesdk
 		l.A("headers", requestBody["headers"]),
 		l.A("body", requestBody["body"]),
 	)
+	// 保存的内容作为新版本
+	file, err := invoker.FileService.CommitSdkUpload(c, fileId, c.Query("object_name"), c.Query("content_type"), sdkUserId(c))
+	if err != nil {
+		elog.Error("CompleteUpload commit version failed", l.E(err), l.S("file_id", fileId))
+		return nil, err
+	}
 	return &officesdk.UploadCompletionResponse{
 		ID:         file.ID,
 		Version:    int(file.Version),
@@ -144,17 +165,12 @@ func (f *FileProvider) GetDownloadURL(c *gin.Context, fileId string) (*officesdk
 	if objName == "" {
 		return nil, errors.New("object_name is required")
 	}
-	// expS := c.Query("expires_in")
+	expiresIn, err := queryExpiresIn(c)
+	if err != nil {
+		return nil, err
+	}
 	disposition := c.Query("disposition")
-	// var exp int64
-	// var err error
-	// if expS != "" {
-	// 	exp, err = strconv.ParseInt(expS, 10, 64)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// }
-	url := invoker.FileService.GetDownloadPathUrl(fileId, objName, disposition)
+	url := invoker.FileService.GetDownloadPathUrl(fileId, objName, disposition, expiresIn)
 	elog.Info("GetDownloadUrl", l.S("name", objName), l.S("url", url))
 	return &officesdk.DownloadResponse{
 		URL: url,
@@ -169,7 +185,7 @@ func (f *FileProvider) GetAssetUploadURL(c *gin.Context, fileId string) (*office
 		elog.Error("GetAssetUploadURL body err: ", l.E(err))
 		return nil, fmt.Errorf("parameter parsing error %w", err)
 	}
-	url := invoker.FileService.GetUploadPathUrl(fileId, body.ObjectName)
+	url := invoker.FileService.GetUploadPathUrl(fileId, body.ObjectName, 0)
 
 	return &officesdk.AssetUploadURLResponse{
 		URL:    url,
@@ -178,9 +194,6 @@ func (f *FileProvider) GetAssetUploadURL(c *gin.Context, fileId string) (*office
 			"Content-Type": body.ContentType,
 			"Content-MD5":  body.Digest["md5"], // 目前只支持md5
 		},
-		Params: map[string]string{
-			"X-Test-Token": "test",
-		},
 		CompletionParams: map[string]string{
 			"test1": "test1",
 			"test2": "test2",
@@ -231,17 +244,12 @@ func (f *FileProvider) GetAssetDownloadURL(c *gin.Context, fileId string) (*offi
 	if objName == "" {
 		return nil, errors.New("object_name is required")
 	}
-	// expS := c.Query("expires_in")
+	expiresIn, err := queryExpiresIn(c)
+	if err != nil {
+		return nil, err
+	}
 	disposition := c.Query("disposition")
-	// var exp int64
-	// var err error
-	// if expS != "" {
-	// 	exp, err = strconv.ParseInt(expS, 10, 64)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// }
-	url := invoker.FileService.GetDownloadPathUrl(fileId, objName, disposition)
+	url := invoker.FileService.GetDownloadPathUrl(fileId, objName, disposition, expiresIn)
 	elog.Info("GetAssetDownloadURL", l.S("name", objName), l.S("url", url))
 	return &officesdk.DownloadResponse{
 		URL: url,
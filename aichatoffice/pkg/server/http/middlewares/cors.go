@@ -8,7 +8,8 @@ import (
 
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		preflight := c.Request.Method == "OPTIONS"
+		// tus 客户端也会发送 OPTIONS 查询服务端能力，只有带 Access-Control-Request-Method 的才是预检请求
+		preflight := c.Request.Method == "OPTIONS" && c.Request.Header.Get("Access-Control-Request-Method") != ""
 		origin := c.Request.Header.Get("origin")
 
 		if origin == "" {
@@ -23,14 +24,14 @@ func CORS() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", c.Request.Header.Get("Access-Control-Request-Headers"))
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH, HEAD")
 
 		if preflight {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-File-Name")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-File-Name, Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, X-File-Id, ETag, Accept-Ranges, Content-Range")
 
 		c.Next()
 	}
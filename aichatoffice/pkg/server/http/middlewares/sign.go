@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
+)
+
+// SignedURL 校验 FileService 签发的地址，scope 为地址的用途，签名无效或已过期返回 403
+func SignedURL(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := invoker.FileService.VerifyUrl(scope, c.Param("guid"), c.Request.URL.Query()); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": dto.ErrInvalidSignature.Code})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,11 +1,18 @@
 package middlewares
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+
+	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
 )
 
 const (
 	CtxUserGuid = "ctx_uid"
+	CtxUser     = "ctx_user"
 )
 
 func ChatUser() gin.HandlerFunc {
@@ -15,7 +22,67 @@ func ChatUser() gin.HandlerFunc {
 	}
 }
 
+// getChatUserGuid 只使用 token 认证的用户，未登录的请求为匿名用户，不能由客户端指定身份
 func getChatUserGuid(c *gin.Context) string {
-	//todo
-	return "demo_user"
+	if user := CurrentUser(c); user != nil {
+		return user.UserId
+	}
+	return dto.AnonymousUserId
+}
+
+// User 根据 Authorization: Bearer <token> 识别当前用户；未携带时为匿名请求不拦截，
+// 携带了但格式不对或 token 无效时返回 401，不降级为匿名用户
+func User() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header"})
+			return
+		}
+		user, err := invoker.UserService.Authenticate(c, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.Set(CtxUser, user)
+		c.Next()
+	}
+}
+
+// RequireRole 要求当前用户为指定角色之一，需配合 User 使用
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	}
+}
+
+// CurrentUser 获取当前登录用户，未登录返回 nil
+func CurrentUser(c *gin.Context) *dto.User {
+	v, ok := c.Get(CtxUser)
+	if !ok {
+		return nil
+	}
+	user, _ := v.(*dto.User)
+	return user
 }
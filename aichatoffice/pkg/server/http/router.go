@@ -5,9 +5,11 @@ import (
 	"github.com/officesdk/go-sdk/officesdk"
 
 	"aichatoffice/pkg/invoker"
+	"aichatoffice/pkg/models/dto"
 	"aichatoffice/pkg/server/http/api"
 	"aichatoffice/pkg/server/http/callback"
 	"aichatoffice/pkg/server/http/middlewares"
+	filesvc "aichatoffice/pkg/services/file"
 	"aichatoffice/ui"
 )
 
@@ -16,16 +18,43 @@ func ServeHTTP() *egin.Component {
 	r.Use(middlewares.CORS())
 	apiRouters := r.Group("/showcase")
 	{
+		// 识别当前用户用于记录文件的创建人、修改人，未登录不拦截
+		apiRouters.Use(middlewares.User(), middlewares.ChatUser())
 		// 文件操作
 		apiRouters.GET("/files", api.GetFiles)
 		apiRouters.GET("/files/:guid", api.GetFile)
+		apiRouters.PATCH("/files/:guid", api.UpdateFile)
+		apiRouters.PUT("/files/:guid/tags", api.SetFileTags)
+		apiRouters.GET("/tags", api.GetTags)
+		apiRouters.GET("/files/:guid/versions", api.GetFileVersions)
+		apiRouters.POST("/files/:guid/versions/:version/restore", api.RestoreFileVersion)
 		apiRouters.DELETE("/file/:guid", api.DeleteFile)
 		apiRouters.POST("/file", api.UploadFile)
-		apiRouters.GET("/:guid/download", api.DownloadFile)
+		apiRouters.POST("/import", api.ImportArchive)
+		apiRouters.GET("/:guid/download", middlewares.SignedURL(filesvc.SignScopeGet), api.DownloadFile)
 		apiRouters.GET("/:guid/page", api.GetPageParams)
+		// 回收站
+		apiRouters.GET("/trash", api.GetTrash)
+		apiRouters.DELETE("/trash", api.EmptyTrash)
+		apiRouters.POST("/trash/:guid/restore", api.RestoreTrashFile)
+		apiRouters.DELETE("/trash/:guid", api.PurgeTrashFile)
+		// 文件夹
+		apiRouters.GET("/folders", api.GetFolders)
+		apiRouters.POST("/folders", api.CreateFolder)
+		apiRouters.PATCH("/folders/:id", api.UpdateFolder)
+		apiRouters.DELETE("/folders/:id", api.DeleteFolder)
 
-		apiRouters.PUT("/:guid/upload/path", api.UploadPathFile)
-		apiRouters.GET("/:guid/download/path", api.DownloadPathFile)
+		// 编辑器及下载链接使用的签名地址
+		apiRouters.PUT("/:guid/upload/path", middlewares.SignedURL(filesvc.SignScopePut), api.UploadPathFile)
+		apiRouters.GET("/:guid/download/path", middlewares.SignedURL(filesvc.SignScopeGet), api.DownloadPathFile)
+
+		// 断点续传（tus 1.0）
+		uploadRouters := apiRouters.Group("/uploads", api.TusResumable())
+		uploadRouters.OPTIONS("", api.TusOptions)
+		uploadRouters.POST("", api.CreateUpload)
+		uploadRouters.HEAD("/:id", api.HeadUpload)
+		uploadRouters.PATCH("/:id", api.PatchUpload)
+		uploadRouters.DELETE("/:id", api.DeleteUpload)
 	}
 
 	// 为 officesdk 添加鉴权中间件
@@ -39,6 +68,8 @@ func ServeHTTP() *egin.Component {
 
 	// ai-chat路由
 	apiGroup := r.Group("/api")
+	apiGroup.Use(middlewares.User())
+	apiGroup.GET("/user", api.GetCurrentUser)
 	// chatRouters := apiGroup.Group("/chat")
 	// {
 	// 	chatRouters.Use(middlewares.ChatUser())
@@ -55,13 +86,64 @@ func ServeHTTP() *egin.Component {
 		chatRouters.GET("/:fileId/conversation", api.GetConversation)
 		chatRouters.POST("/:conversation_id/chat", api.Completions)
 	}
+	apiGroup.GET("/quota", middlewares.ChatUser(), api.GetQuota)
+	apiGroup.GET("/storage", middlewares.ChatUser(), api.GetStorage)
+	apiGroup.GET("/usage/me", middlewares.ChatUser(), api.GetMyUsage)
+	apiGroup.GET("/limits", middlewares.ChatUser(), api.GetLimits)
+	apiGroup.GET("/files/:guid/diff", middlewares.ChatUser(), api.DiffFile)
+	apiGroup.POST("/files/:guid/charts", middlewares.ChatUser(), api.CreateChart)
+	apiGroup.POST("/decks", middlewares.ChatUser(), api.GenerateDeck)
+	apiGroup.POST("/files/:guid/translations", middlewares.ChatUser(), api.TranslateFile)
+
+	// 后台任务
+	jobRouters := apiGroup.Group("/jobs")
+	{
+		jobRouters.Use(middlewares.ChatUser())
+		jobRouters.GET("", api.GetJobs)
+		jobRouters.GET("/:id", api.GetJob)
+		jobRouters.GET("/:id/events", api.SubscribeJob)
+		jobRouters.POST("/:id/cancel", api.CancelJob)
+	}
+
+	// 报告模板
+	templateRouters := apiGroup.Group("/templates")
+	{
+		templateRouters.Use(middlewares.ChatUser())
+		templateRouters.GET("", api.GetTemplates)
+		templateRouters.POST("", api.CreateTemplate)
+		templateRouters.GET("/:id", api.GetTemplate)
+		templateRouters.DELETE("/:id", api.DeleteTemplate)
+		templateRouters.POST("/:id/generate", api.GenerateReport)
+	}
 
+	// 以下为管理员接口
 	aiRouters := apiGroup.Group("/ai")
 	{
+		aiRouters.Use(middlewares.RequireRole(dto.RoleAdmin))
 		aiRouters.GET("/config", api.GetAIConfig)
 		aiRouters.POST("/config", api.UpdateAIConfig)
 	}
 
+	userRouters := apiGroup.Group("/users")
+	{
+		userRouters.Use(middlewares.RequireRole(dto.RoleAdmin))
+		userRouters.GET("", api.GetUsers)
+		userRouters.POST("", api.CreateUser)
+		userRouters.PUT("/:userId", api.UpdateUser)
+		userRouters.DELETE("/:userId", api.DeleteUser)
+		userRouters.POST("/:userId/token", api.ResetUserToken)
+		userRouters.PUT("/:userId/quota", api.UpdateUserQuota)
+		userRouters.PUT("/:userId/budget", api.UpdateUserBudget)
+		userRouters.PUT("/:userId/storage", api.UpdateUserStorage)
+	}
+
+	adminRouters := apiGroup.Group("/admin")
+	{
+		adminRouters.Use(middlewares.RequireRole(dto.RoleAdmin))
+		adminRouters.GET("/audit", api.GetAuditLogs)
+		adminRouters.GET("/usage", api.GetUsage)
+	}
+
 	r.Use(middlewares.Serve("/", middlewares.EmbedFolder(ui.WebUI, "dist"), false))
 	r.Use(middlewares.Serve("/", middlewares.FallbackFileSystem(middlewares.EmbedFolder(ui.WebUI, "dist")), true))
 	return r
@@ -4,6 +4,8 @@ import (
 	"aichatoffice/pkg/models/dto"
 	"aichatoffice/pkg/models/store"
 	"context"
+	"fmt"
+	"strconv"
 )
 
 type AiConfigSvc struct {
@@ -23,3 +25,44 @@ func (s *AiConfigSvc) GetAIConfig(ctx context.Context) ([]dto.AiConfig, error) {
 func (s *AiConfigSvc) UpdateAIConfig(ctx context.Context, aiConfig []dto.AiConfig) error {
 	return s.store.UpdateAIConfig(ctx, aiConfig)
 }
+
+// DiffAIConfig 按顺序比较新旧配置，返回变更字段
+// Token 属于密钥，只标记是否变化，不记录值
+func DiffAIConfig(before []dto.AiConfig, after []dto.AiConfig) dto.FieldChanges {
+	changes := dto.FieldChanges{}
+	n := len(before)
+	if len(after) > n {
+		n = len(after)
+	}
+	for i := 0; i < n; i++ {
+		var b, a dto.AiConfig
+		if i < len(before) {
+			b = before[i]
+		}
+		if i < len(after) {
+			a = after[i]
+		}
+		item := a.Name
+		if item == "" {
+			item = b.Name
+		}
+		item = fmt.Sprintf("#%d %s", i, item)
+
+		diff := func(field string, old string, new string) {
+			if old != new {
+				changes = append(changes, dto.FieldChange{Item: item, Field: field, Old: old, New: new})
+			}
+		}
+		diff("name", b.Name, a.Name)
+		diff("baseUrl", b.BaseUrl, a.BaseUrl)
+		diff("textModel", b.TextModel, a.TextModel)
+		diff("proxyUrl", b.ProxyUrl, a.ProxyUrl)
+		diff("subservice", b.Subservice, a.Subservice)
+		diff("inputMaxToken", strconv.Itoa(b.InputMaxToken), strconv.Itoa(a.InputMaxToken))
+		diff("outputMaxToken", strconv.Itoa(b.OutputMaxToken), strconv.Itoa(a.OutputMaxToken))
+		if b.Token != a.Token {
+			changes = append(changes, dto.FieldChange{Item: item, Field: "token", Secret: true})
+		}
+	}
+	return changes
+}
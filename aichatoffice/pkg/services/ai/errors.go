@@ -0,0 +1,188 @@
+package aisvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/sashabaranov/go-openai"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+// ErrorKind 上游错误分类
+type ErrorKind string
+
+const (
+	ErrorKindAuth          ErrorKind = "auth"
+	ErrorKindRateLimit     ErrorKind = "rate_limit"
+	ErrorKindContextLength ErrorKind = "context_length"
+	ErrorKindMaxTokens     ErrorKind = "max_tokens"
+	ErrorKindContentFilter ErrorKind = "content_filter"
+	ErrorKindNetwork       ErrorKind = "network"
+	ErrorKindServer        ErrorKind = "server"
+	ErrorKindUnknown       ErrorKind = "unknown"
+)
+
+// UpstreamError 调用模型服务失败，Kind 决定是否重试及返回给前端的错误码
+type UpstreamError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("ai upstream %s error: %v", e.Kind, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 限流、网络及服务端错误可以重试
+func (e *UpstreamError) Retryable() bool {
+	switch e.Kind {
+	case ErrorKindRateLimit, ErrorKindNetwork, ErrorKindServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// ApiError 转成前端可识别的错误码
+func (e *UpstreamError) ApiError() *dto.ApiError {
+	switch e.Kind {
+	case ErrorKindAuth:
+		return dto.ErrAiAuth
+	case ErrorKindRateLimit:
+		return dto.ErrAiRateLimit
+	case ErrorKindContextLength:
+		return dto.ErrPromptTooLong
+	case ErrorKindMaxTokens:
+		return dto.ErrMaxTokenExceed
+	case ErrorKindContentFilter:
+		return dto.ErrAiContentFilter
+	case ErrorKindNetwork:
+		return dto.ErrAiNetwork
+	case ErrorKindServer:
+		return dto.ErrAiServer
+	default:
+		return dto.ErrAiChat
+	}
+}
+
+// ClassifyError 对 go-openai 返回的错误进行分类
+func ClassifyError(err error) *UpstreamError {
+	if err == nil {
+		return nil
+	}
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr
+	}
+	e := &UpstreamError{Kind: ErrorKindUnknown, Err: err}
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		e.StatusCode = apiErr.HTTPStatusCode
+		e.Kind = classifyAPIError(apiErr)
+	case errors.As(err, &reqErr):
+		e.StatusCode = reqErr.HTTPStatusCode
+		e.Kind = classifyStatus(reqErr.HTTPStatusCode)
+		if e.Kind == ErrorKindUnknown && reqErr.Err != nil && isNetworkError(reqErr.Err) {
+			e.Kind = ErrorKindNetwork
+		}
+	case isNetworkError(err):
+		e.Kind = ErrorKindNetwork
+	}
+	return e
+}
+
+func classifyAPIError(apiErr *openai.APIError) ErrorKind {
+	code := strings.ToLower(fmt.Sprint(apiErr.Code))
+	message := strings.ToLower(apiErr.Message)
+	switch {
+	case code == "context_length_exceeded" || strings.Contains(message, "maximum context length") || strings.Contains(message, "context length"):
+		return ErrorKindContextLength
+	case strings.Contains(message, "max_tokens") || strings.Contains(message, "max_completion_tokens"):
+		return ErrorKindMaxTokens
+	case code == "content_filter" || code == "content_policy_violation" ||
+		(apiErr.InnerError != nil && apiErr.InnerError.Code == "ResponsibleAIPolicyViolation"):
+		return ErrorKindContentFilter
+	case code == "insufficient_quota" || code == "invalid_api_key":
+		// 余额不足重试也没用，按鉴权问题处理，提示检查 key
+		return ErrorKindAuth
+	}
+	return classifyStatus(apiErr.HTTPStatusCode)
+}
+
+func classifyStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorKindAuth
+	case status == http.StatusTooManyRequests:
+		return ErrorKindRateLimit
+	case status == http.StatusRequestTimeout:
+		return ErrorKindNetwork
+	case status >= http.StatusInternalServerError:
+		return ErrorKindServer
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryPolicy 首字节返回前的重试策略，退避时间为带抖动的指数退避
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func retryPolicyFromConfig() RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: econf.GetInt("ai.retry.maxAttempts"),
+		BaseDelay:   econf.GetDuration("ai.retry.baseDelay"),
+		MaxDelay:    econf.GetDuration("ai.retry.maxDelay"),
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 500 * time.Millisecond
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = 8 * time.Second
+	}
+	return policy
+}
+
+// Backoff 第 attempt 次（从 0 开始）失败后的等待时间，使用 full jitter
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if attempt < 30 {
+		if d := p.BaseDelay << attempt; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
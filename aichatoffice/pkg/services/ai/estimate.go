@@ -0,0 +1,49 @@
+package aisvc
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Add 累加用量
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + o.PromptTokens,
+		CompletionTokens: u.CompletionTokens + o.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens + o.ReasoningTokens,
+		TotalTokens:      u.TotalTokens + o.TotalTokens,
+	}
+}
+
+// EstimateTokens 粗略估算文本的 token 数：ASCII 约 4 个字符一个 token，其他字符（如中文）每个字符一个 token
+func EstimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// estimateUsage 流被中断、服务方没有返回 usage 时，按请求及已生成的内容估算服务方已计费的用量
+func estimateUsage(req openai.ChatCompletionRequest, content string, toolCalls []ToolCall) Usage {
+	var generated strings.Builder
+	generated.WriteString(content)
+	for _, tc := range toolCalls {
+		generated.WriteString(tc.Name + tc.Arguments)
+	}
+	u := Usage{CompletionTokens: EstimateTokens(generated.String())}
+	for _, m := range req.Messages {
+		u.PromptTokens += EstimateTokens(m.Content)
+		for _, tc := range m.ToolCalls {
+			u.PromptTokens += EstimateTokens(tc.Function.Name) + EstimateTokens(tc.Function.Arguments)
+		}
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
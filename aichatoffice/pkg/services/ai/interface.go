@@ -1,11 +1,84 @@
 package aisvc
 
-import "aichatoffice/pkg/utils"
+import (
+	"context"
+	"time"
+
+	"aichatoffice/pkg/utils"
+)
+
+// Usage 一次调用消耗的 token
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	ReasoningTokens  int `json:"reasoningTokens"` // 已包含在 CompletionTokens 中
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Completion 一次调用的结果信息，用于计费统计
+type Completion struct {
+	Model        string        `json:"model"`
+	FinishReason string        `json:"finishReason"`
+	Usage        Usage         `json:"usage"`
+	Latency      time.Duration `json:"latency"`
+}
+
+// ToolCall 模型发起的工具调用，Arguments 为 JSON 字符串
+type ToolCall struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool 提供给模型的工具定义，Parameters 为 JSON Schema
+type Tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  interface{} `json:"parameters"`
+}
+
+// Message 多轮对话中的一条消息，工具结果使用 tool 角色并带上 ToolCallId
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+	ToolCallId string     `json:"toolCallId,omitempty"`
+}
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// ChatRequest 多轮对话请求
+type ChatRequest struct {
+	Messages []Message
+	Tools    []Tool
+}
+
+// ChatResult 一次调用的结果，模型要求调用工具时 ToolCalls 不为空
+type ChatResult struct {
+	Completion
+	Content   string
+	ToolCalls []ToolCall
+}
 
 // todo
 type AiSvc interface {
 	// Completions(ctx context.Context, req []ChatObj) (*dto.TextResponse, error)
-	CompletionsStream(chatInput string, event *utils.TeeWriter)
+	CompletionsStream(ctx context.Context, chatInput string, event *utils.TeeWriter) (Completion, error)
+	// ChatStream 多轮对话，支持工具调用，文本增量写入 event
+	ChatStream(ctx context.Context, req ChatRequest, event *utils.TeeWriter) (ChatResult, error)
+	// Model 当前使用的模型
+	Model() string
+	// WithModel 使用同一配置下的另一个模型，例如超出预算后降级
+	WithModel(model string) AiSvc
+	// Provider 服务提供方标识，用于并发限制
+	Provider() string
+	// KeyId API Key 的摘要，用于按 key 限流，不暴露明文
+	KeyId() string
 	// ChatStream(ctx context.Context, uid string, system string, reqMessages []dto.ChatMessage, messageId string, msgEvent chan<- dto.ChatMessage) error
 	// Image(ctx context.Context, req *dto.ImageRequest) (*dto.ImageResponse, error)
 }
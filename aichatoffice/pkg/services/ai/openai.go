@@ -2,20 +2,28 @@ package aisvc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gotomicro/cetus/l"
 	"github.com/gotomicro/ego/core/elog"
 	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 
+	"aichatoffice/pkg/models/dto"
 	"aichatoffice/pkg/utils"
 )
 
 type OpenAISvc struct {
 	client *openai.Client
+	retry  RetryPolicy
 	OpenAiConfig
 }
 
@@ -59,9 +67,14 @@ func NewOpenAI(configSvc *AiConfigSvc) (OpenAISvc, error) {
 
 	elog.Info("final ai config", l.A("aiConfig", aiConfig))
 
+	return NewOpenAIWithConfig(aiConfig), nil
+}
+
+// NewOpenAIWithConfig 直接使用给定配置，例如试用额度使用的独立配置
+func NewOpenAIWithConfig(aiConfig OpenAiConfig) OpenAISvc {
 	openAIManager := OpenAISvc{}
 	openAIManager.LoadConfig(aiConfig)
-	return openAIManager, nil
+	return openAIManager
 }
 
 func (o *OpenAISvc) LoadConfig(aiConfig OpenAiConfig) {
@@ -78,39 +91,193 @@ func (o *OpenAISvc) LoadConfig(aiConfig OpenAiConfig) {
 	}
 	goopenaiConfig.BaseURL = o.OpenAiConfig.BaseUrl
 	o.client = openai.NewClientWithConfig(goopenaiConfig)
+	o.retry = retryPolicyFromConfig()
 }
 
-func (o OpenAISvc) CompletionsStream(chatInput string, event *utils.TeeWriter) {
-	streamResp, err := o.client.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
-		Model: o.OpenAiConfig.TextModel,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: chatInput,
-			},
-		},
-	})
+func (o OpenAISvc) Model() string {
+	return o.OpenAiConfig.TextModel
+}
+
+func (o OpenAISvc) WithModel(model string) AiSvc {
+	o.OpenAiConfig.TextModel = model
+	return o
+}
+
+func (o OpenAISvc) Provider() string {
+	if o.OpenAiConfig.BaseUrl == "" {
+		return "openai"
+	}
+	return o.OpenAiConfig.BaseUrl
+}
+
+func (o OpenAISvc) KeyId() string {
+	if o.OpenAiConfig.Token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(o.OpenAiConfig.Token))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (o OpenAISvc) CompletionsStream(ctx context.Context, chatInput string, event *utils.TeeWriter) (Completion, error) {
+	res, err := o.ChatStream(ctx, ChatRequest{
+		Messages: []Message{{Role: RoleUser, Content: chatInput}},
+	}, event)
+	return res.Completion, err
+}
+
+func (o OpenAISvc) ChatStream(ctx context.Context, chatReq ChatRequest, event *utils.TeeWriter) (res ChatResult, err error) {
+	res.Model = o.OpenAiConfig.TextModel
+	if o.client == nil {
+		return res, dto.ErrAiNotConfigured
+	}
+	start := time.Now()
+	defer func() {
+		res.Latency = time.Since(start)
+	}()
+	req := openai.ChatCompletionRequest{
+		Model:    o.OpenAiConfig.TextModel,
+		Messages: toOpenAIMessages(chatReq.Messages),
+		Tools:    toOpenAITools(chatReq.Tools),
+		// 最后一个 chunk 带上 usage，用于额度及费用统计
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+
+	// 只在还没有输出任何内容前重试，避免前端收到重复内容；失败的尝试已计费的用量计入结果
+	var failed Usage
+	for attempt := 0; ; attempt++ {
+		written := false
+		res, written, err = o.streamOnce(ctx, req, event)
+		res.Usage = failed.Add(res.Usage)
+		if err == nil {
+			return res, nil
+		}
+		upstreamErr := ClassifyError(err)
+		if written || !upstreamErr.Retryable() || attempt+1 >= o.retry.MaxAttempts || ctx.Err() != nil {
+			elog.Error("completions stream failed", zap.Error(err), l.S("kind", string(upstreamErr.Kind)), l.I("attempt", attempt+1))
+			return res, upstreamErr
+		}
+		failed = res.Usage
+		wait := o.retry.Backoff(attempt)
+		elog.Warn("completions stream retry", zap.Error(err), l.S("kind", string(upstreamErr.Kind)), l.I("attempt", attempt+1), l.D("wait", wait))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return res, ctx.Err()
+		}
+	}
+}
+
+// streamOnce 发起一次流式请求，written 表示是否已向前端输出内容
+func (o OpenAISvc) streamOnce(ctx context.Context, req openai.ChatCompletionRequest, event *utils.TeeWriter) (res ChatResult, written bool, err error) {
+	res.Model = req.Model
+	streamResp, err := o.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
-		elog.Error("create chat completion", zap.Error(err), l.A("chatInput", chatInput))
-		return
+		return res, false, err
 	}
 	defer streamResp.Close()
 
+	var content strings.Builder
+	// 请求已发出，服务方已开始计费；流被中断或没有返回 usage 时按已生成的内容估算
+	defer func() {
+		if res.Usage.TotalTokens == 0 {
+			res.Usage = estimateUsage(req, content.String(), res.ToolCalls)
+			elog.Warn("no usage returned, estimated", l.I("totalTokens", res.Usage.TotalTokens), zap.Error(err))
+		}
+	}()
 	for {
 		chunk, err := streamResp.Recv()
-		if err != nil {
-			// todo 错误处理
-			elog.Error("recv", zap.Error(err))
+		if errors.Is(err, io.EOF) {
 			break
 		}
+		if err != nil {
+			return res, written, err
+		}
 
-		if chunk.Choices[0].FinishReason == "stop" {
-			// todo 结束处理
-			break
+		if chunk.Usage != nil {
+			res.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+			if chunk.Usage.CompletionTokensDetails != nil {
+				res.Usage.ReasoningTokens = chunk.Usage.CompletionTokensDetails.ReasoningTokens
+			}
+		}
+		// usage chunk 没有 choices
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			res.FinishReason = string(chunk.Choices[0].FinishReason)
+		}
+		// 工具调用的参数分多个 chunk 返回，按 index 拼接
+		for _, delta := range chunk.Choices[0].Delta.ToolCalls {
+			idx := len(res.ToolCalls) - 1
+			if delta.Index != nil {
+				idx = *delta.Index
+			} else if delta.ID != "" || idx < 0 {
+				// 部分兼容服务不返回 index，出现新的 id 即视为新的调用
+				idx = len(res.ToolCalls)
+			}
+			for idx >= len(res.ToolCalls) {
+				res.ToolCalls = append(res.ToolCalls, ToolCall{})
+			}
+			if delta.ID != "" {
+				res.ToolCalls[idx].Id = delta.ID
+			}
+			if delta.Function.Name != "" {
+				res.ToolCalls[idx].Name = delta.Function.Name
+			}
+			res.ToolCalls[idx].Arguments += delta.Function.Arguments
 		}
 
 		if chunk.Choices[0].Delta.Content != "" {
+			written = true
+			content.WriteString(chunk.Choices[0].Delta.Content)
 			event.Write([]byte(chunk.Choices[0].Delta.Content))
 		}
 	}
+	res.Content = content.String()
+	return res, written, nil
+}
+
+func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessage {
+	res := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCallID: m.ToolCallId,
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:   tc.Id,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      tc.Name,
+					Arguments: tc.Arguments,
+				},
+			})
+		}
+		res = append(res, msg)
+	}
+	return res
+}
+
+func toOpenAITools(tools []Tool) []openai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	res := make([]openai.Tool, 0, len(tools))
+	for _, t := range tools {
+		res = append(res, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return res
 }
@@ -0,0 +1,44 @@
+package auditsvc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/cetus/l"
+	"github.com/gotomicro/ego/core/elog"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+)
+
+type AuditSvc struct {
+	store store.AuditStore
+}
+
+func NewAuditSvc(s store.AuditStore) *AuditSvc {
+	return &AuditSvc{
+		store: s,
+	}
+}
+
+// Record 记录一条审计日志，失败只打日志，不影响业务
+func (s *AuditSvc) Record(ctx context.Context, user *dto.User, action string, target string, changes dto.FieldChanges) {
+	log := dto.AuditLog{
+		Action:     action,
+		Target:     target,
+		Changes:    changes,
+		CreateTime: time.Now().Unix(),
+	}
+	if user != nil {
+		log.UserId = user.UserId
+		log.UserName = user.Name
+	}
+	err := s.store.AddAuditLog(ctx, log)
+	if err != nil {
+		elog.Error("add audit log failed", l.E(err), l.S("action", action), l.S("target", target))
+	}
+}
+
+func (s *AuditSvc) ListAuditLogs(ctx context.Context, action string, limit int, offset int) ([]dto.AuditLog, error) {
+	return s.store.ListAuditLogs(ctx, action, limit, offset)
+}
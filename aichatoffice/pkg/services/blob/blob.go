@@ -0,0 +1,90 @@
+package blobsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+)
+
+var (
+	ErrNotFound            = errors.New("blob not found")
+	ErrPresignNotSupported = errors.New("presigned url not supported")
+)
+
+// ObjectInfo 对象的元数据，本地存储没有 ETag 及 ContentType
+type ObjectInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+}
+
+// BlobStore 文件内容的存储，key 为以 / 分隔的相对路径，例如 <fileId>/versions/1.docx
+type BlobStore interface {
+	// Put 写入对象，size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭；对象不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// GetRange 读取从 offset 开始的 length 个字节，length < 0 时读到末尾
+	GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 按 key 顺序返回以 prefix 开头的所有对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignedURL 生成可直接访问对象的临时地址，method 为 GET 或 PUT
+	PresignedURL(ctx context.Context, method string, key string, expires time.Duration) (string, error)
+}
+
+// NewBlobStoreFromConfig 根据 blob.type 创建存储，默认使用本地目录
+func NewBlobStoreFromConfig() (BlobStore, error) {
+	switch econf.GetString("blob.type") {
+	case "", "local":
+		root := econf.GetString("blob.local.root")
+		if root == "" {
+			root = econf.GetString("case.filepath")
+		}
+		return NewLocalStore(root), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  econf.GetString("blob.s3.endpoint"),
+			Region:    econf.GetString("blob.s3.region"),
+			Bucket:    econf.GetString("blob.s3.bucket"),
+			AccessKey: econf.GetString("blob.s3.accessKey"),
+			SecretKey: econf.GetString("blob.s3.secretKey"),
+			PathStyle: econf.GetBool("blob.s3.pathStyle"),
+			Prefix:    econf.GetString("blob.s3.prefix"),
+		})
+	default:
+		return nil, fmt.Errorf("blob type %s not supported", econf.GetString("blob.type"))
+	}
+}
+
+// ReadAll 读取整个对象
+func ReadAll(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	rc, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// DeletePrefix 删除以 prefix 开头的所有对象
+func DeletePrefix(ctx context.Context, store BlobStore, prefix string) error {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := store.Delete(ctx, o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
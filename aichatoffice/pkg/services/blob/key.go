@@ -0,0 +1,81 @@
+package blobsvc
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxKeyLength 与 S3 的 key 长度上限一致
+const maxKeyLength = 1024
+
+var (
+	ErrInvalidKey     = errors.New("invalid blob key")
+	ErrInvalidDigest  = errors.New("invalid content md5")
+	ErrDigestMismatch = errors.New("content md5 mismatch")
+)
+
+// ValidateKey 校验 key：以 / 分隔的相对路径，不能为空，不能包含空段、. 或 ..、以 . 开头的段（本地存储的临时文件）、
+// 反斜杠及控制字符
+func ValidateKey(key string) error {
+	if key == "" || len(key) > maxKeyLength || !utf8.ValidString(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	if strings.ContainsRune(key, '\\') || strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || strings.HasPrefix(seg, ".") {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// validatePrefix 校验 List 等使用的前缀，允许为空或以 / 结尾
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	return ValidateKey(strings.TrimSuffix(prefix, "/"))
+}
+
+// MD5Reader 边读边计算 MD5，读到结尾时与期望值不一致则返回 ErrDigestMismatch，
+// 存储因读取失败放弃写入，不会留下内容不完整的对象
+type MD5Reader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected []byte
+	mismatch bool
+}
+
+// NewMD5Reader contentMD5 为 Content-MD5 头的值，即 MD5 的 base64 编码
+func NewMD5Reader(r io.Reader, contentMD5 string) (*MD5Reader, error) {
+	expected, err := base64.StdEncoding.DecodeString(contentMD5)
+	if err != nil || len(expected) != md5.Size {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDigest, contentMD5)
+	}
+	return &MD5Reader{r: r, hash: md5.New(), expected: expected}, nil
+}
+
+func (m *MD5Reader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) && !bytes.Equal(m.hash.Sum(nil), m.expected) {
+		m.mismatch = true
+		return n, ErrDigestMismatch
+	}
+	return n, err
+}
+
+// Mismatch 读取结束时内容与期望的 MD5 不一致；存储返回的错误可能经过包装，以此为准
+func (m *MD5Reader) Mismatch() bool {
+	return m.mismatch
+}
@@ -0,0 +1,202 @@
+package blobsvc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var keyTests = []struct {
+	name  string
+	key   string
+	valid bool
+}{
+	{"plain", "f1/versions/1.docx", true},
+	{"unicode", "文件/报告 2024.docx", true},
+	{"percent encoded dots stay literal", "%2e%2e/a", true},
+	{"dots inside segment", "a/b..c/d.txt", true},
+	{"max length", strings.Repeat("a", maxKeyLength), true},
+	{"empty", "", false},
+	{"overlong", strings.Repeat("a", maxKeyLength+1), false},
+	{"parent", "..", false},
+	{"parent prefix", "../etc/passwd", false},
+	{"parent in middle", "a/../../b", false},
+	{"parent suffix", "a/..", false},
+	{"current dir", "./a", false},
+	{"hidden segment", "a/.tmp", false},
+	{"absolute", "/etc/passwd", false},
+	{"trailing slash", "a/", false},
+	{"empty segment", "a//b", false},
+	{"backslash", `a\b`, false},
+	{"backslash traversal", `..\..\windows\win.ini`, false},
+	{"windows drive", `C:\boot.ini`, false},
+	{"nul", "a\x00.txt", false},
+	{"newline", "a\nb", false},
+	{"tab", "a\tb", false},
+	{"del", "a\x7fb", false},
+	{"c1 control", "a\u0085b", false},
+	{"invalid utf-8", "a\xffb", false},
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, tt := range keyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKey(tt.key)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateKey(%q) = %v, want nil", tt.key, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("ValidateKey(%q) = %v, want ErrInvalidKey", tt.key, err)
+			}
+		})
+	}
+}
+
+func TestValidatePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		valid  bool
+	}{
+		{"", true},
+		{"f1/", true},
+		{"f1/content", true},
+		{"/", false},
+		{"../", false},
+		{"f1//", false},
+		{`f1\`, false},
+	}
+	for _, tt := range tests {
+		if err := validatePrefix(tt.prefix); (err == nil) != tt.valid {
+			t.Errorf("validatePrefix(%q) = %v, want valid %v", tt.prefix, err, tt.valid)
+		}
+	}
+}
+
+func TestLocalStorePath(t *testing.T) {
+	root := t.TempDir()
+	s := NewLocalStore(root)
+	for _, tt := range keyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := s.path(tt.key)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("path(%q) = %q, %v, want ErrInvalidKey", tt.key, p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("path(%q) = %v", tt.key, err)
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil || !filepath.IsLocal(rel) || filepath.ToSlash(rel) != tt.key {
+				t.Errorf("path(%q) = %q, want %q under %q", tt.key, p, tt.key, root)
+			}
+		})
+	}
+}
+
+// TestLocalStoreRejectsHostileKeys 非法 key 不能在 root 之外读写
+func TestLocalStoreRejectsHostileKeys(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewLocalStore(root)
+	ctx := context.Background()
+	for _, key := range []string{"../secret.txt", outside, `..\secret.txt`, "a/../../secret.txt"} {
+		if _, _, err := s.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("get %q: %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q: %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("delete %q: %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "secret" {
+		t.Errorf("file outside root changed: %q", data)
+	}
+}
+
+func contentMD5(s string) string {
+	sum := md5.Sum([]byte(s))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestMD5Reader(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		digest   string
+		wantErr  error
+		mismatch bool
+	}{
+		{"match", "hello", contentMD5("hello"), nil, false},
+		{"empty content", "", contentMD5(""), nil, false},
+		{"mismatch", "hello", contentMD5("hellO"), ErrDigestMismatch, true},
+		{"truncated content", "hell", contentMD5("hello"), ErrDigestMismatch, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewMD5Reader(iotest.OneByteReader(strings.NewReader(tt.content)), tt.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("read error = %v, want %v", err, tt.wantErr)
+			}
+			if string(data) != tt.content {
+				t.Errorf("read %q, want %q", data, tt.content)
+			}
+			if r.Mismatch() != tt.mismatch {
+				t.Errorf("Mismatch() = %v, want %v", r.Mismatch(), tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestNewMD5ReaderInvalidDigest(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	for _, digest := range []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString(sum[:8]),
+		base64.StdEncoding.EncodeToString(append(sum[:], 0)),
+		"5d41402abc4b2a76b9719d911017c592", // 十六进制而不是 base64
+	} {
+		if _, err := NewMD5Reader(strings.NewReader("hello"), digest); !errors.Is(err, ErrInvalidDigest) {
+			t.Errorf("NewMD5Reader(%q) = %v, want ErrInvalidDigest", digest, err)
+		}
+	}
+}
+
+// TestLocalStoreMD5Mismatch 校验失败时不留下对象
+func TestLocalStoreMD5Mismatch(t *testing.T) {
+	s := NewLocalStore(t.TempDir())
+	ctx := context.Background()
+	r, err := NewMD5Reader(strings.NewReader("tampered"), contentMD5("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Put(ctx, "f1/a.txt", r, -1, ""); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("put = %v, want ErrDigestMismatch", err)
+	}
+	if _, _, err = s.Get(ctx, "f1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after mismatch = %v, want ErrNotFound", err)
+	}
+	objects, err := s.List(ctx, "f1/")
+	if err != nil || len(objects) != 0 {
+		t.Errorf("list after mismatch = %v, %v, want no objects", objects, err)
+	}
+}
@@ -0,0 +1,442 @@
+package blobsvc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+	// s3MaxPresignExpires SigV4 预签名地址的最长有效期
+	s3MaxPresignExpires = 7 * 24 * time.Hour
+)
+
+// S3Config S3 兼容存储的配置，PathStyle 为 true 时使用 endpoint/bucket/key 形式的地址（MinIO 等），
+// Prefix 为所有 key 的公共前缀
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Prefix    string
+}
+
+// S3Store 基于 S3 REST 接口的存储，使用 SigV4 签名，请求体不参与签名（UNSIGNED-PAYLOAD）
+type S3Store struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Store(conf S3Config) (*S3Store, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("blob.s3 endpoint and bucket are required")
+	}
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	conf.Prefix = strings.Trim(conf.Prefix, "/")
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob.s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid blob.s3 endpoint: %s", conf.Endpoint)
+	}
+	return &S3Store{conf: conf, endpoint: endpoint, client: &http.Client{}}, nil
+}
+
+// s3Error S3 接口返回的错误
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+func (s *S3Store) objectKey(key string) string {
+	if s.conf.Prefix == "" {
+		return key
+	}
+	return s.conf.Prefix + "/" + key
+}
+
+// objectURL 返回对象的地址，key 为空时为 bucket 的地址
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.conf.PathStyle {
+		base += "/" + s.conf.Bucket
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+	u.Path = base + "/" + key
+	u.RawPath = s3Escape(base, false) + "/" + s3Escape(key, false)
+	return &u
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	// S3 的 PUT 需要 Content-Length，大小未知时先写入本地临时文件
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "blob-*")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+	// 空内容必须直接使用 http.NoBody，否则 Content-Length 为 0 时会按 chunked 发送，S3 要求有 Content-Length
+	var body io.ReadCloser = http.NoBody
+	if size > 0 {
+		body = io.NopCloser(r)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(s.objectKey(key)).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(s.objectKey(key)).String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(s.objectKey(key)).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	// 不支持 Range 的服务返回整个对象，跳过前面的部分
+	if resp.StatusCode != http.StatusPartialContent && offset > 0 {
+		if _, err = io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return resp.Body, nil
+	}
+	return limitedReadCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(s.objectKey(key)).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return objectInfo(key, resp), nil
+}
+
+// Delete S3 删除不存在的对象时同样返回成功
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(s.objectKey(key)).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List 使用 ListObjectsV2，按 continuation-token 翻页直到取完
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	var (
+		res   []ObjectInfo
+		token string
+	)
+	full := s.objectKey(prefix)
+	for {
+		u := s.objectURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {full}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = s3Query(query)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			key := c.Key
+			if s.conf.Prefix != "" {
+				key = strings.TrimPrefix(key, s.conf.Prefix+"/")
+			}
+			modTime, _ := time.Parse(time.RFC3339, c.LastModified)
+			res = append(res, ObjectInfo{Key: key, Size: c.Size, ModTime: modTime, ETag: strings.Trim(c.ETag, `"`)})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res, nil
+}
+
+// PresignedURL 生成查询参数签名的地址，有效期最长 7 天
+func (s *S3Store) PresignedURL(ctx context.Context, method string, key string, expires time.Duration) (string, error) {
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", fmt.Errorf("presign method %s not supported", method)
+	}
+	if expires <= 0 || expires > s3MaxPresignExpires {
+		return "", fmt.Errorf("presign expires must be within (0, %s]", s3MaxPresignExpires)
+	}
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return s.presign(method, key, expires, time.Now().UTC()), nil
+}
+
+func (s *S3Store) presign(method string, key string, expires time.Duration, now time.Time) string {
+	u := s.objectURL(s.objectKey(key))
+	query := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.conf.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(s3TimeFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u.RawQuery = s3Query(query)
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String()
+}
+
+// do 签名并发送请求，非 2xx 响应转为错误
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && req.URL.RawQuery == "" {
+		return nil, ErrNotFound
+	}
+	res := &s3Error{StatusCode: resp.StatusCode}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil {
+		_ = xml.Unmarshal(data, res)
+	}
+	return nil, res
+}
+
+// sign 使用 Authorization 头签名，只签 host 及 x-amz-* 头
+func (s *S3Store) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.conf.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonical)))
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.conf.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{s3Algorithm, now.Format(s3TimeFormat), s.scope(now), hex.EncodeToString(hash[:])}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.conf.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ModTime:     modTime,
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+}
+
+// s3Query 按 SigV4 的要求排序并编码查询参数
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape 只保留 RFC 3986 的非保留字符，路径中的 / 不编码
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package blobsvc
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// rangeWindow 每次向存储请求的最大字节数，随机读取时不必下载整个对象
+const rangeWindow = 4 << 20
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Open 以可随机读取的方式打开对象，读取时按需分段请求，适合 http.ServeContent；调用方负责关闭
+func Open(ctx context.Context, store BlobStore, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &rangeReader{ctx: ctx, store: store, key: key, size: info.Size}, info, nil
+}
+
+// rangeReader 记录当前位置，Seek 只移动位置，Read 时再从该位置请求一段内容
+type rangeReader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	end    int64 // 当前请求的一段的结束位置
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		length := min(r.size-r.offset, rangeWindow)
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, length)
+		if err != nil {
+			return 0, err
+		}
+		r.body, r.end = body, r.offset+length
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF {
+		r.body.Close()
+		r.body = nil
+		switch {
+		case r.offset < r.end:
+			// 对象比 Stat 时短
+			err = io.ErrUnexpectedEOF
+		case n == 0:
+			// 一段读完，从新的位置请求下一段
+			return r.Read(p)
+		default:
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("blob: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("blob: negative position")
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,85 @@
+package chartsvc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	filesvc "aichatoffice/pkg/services/file"
+	"aichatoffice/pkg/utils"
+)
+
+const (
+	FormatSvg = "svg"
+	FormatPng = "png"
+)
+
+// Asset 渲染后保存的图片，ObjectName 可用于插入文档
+type Asset struct {
+	Format     string `json:"format"`
+	ObjectName string `json:"objectName"`
+	Url        string `json:"url"`
+	Size       int    `json:"size"`
+}
+
+// Chart 图表定义及渲染结果
+type Chart struct {
+	Id     string  `json:"id"`
+	FileId string  `json:"fileId"`
+	Spec   *Spec   `json:"spec"`
+	Assets []Asset `json:"assets"`
+}
+
+type ChartSvc struct {
+	fileSvc *filesvc.FileService
+}
+
+func NewChartSvc(fileSvc *filesvc.FileService) *ChartSvc {
+	return &ChartSvc{
+		fileSvc: fileSvc,
+	}
+}
+
+// Render 按格式渲染图表
+func Render(spec *Spec, format string) ([]byte, error) {
+	switch format {
+	case FormatSvg:
+		return RenderSVG(spec), nil
+	case FormatPng:
+		return RenderPNG(spec)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidSpec, format)
+	}
+}
+
+// Save 渲染为 SVG 及 PNG，作为文件的附件资源保存
+func (c *ChartSvc) Save(ctx context.Context, fileId string, spec *Spec) (*Chart, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	id, err := utils.NewGuid(16)
+	if err != nil {
+		return nil, err
+	}
+	chart := &Chart{Id: id, FileId: fileId, Spec: spec}
+	for _, format := range []string{FormatSvg, FormatPng} {
+		content, err := Render(spec, format)
+		if err != nil {
+			return nil, err
+		}
+		objectName := fmt.Sprintf("/assets/charts/%s.%s", id, format)
+		if err := c.fileSvc.SaveAsset(ctx, fileId, objectName, content); err != nil {
+			elog.Error("save chart asset failed", zap.Error(err), zap.String("fileId", fileId), zap.String("objectName", objectName))
+			return nil, err
+		}
+		chart.Assets = append(chart.Assets, Asset{
+			Format:     format,
+			ObjectName: objectName,
+			Url:        c.fileSvc.GetDownloadPathUrl(fileId, objectName, "inline", 0),
+			Size:       len(content),
+		})
+	}
+	return chart, nil
+}
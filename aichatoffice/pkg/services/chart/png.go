@@ -0,0 +1,243 @@
+package chartsvc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+)
+
+// pngScale PNG 按两倍分辨率绘制
+const pngScale = 2
+
+// pngCanvas 纯 Go 光栅化：配置了 chart.fontPath 时文本使用该点阵字体，否则使用内置的 ASCII 点阵字体，
+// 遇到内置字体不支持的字符（如中文）时渲染失败，返回 ErrFontMissing，不输出显示为方框的图片
+type pngCanvas struct {
+	img   *image.RGBA
+	scale float64
+	font  hexFont
+	err   error
+}
+
+func (p *pngCanvas) blend(x, y int, c color.RGBA, alpha float64) {
+	if !(image.Point{X: x, Y: y}).In(p.img.Rect) {
+		return
+	}
+	i := p.img.PixOffset(x, y)
+	pix := p.img.Pix[i : i+4 : i+4]
+	pix[0] = uint8(float64(c.R)*alpha + float64(pix[0])*(1-alpha))
+	pix[1] = uint8(float64(c.G)*alpha + float64(pix[1])*(1-alpha))
+	pix[2] = uint8(float64(c.B)*alpha + float64(pix[2])*(1-alpha))
+	pix[3] = 0xff
+}
+
+// fillRect 按设备像素填充
+func (p *pngCanvas) fillRect(x0, y0, x1, y1 int, c color.RGBA) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			p.blend(x, y, c, 1)
+		}
+	}
+}
+
+func (p *pngCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	s := p.scale
+	p.fillRect(int(math.Round(x*s)), int(math.Round(y*s)), int(math.Round((x+w)*s)), int(math.Round((y+h)*s)), c)
+}
+
+// line 以像素中心到线段的距离判断覆盖
+func (p *pngCanvas) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	s := p.scale
+	x1, y1, x2, y2 = x1*s, y1*s, x2*s, y2*s
+	half := math.Max(width*s/2, 0.5)
+	minX, maxX := int(math.Floor(math.Min(x1, x2)-half)), int(math.Ceil(math.Max(x1, x2)+half))
+	minY, maxY := int(math.Floor(math.Min(y1, y2)-half)), int(math.Ceil(math.Max(y1, y2)+half))
+	dx, dy := x2-x1, y2-y1
+	length := dx*dx + dy*dy
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			t := 0.0
+			if length > 0 {
+				t = math.Max(0, math.Min(1, ((px-x1)*dx+(py-y1)*dy)/length))
+			}
+			d := math.Hypot(px-(x1+t*dx), py-(y1+t*dy))
+			if d <= half {
+				p.blend(x, y, c, 1)
+			} else if d < half+1 {
+				p.blend(x, y, c, half+1-d)
+			}
+		}
+	}
+}
+
+func (p *pngCanvas) polyline(points []point, c color.RGBA, width float64) {
+	for i := 1; i < len(points); i++ {
+		p.line(points[i-1].X, points[i-1].Y, points[i].X, points[i].Y, c, width)
+	}
+	if len(points) == 1 {
+		p.circle(points[0].X, points[0].Y, width, c)
+	}
+}
+
+// polygon 扫描线填充，奇偶规则
+func (p *pngCanvas) polygon(points []point, c color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	s := p.scale
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, pt := range points {
+		minY, maxY = math.Min(minY, pt.Y*s), math.Max(maxY, pt.Y*s)
+	}
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		py := float64(y) + 0.5
+		var xs []float64
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			ay, by := a.Y*s, b.Y*s
+			if (ay <= py) == (by <= py) {
+				continue
+			}
+			xs = append(xs, a.X*s+(py-ay)/(by-ay)*(b.X-a.X)*s)
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := int(math.Round(xs[i])); x < int(math.Round(xs[i+1])); x++ {
+				p.blend(x, y, c, 0.7)
+			}
+		}
+	}
+}
+
+func (p *pngCanvas) circle(cx, cy, r float64, c color.RGBA) {
+	p.wedge(cx, cy, r, 0, 2*math.Pi, c)
+}
+
+func (p *pngCanvas) wedge(cx, cy, r, start, end float64, c color.RGBA) {
+	s := p.scale
+	cx, cy, r = cx*s, cy*s, r*s
+	full := end-start >= 2*math.Pi-1e-9
+	for y := int(cy - r - 1); y <= int(cy+r+1); y++ {
+		for x := int(cx - r - 1); x <= int(cx+r+1); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			d := math.Hypot(dx, dy)
+			if d > r+0.5 {
+				continue
+			}
+			if !full {
+				a := math.Atan2(dy, dx)
+				for a < start {
+					a += 2 * math.Pi
+				}
+				for a >= start+2*math.Pi {
+					a -= 2 * math.Pi
+				}
+				if a > end {
+					continue
+				}
+			}
+			p.blend(x, y, c, math.Min(1, r+0.5-d))
+		}
+	}
+}
+
+// text 点阵字体，每个字符宽 6 列（含间隔）、高 7 行
+func (p *pngCanvas) text(x, y float64, text string, anchor string, size float64, c color.RGBA) {
+	if p.font != nil {
+		p.hexText(x, y, text, anchor, size, c)
+		return
+	}
+	px := math.Max(1, math.Round(size*p.scale/7))
+	runes := []rune(text)
+	for _, r := range runes {
+		if !hasGlyph(r) && p.err == nil {
+			p.err = fmt.Errorf("%w: %q", ErrFontMissing, text)
+		}
+	}
+	width := float64(len(runes))*6*px - px
+	x0 := x * p.scale
+	switch anchor {
+	case "middle":
+		x0 -= width / 2
+	case "end":
+		x0 -= width
+	}
+	y0 := y*p.scale - 7*px
+	for i, r := range runes {
+		g := glyph(r)
+		for col := 0; col < 5; col++ {
+			for row := 0; row < 7; row++ {
+				if g[col]&(1<<row) == 0 {
+					continue
+				}
+				gx := int(x0 + (float64(i*6+col))*px)
+				gy := int(y0 + float64(row)*px)
+				p.fillRect(gx, gy, gx+int(px), gy+int(px), c)
+			}
+		}
+	}
+}
+
+// hexText 按字号缩放 Unifont 字形，字体中没有的字符绘制为方框
+func (p *pngCanvas) hexText(x, y float64, text string, anchor string, size float64, c color.RGBA) {
+	px := size * p.scale / hexFontHeight
+	runes := []rune(text)
+	glyphs := make([]hexGlyph, len(runes))
+	width := 0.0
+	for i, r := range runes {
+		g, ok := p.font[r]
+		if !ok {
+			g = boxGlyph
+		}
+		glyphs[i] = g
+		width += float64(g.width) * px
+	}
+	x0 := x * p.scale
+	switch anchor {
+	case "middle":
+		x0 -= width / 2
+	case "end":
+		x0 -= width
+	}
+	y0 := y*p.scale - hexFontAscent*px
+	for _, g := range glyphs {
+		for col := 0; col < g.width; col++ {
+			for row := 0; row < hexFontHeight; row++ {
+				if !g.bit(col, row) {
+					continue
+				}
+				p.fillRect(int(math.Round(x0+float64(col)*px)), int(math.Round(y0+float64(row)*px)),
+					int(math.Round(x0+float64(col+1)*px)), int(math.Round(y0+float64(row+1)*px)), c)
+			}
+		}
+		x0 += float64(g.width) * px
+	}
+}
+
+// boxGlyph 字体中没有的字符
+var boxGlyph = hexGlyph{width: 8, rows: []uint16{
+	0, 0, 0x7e00, 0x4200, 0x4200, 0x4200, 0x4200, 0x4200, 0x4200, 0x4200, 0x4200, 0x4200, 0x7e00, 0, 0, 0,
+}}
+
+// RenderPNG 把图表渲染为 PNG，文字需要字体而没有配置时返回 ErrFontMissing
+func RenderPNG(spec *Spec) ([]byte, error) {
+	width, height := canvasSize(spec)
+	p := &pngCanvas{
+		img:   image.NewRGBA(image.Rect(0, 0, int(width*pngScale), int(height*pngScale))),
+		scale: pngScale,
+		font:  pngFont(),
+	}
+	draw(spec, p)
+	if p.err != nil {
+		return nil, p.err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, p.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,410 @@
+package chartsvc
+
+import (
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	marginTop     = 16
+	titleHeight   = 28
+	marginLeft    = 64
+	marginBottom  = 48
+	marginRight   = 16
+	legendWidth   = 140
+	fontSize      = 11
+	titleFontSize = 14
+	maxLabelRunes = 12
+)
+
+var (
+	// palette Vega 默认的 tableau10 配色
+	palette = []color.RGBA{
+		{0x4c, 0x78, 0xa8, 0xff}, {0xf5, 0x85, 0x18, 0xff}, {0xe4, 0x57, 0x56, 0xff}, {0x72, 0xb7, 0xb2, 0xff},
+		{0x54, 0xa2, 0x4b, 0xff}, {0xee, 0xca, 0x3b, 0xff}, {0xb2, 0x79, 0xa2, 0xff}, {0xff, 0x9d, 0xa6, 0xff},
+		{0x9d, 0x75, 0x5d, 0xff}, {0xba, 0xb0, 0xac, 0xff},
+	}
+	white     = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	textColor = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	axisColor = color.RGBA{0x88, 0x88, 0x88, 0xff}
+	gridColor = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+)
+
+type point struct {
+	X, Y float64
+}
+
+// canvas 绘图后端，SVG 与 PNG 分别实现；坐标以左上角为原点，文本的 y 为基线
+type canvas interface {
+	rect(x, y, w, h float64, fill color.RGBA)
+	line(x1, y1, x2, y2 float64, stroke color.RGBA, width float64)
+	polyline(points []point, stroke color.RGBA, width float64)
+	polygon(points []point, fill color.RGBA)
+	circle(cx, cy, r float64, fill color.RGBA)
+	wedge(cx, cy, r, start, end float64, fill color.RGBA)
+	text(x, y float64, s string, anchor string, size float64, fill color.RGBA)
+}
+
+// aggregator 按 (x, 系列) 聚合的值
+type aggregator struct {
+	sum, min, max float64
+	count         int
+}
+
+func (a *aggregator) add(v float64) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+}
+
+func (a *aggregator) value(op string) float64 {
+	switch op {
+	case "count":
+		return float64(a.count)
+	case "mean", "average":
+		if a.count == 0 {
+			return 0
+		}
+		return a.sum / float64(a.count)
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	default:
+		return a.sum
+	}
+}
+
+// table 聚合后的数据：Categories 为 x 轴（或饼图扇区）的取值，Series 为颜色分组
+type table struct {
+	Categories []string
+	Series     []string
+	values     map[[2]string]*aggregator
+	op         string
+	numericX   bool
+}
+
+func (t *table) value(category string, series string) (float64, bool) {
+	a, ok := t.values[[2]string{category, series}]
+	if !ok {
+		return 0, false
+	}
+	return a.value(t.op), true
+}
+
+// buildTable 按分类字段及颜色字段分组聚合数值字段
+func buildTable(values []map[string]interface{}, category *FieldDef, measure *FieldDef, series *FieldDef) *table {
+	t := &table{values: map[[2]string]*aggregator{}, op: measure.Aggregate}
+	seenCategory, seenSeries := map[string]bool{}, map[string]bool{}
+	for _, row := range values {
+		c := ""
+		if category != nil && category.Field != "" {
+			c = label(row[category.Field])
+		}
+		s := ""
+		if series != nil && series.Field != "" {
+			s = label(row[series.Field])
+		}
+		v := 1.0
+		if measure.Aggregate != "count" {
+			n, ok := number(row[measure.Field])
+			if !ok {
+				continue
+			}
+			v = n
+		}
+		if !seenCategory[c] {
+			seenCategory[c] = true
+			t.Categories = append(t.Categories, c)
+		}
+		if !seenSeries[s] {
+			seenSeries[s] = true
+			t.Series = append(t.Series, s)
+		}
+		key := [2]string{c, s}
+		if t.values[key] == nil {
+			t.values[key] = &aggregator{}
+		}
+		t.values[key].add(v)
+	}
+	// 数值、时间及有序类型的 x 排序，都是数字时按大小，否则按字符串；名义类型保持数据中的顺序
+	if category != nil && (category.Type == TypeQuantitative || category.Type == TypeTemporal || category.Type == TypeOrdinal) {
+		numeric := true
+		for _, c := range t.Categories {
+			if _, err := strconv.ParseFloat(c, 64); err != nil {
+				numeric = false
+				break
+			}
+		}
+		if numeric {
+			sort.SliceStable(t.Categories, func(i, j int) bool {
+				a, _ := strconv.ParseFloat(t.Categories[i], 64)
+				b, _ := strconv.ParseFloat(t.Categories[j], 64)
+				return a < b
+			})
+			t.numericX = category.Type == TypeQuantitative
+		} else {
+			sort.Strings(t.Categories)
+		}
+	}
+	return t
+}
+
+// draw 按图表定义在画布上绘制，画布尺寸由 canvasSize 计算
+func draw(spec *Spec, c canvas) {
+	width, height := canvasSize(spec)
+	c.rect(0, 0, width, height, white)
+	top := float64(marginTop)
+	if spec.Title != "" {
+		c.text(width/2, marginTop+titleFontSize, string(spec.Title), "middle", titleFontSize, textColor)
+		top += titleHeight
+	}
+	if spec.Mark == MarkArc {
+		drawArc(spec, c, top)
+		return
+	}
+	drawCartesian(spec, c, top)
+}
+
+func canvasSize(spec *Spec) (float64, float64) {
+	width := float64(marginLeft + spec.Width + marginRight)
+	if hasLegend(spec) {
+		width += legendWidth
+	}
+	height := float64(marginTop + spec.Height + marginBottom)
+	if spec.Title != "" {
+		height += titleHeight
+	}
+	return width, height
+}
+
+func hasLegend(spec *Spec) bool {
+	return spec.Encoding.Color != nil && spec.Encoding.Color.Field != ""
+}
+
+func drawArc(spec *Spec, c canvas, top float64) {
+	e := spec.Encoding
+	t := buildTable(spec.Data.Values, e.Color, e.Theta, nil)
+	total := 0.0
+	for _, category := range t.Categories {
+		v, _ := t.value(category, "")
+		if v > 0 {
+			total += v
+		}
+	}
+	cx := float64(marginLeft) + float64(spec.Width)/2
+	cy := top + float64(spec.Height)/2
+	r := math.Min(float64(spec.Width), float64(spec.Height)) / 2
+	start := -math.Pi / 2
+	for i, category := range t.Categories {
+		v, _ := t.value(category, "")
+		if v <= 0 || total == 0 {
+			continue
+		}
+		end := start + v/total*2*math.Pi
+		c.wedge(cx, cy, r, start, end, palette[i%len(palette)])
+		start = end
+	}
+	if hasLegend(spec) {
+		drawLegend(spec, c, top, e.Color.label(), t.Categories)
+	}
+}
+
+func drawCartesian(spec *Spec, c canvas, top float64) {
+	e := spec.Encoding
+	t := buildTable(spec.Data.Values, e.X, e.Y, e.Color)
+	left := float64(marginLeft)
+	plotW, plotH := float64(spec.Width), float64(spec.Height)
+	bottom := top + plotH
+	stacked := spec.Mark == MarkBar || spec.Mark == MarkArea
+
+	// y 轴范围包含 0，堆叠时取各分类的合计
+	lo, hi := 0.0, 0.0
+	for _, category := range t.Categories {
+		pos, neg := 0.0, 0.0
+		for _, s := range t.Series {
+			v, ok := t.value(category, s)
+			if !ok {
+				continue
+			}
+			if !stacked {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+				continue
+			}
+			if v >= 0 {
+				pos += v
+			} else {
+				neg += v
+			}
+		}
+		lo, hi = math.Min(lo, neg), math.Max(hi, pos)
+	}
+	ticks := niceTicks(lo, hi, 5)
+	lo, hi = ticks[0], ticks[len(ticks)-1]
+	yPos := func(v float64) float64 {
+		return bottom - (v-lo)/(hi-lo)*plotH
+	}
+
+	// 网格线及 y 轴刻度
+	for _, tick := range ticks {
+		y := yPos(tick)
+		c.line(left, y, left+plotW, y, gridColor, 1)
+		c.text(left-6, y+4, formatTick(tick), "end", fontSize, textColor)
+	}
+	c.text(left+4, top-6, clip(e.Y.label(), maxLabelRunes*2), "start", fontSize, textColor)
+
+	// x 轴：数值类型为线性比例，其余为等宽分段
+	n := len(t.Categories)
+	band := plotW / math.Max(float64(n), 1)
+	xPos := func(i int) float64 {
+		return left + band*(float64(i)+0.5)
+	}
+	if t.numericX && n > 1 {
+		xlo, _ := strconv.ParseFloat(t.Categories[0], 64)
+		xhi, _ := strconv.ParseFloat(t.Categories[n-1], 64)
+		xPos = func(i int) float64 {
+			v, _ := strconv.ParseFloat(t.Categories[i], 64)
+			if xhi == xlo {
+				return left + plotW/2
+			}
+			return left + 8 + (v-xlo)/(xhi-xlo)*(plotW-16)
+		}
+	}
+	c.line(left, yPos(math.Max(lo, 0)), left+plotW, yPos(math.Max(lo, 0)), axisColor, 1)
+	c.line(left, top, left, bottom, axisColor, 1)
+	// 标签过密时间隔显示
+	step := int(math.Ceil(float64(n) * 56 / plotW))
+	if step < 1 {
+		step = 1
+	}
+	for i := 0; i < n; i += step {
+		c.text(xPos(i), bottom+16, clip(t.Categories[i], int(math.Max(band*float64(step)/7, 3))), "middle", fontSize, textColor)
+	}
+	c.text(left+plotW/2, bottom+38, clip(e.X.label(), maxLabelRunes*3), "middle", fontSize, textColor)
+
+	switch spec.Mark {
+	case MarkBar:
+		barW := band * 0.8
+		for i, category := range t.Categories {
+			pos, neg := 0.0, 0.0
+			for si, s := range t.Series {
+				v, ok := t.value(category, s)
+				if !ok || v == 0 {
+					continue
+				}
+				var from, to float64
+				if v > 0 {
+					from, to = pos, pos+v
+					pos = to
+				} else {
+					from, to = neg, neg+v
+					neg = to
+				}
+				y1, y2 := yPos(math.Max(from, to)), yPos(math.Min(from, to))
+				c.rect(xPos(i)-barW/2, y1, barW, y2-y1, palette[si%len(palette)])
+			}
+		}
+	case MarkLine, MarkPoint, MarkArea:
+		base := make([]float64, n)
+		for si, s := range t.Series {
+			col := palette[si%len(palette)]
+			var points, lower []point
+			for i, category := range t.Categories {
+				v, ok := t.value(category, s)
+				if !ok {
+					continue
+				}
+				y0 := 0.0
+				if stacked {
+					y0 = base[i]
+					base[i] += v
+				}
+				points = append(points, point{xPos(i), yPos(y0 + v)})
+				lower = append(lower, point{xPos(i), yPos(y0)})
+			}
+			switch spec.Mark {
+			case MarkLine:
+				c.polyline(points, col, 2)
+			case MarkPoint:
+				for _, p := range points {
+					c.circle(p.X, p.Y, 3.5, col)
+				}
+			case MarkArea:
+				area := append([]point{}, points...)
+				for i := len(lower) - 1; i >= 0; i-- {
+					area = append(area, lower[i])
+				}
+				c.polygon(area, col)
+			}
+		}
+	}
+	if hasLegend(spec) {
+		drawLegend(spec, c, top, e.Color.label(), t.Series)
+	}
+}
+
+func drawLegend(spec *Spec, c canvas, top float64, title string, names []string) {
+	x := float64(marginLeft+spec.Width+marginRight) + 8
+	c.text(x, top+fontSize, clip(title, maxLabelRunes), "start", fontSize, textColor)
+	for i, name := range names {
+		y := top + 24 + float64(i)*18
+		if y > top+float64(spec.Height) {
+			c.text(x, y+fontSize, "...", "start", fontSize, textColor)
+			return
+		}
+		c.rect(x, y+2, 10, 10, palette[i%len(palette)])
+		c.text(x+16, y+fontSize, clip(name, maxLabelRunes), "start", fontSize, textColor)
+	}
+}
+
+// niceTicks 按 1、2、5 的倍数取刻度，返回包含 lo、hi 的刻度值
+func niceTicks(lo float64, hi float64, count int) []float64 {
+	if hi == lo {
+		hi = lo + 1
+	}
+	raw := (hi - lo) / float64(count)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{1, 2, 5, 10} {
+		step = m * mag
+		if step >= raw {
+			break
+		}
+	}
+	start := math.Floor(lo/step) * step
+	end := math.Ceil(hi/step) * step
+	var ticks []float64
+	for v := start; v <= end+step/2; v += step {
+		ticks = append(ticks, math.Round(v/step)*step)
+	}
+	return ticks
+}
+
+func formatTick(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e9:
+		return formatNumber(math.Round(v/1e8)/10) + "B"
+	case abs >= 1e6:
+		return formatNumber(math.Round(v/1e5)/10) + "M"
+	case abs >= 1e4:
+		return formatNumber(math.Round(v/1e2)/10) + "k"
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
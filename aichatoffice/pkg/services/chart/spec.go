@@ -0,0 +1,235 @@
+package chartsvc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSpec = errors.New("invalid chart spec")
+
+const (
+	MarkBar   = "bar"
+	MarkLine  = "line"
+	MarkPoint = "point"
+	MarkArea  = "area"
+	MarkArc   = "arc"
+
+	TypeQuantitative = "quantitative"
+	TypeNominal      = "nominal"
+	TypeOrdinal      = "ordinal"
+	TypeTemporal     = "temporal"
+
+	SchemaUrl = "https://vega.github.io/schema/vega-lite/v5.json"
+
+	defaultWidth  = 480
+	defaultHeight = 300
+	maxSize       = 2000
+	maxDataValues = 5000
+)
+
+// Spec 支持的 Vega-Lite 子集：单视图，data.values 内联数据，mark 为 bar、line、point、area、arc，
+// encoding 支持 x、y、color、theta
+type Spec struct {
+	Schema      string   `json:"$schema,omitempty"`
+	Title       Title    `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Width       int      `json:"width,omitempty"`
+	Height      int      `json:"height,omitempty"`
+	Data        Data     `json:"data"`
+	Mark        Mark     `json:"mark"`
+	Encoding    Encoding `json:"encoding"`
+}
+
+type Data struct {
+	Values []map[string]interface{} `json:"values"`
+}
+
+type Encoding struct {
+	X     *FieldDef `json:"x,omitempty"`
+	Y     *FieldDef `json:"y,omitempty"`
+	Color *FieldDef `json:"color,omitempty"`
+	Theta *FieldDef `json:"theta,omitempty"`
+}
+
+// FieldDef 字段编码，aggregate 支持 sum、mean、average、count、min、max
+type FieldDef struct {
+	Field     string `json:"field,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Aggregate string `json:"aggregate,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+func (f *FieldDef) label() string {
+	if f.Title != "" {
+		return f.Title
+	}
+	if f.Aggregate != "" && f.Field != "" {
+		return fmt.Sprintf("%s(%s)", f.Aggregate, f.Field)
+	}
+	if f.Aggregate == "count" {
+		return "count"
+	}
+	return f.Field
+}
+
+// Title 可以是字符串或 {"text": ...}
+type Title string
+
+func (t *Title) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Title(s)
+		return nil
+	}
+	var obj struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*t = Title(obj.Text)
+	return nil
+}
+
+// Mark 可以是字符串或 {"type": ...}
+type Mark string
+
+func (m *Mark) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = Mark(s)
+		return nil
+	}
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*m = Mark(obj.Type)
+	return nil
+}
+
+// ParseSpec 解析并校验图表定义，补全 $schema 及默认尺寸
+func ParseSpec(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate 校验并补全默认值
+func (s *Spec) Validate() error {
+	if s.Schema == "" {
+		s.Schema = SchemaUrl
+	}
+	if s.Width <= 0 {
+		s.Width = defaultWidth
+	}
+	if s.Height <= 0 {
+		s.Height = defaultHeight
+	}
+	if s.Width > maxSize || s.Height > maxSize {
+		return fmt.Errorf("%w: width and height must not exceed %d", ErrInvalidSpec, maxSize)
+	}
+	if len(s.Data.Values) == 0 {
+		return fmt.Errorf("%w: data.values is required", ErrInvalidSpec)
+	}
+	if len(s.Data.Values) > maxDataValues {
+		return fmt.Errorf("%w: at most %d data values", ErrInvalidSpec, maxDataValues)
+	}
+	e := s.Encoding
+	switch s.Mark {
+	case MarkArc:
+		if e.Theta == nil || (e.Theta.Field == "" && e.Theta.Aggregate != "count") {
+			return fmt.Errorf("%w: arc requires encoding.theta", ErrInvalidSpec)
+		}
+	case MarkBar, MarkLine, MarkPoint, MarkArea:
+		if e.X == nil || e.X.Field == "" {
+			return fmt.Errorf("%w: %s requires encoding.x.field", ErrInvalidSpec, s.Mark)
+		}
+		if e.Y == nil || (e.Y.Field == "" && e.Y.Aggregate != "count") {
+			return fmt.Errorf("%w: %s requires encoding.y", ErrInvalidSpec, s.Mark)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported mark %q", ErrInvalidSpec, s.Mark)
+	}
+	// y、theta 只支持数值，其余未指定类型时为名义类型
+	for _, f := range []*FieldDef{e.Y, e.Theta} {
+		if f != nil && f.Type == "" {
+			f.Type = TypeQuantitative
+		}
+	}
+	for _, f := range []*FieldDef{e.X, e.Y, e.Color, e.Theta} {
+		if f == nil {
+			continue
+		}
+		switch f.Aggregate {
+		case "", "sum", "mean", "average", "count", "min", "max":
+		default:
+			return fmt.Errorf("%w: unsupported aggregate %q", ErrInvalidSpec, f.Aggregate)
+		}
+		if f.Type == "" {
+			f.Type = TypeNominal
+		}
+	}
+	for _, f := range []*FieldDef{e.Y, e.Theta} {
+		if f != nil && f.Type != TypeQuantitative {
+			return fmt.Errorf("%w: encoding.y and encoding.theta must be quantitative", ErrInvalidSpec)
+		}
+	}
+	return nil
+}
+
+// number 把数据中的值转为数字，不能转换时返回 false
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, !math.IsNaN(n) && !math.IsInf(n, 0)
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.ReplaceAll(n, ",", "")), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// label 把数据中的值转为分类标签，整数不带小数点
+func label(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return n
+	case float64:
+		return formatNumber(n)
+	case []byte:
+		return string(n)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,79 @@
+package chartsvc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// svgCanvas 生成 SVG，文本使用系统字体渲染
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func fill(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s *svgCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	fmt.Fprintf(&s.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, x, y, w, h, fill(c))
+}
+
+func (s *svgCanvas) line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	fmt.Fprintf(&s.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"/>`, x1, y1, x2, y2, fill(c), width)
+}
+
+func svgPoints(points []point) string {
+	parts := make([]string, 0, len(points))
+	for _, p := range points {
+		parts = append(parts, fmt.Sprintf("%.1f,%.1f", p.X, p.Y))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *svgCanvas) polyline(points []point, c color.RGBA, width float64) {
+	fmt.Fprintf(&s.buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%.1f" stroke-linejoin="round"/>`, svgPoints(points), fill(c), width)
+}
+
+func (s *svgCanvas) polygon(points []point, c color.RGBA) {
+	fmt.Fprintf(&s.buf, `<polygon points="%s" fill="%s" fill-opacity="0.7"/>`, svgPoints(points), fill(c))
+}
+
+func (s *svgCanvas) circle(cx, cy, r float64, c color.RGBA) {
+	fmt.Fprintf(&s.buf, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`, cx, cy, r, fill(c))
+}
+
+func (s *svgCanvas) wedge(cx, cy, r, start, end float64, c color.RGBA) {
+	// 整圆时 path 的起止点重合，直接画圆
+	if end-start >= 2*math.Pi-1e-9 {
+		s.circle(cx, cy, r, c)
+		return
+	}
+	large := 0
+	if end-start > math.Pi {
+		large = 1
+	}
+	x1, y1 := cx+r*math.Cos(start), cy+r*math.Sin(start)
+	x2, y2 := cx+r*math.Cos(end), cy+r*math.Sin(end)
+	fmt.Fprintf(&s.buf, `<path d="M%.1f,%.1f L%.1f,%.1f A%.1f,%.1f 0 %d 1 %.1f,%.1f Z" fill="%s" stroke="#ffffff"/>`,
+		cx, cy, x1, y1, r, r, large, x2, y2, fill(c))
+}
+
+func (s *svgCanvas) text(x, y float64, text string, anchor string, size float64, c color.RGBA) {
+	fmt.Fprintf(&s.buf, `<text x="%.1f" y="%.1f" text-anchor="%s" font-size="%.0f" fill="%s">`, x, y, anchor, size, fill(c))
+	xml.EscapeText(&s.buf, []byte(text))
+	s.buf.WriteString("</text>")
+}
+
+// RenderSVG 把图表渲染为 SVG
+func RenderSVG(spec *Spec) []byte {
+	width, height := canvasSize(spec)
+	s := &svgCanvas{}
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif">`, width, height, width, height)
+	draw(spec, s)
+	s.buf.WriteString("</svg>")
+	return s.buf.Bytes()
+}
@@ -0,0 +1,128 @@
+package chatsvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/streaming"
+	aisvc "aichatoffice/pkg/services/ai"
+	"aichatoffice/pkg/utils"
+)
+
+const defaultMaxSteps = 5
+
+// partWriter 把模型输出的文本增量按流协议格式发送
+type partWriter struct {
+	send func(string)
+	part streaming.StreamPartType
+}
+
+func (w partWriter) Write(p []byte) (int, error) {
+	w.send(streaming.FormatDataContent(string(p), w.part))
+	return len(p), nil
+}
+
+func sendPart(send func(string), v interface{}, part streaming.StreamPartType) {
+	msg, err := streaming.FormatJSONContent(v, part)
+	if err != nil {
+		elog.Error("format stream part failed", zap.Error(err), zap.String("part", string(part)))
+		return
+	}
+	send(msg)
+}
+
+// loadTools 对话关联了可解析的文件时才提供工具，否则退回普通对话
+func (c ChatSvc) loadTools(ctx context.Context, userId string, conversationId string) (dto.FileMeta, *toolSet) {
+	conversation, err := c.chatStore.GetConversation(ctx, userId, conversationId)
+	if err != nil || conversation == nil || conversation.FileGuid == "" {
+		return dto.FileMeta{}, nil
+	}
+	file, doc, err := c.docSvc.Load(ctx, conversation.FileGuid)
+	if err != nil {
+		elog.Warn("load document for tools failed", zap.Error(err), zap.String("fileId", conversation.FileGuid), elog.FieldCtxTid(ctx))
+		return file, nil
+	}
+	return file, c.documentTools(&docState{file: file, doc: doc}, userId)
+}
+
+// runAgent 工具调用循环：模型请求工具时执行并把结果交给模型继续，直到模型不再调用工具或达到步数上限，
+// 最后一步不再提供工具，强制模型给出回答
+func (c ChatSvc) runAgent(ctx context.Context, aiSvc aisvc.AiSvc, file dto.FileMeta, tools *toolSet, chatInput string, w *utils.TeeWriter, send func(string)) (aisvc.Completion, error) {
+	maxSteps := econf.GetInt("userChat.maxSteps")
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxSteps
+	}
+	messages := []aisvc.Message{
+		{Role: aisvc.RoleSystem, Content: fmt.Sprintf("你是办公文档助手，用户正在查看文件《%s》。需要文件内容时请使用工具查询，不要编造，回答请基于工具返回的结果。", file.Name)},
+		{Role: aisvc.RoleUser, Content: chatInput},
+	}
+	total := aisvc.Completion{Model: aiSvc.Model()}
+	for step := 0; step < maxSteps; step++ {
+		messageId, _ := utils.NewGuid(16)
+		sendPart(send, streaming.StartStep{MessageId: messageId}, streaming.StartStepPart)
+
+		req := aisvc.ChatRequest{Messages: messages}
+		if step+1 < maxSteps {
+			req.Tools = tools.defs
+		}
+		res, err := aiSvc.ChatStream(ctx, req, w)
+		addCompletion(&total, res.Completion)
+		if err != nil {
+			return total, err
+		}
+		finish := streaming.FinishStep{
+			FinishReason: toFinishReason(res.FinishReason),
+			Usage: streaming.Usage{
+				PromptTokens:     res.Usage.PromptTokens,
+				CompletionTokens: res.Usage.CompletionTokens,
+			},
+		}
+		if len(res.ToolCalls) == 0 {
+			sendPart(send, finish, streaming.FinishStepPart)
+			return total, nil
+		}
+
+		messages = append(messages, aisvc.Message{Role: aisvc.RoleAssistant, Content: res.Content, ToolCalls: res.ToolCalls})
+		for _, call := range res.ToolCalls {
+			var args interface{} = map[string]interface{}{}
+			if call.Arguments != "" && json.Valid([]byte(call.Arguments)) {
+				args = json.RawMessage(call.Arguments)
+			}
+			sendPart(send, streaming.ToolCall{ToolCallId: call.Id, ToolName: call.Name, Args: args}, streaming.ToolCallPart)
+
+			result := tools.call(ctx, call)
+			sendPart(send, streaming.ToolResult{ToolCallId: call.Id, Result: result}, streaming.ToolResultPart)
+			if a, ok := result.(annotated); ok {
+				sendPart(send, []interface{}{a.Annotation()}, streaming.MessageAnnotationPart)
+			}
+			if d, ok := result.(dataResult); ok {
+				sendPart(send, []interface{}{d.Data()}, streaming.DataPart)
+			}
+
+			content, err := json.Marshal(result)
+			if err != nil {
+				content = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+			}
+			messages = append(messages, aisvc.Message{Role: aisvc.RoleTool, Content: string(content), ToolCallId: call.Id})
+		}
+		finish.FinishReason = streaming.FinishReasonToolCalls
+		sendPart(send, finish, streaming.FinishStepPart)
+	}
+	return total, nil
+}
+
+// addCompletion 累加多步调用的用量，结束原因取最后一步
+func addCompletion(total *aisvc.Completion, c aisvc.Completion) {
+	total.Usage.PromptTokens += c.Usage.PromptTokens
+	total.Usage.CompletionTokens += c.Usage.CompletionTokens
+	total.Usage.ReasoningTokens += c.Usage.ReasoningTokens
+	total.Usage.TotalTokens += c.Usage.TotalTokens
+	total.Latency += c.Latency
+	total.FinishReason = c.FinishReason
+}
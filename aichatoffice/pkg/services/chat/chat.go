@@ -3,9 +3,7 @@ package chatsvc
 import (
 	"context"
 	"fmt"
-	"net/http"
 
-	"github.com/gotomicro/cetus/l"
 	"github.com/gotomicro/ego/core/econf"
 	"github.com/gotomicro/ego/core/elog"
 	"go.uber.org/zap"
@@ -14,7 +12,11 @@ import (
 	"aichatoffice/pkg/models/store"
 	"aichatoffice/pkg/models/streaming"
 	aisvc "aichatoffice/pkg/services/ai"
+	chartsvc "aichatoffice/pkg/services/chart"
+	docsvc "aichatoffice/pkg/services/doc"
 	officesvc "aichatoffice/pkg/services/office"
+	quotasvc "aichatoffice/pkg/services/quota"
+	usagesvc "aichatoffice/pkg/services/usage"
 	"aichatoffice/pkg/utils"
 )
 
@@ -22,13 +24,21 @@ type ChatSvc struct {
 	chatStore store.ChatStore
 	AiSvc     aisvc.AiSvc
 	officeSvc officesvc.OfficeSvc
+	quotaSvc  *quotasvc.QuotaSvc
+	usageSvc  *usagesvc.UsageSvc
+	docSvc    *docsvc.DocSvc
+	chartSvc  *chartsvc.ChartSvc
 }
 
-func NewChatSvc(chatStore store.ChatStore, aiSvc aisvc.AiSvc, officeSvc officesvc.OfficeSvc) *ChatSvc {
+func NewChatSvc(chatStore store.ChatStore, aiSvc aisvc.AiSvc, officeSvc officesvc.OfficeSvc, quotaSvc *quotasvc.QuotaSvc, usageSvc *usagesvc.UsageSvc, docSvc *docsvc.DocSvc, chartSvc *chartsvc.ChartSvc) *ChatSvc {
 	return &ChatSvc{
 		chatStore: chatStore,
 		AiSvc:     aiSvc,
 		officeSvc: officeSvc,
+		quotaSvc:  quotaSvc,
+		usageSvc:  usageSvc,
+		docSvc:    docSvc,
+		chartSvc:  chartSvc,
 	}
 }
 
@@ -96,22 +106,29 @@ func (c ChatSvc) NewConversation(ctx context.Context, userId string, fileGuid st
 	return conversationId, nil
 }
 
+// ChatOptions 单次对话的选项
+type ChatOptions struct {
+	// AiSvc 为空时使用默认配置的 ai 服务
+	AiSvc aisvc.AiSvc
+	// Trial 使用试用额度，完成后扣减
+	Trial bool
+}
+
 // Chat AIChat方法
-func (c ChatSvc) Chat(ctx context.Context, userId string, conversationId string, chatInput string, event chan<- string, isFree bool) error {
+func (c ChatSvc) Chat(ctx context.Context, userId string, conversationId string, chatInput string, event chan<- string, opts ChatOptions) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	// todo 改成 workflow
-	rawMsg := make(chan string)
-	defer close(rawMsg)
-	teeWriter := utils.NewTeeWriter(utils.NewChanWriter(rawMsg))
-
-	// format 后才能返回
-	go func() {
-		for msg := range rawMsg {
-			event <- streaming.FormatDataContent(msg, streaming.TextPart)
+	defer close(event)
+	send := func(msg string) {
+		select {
+		case event <- msg:
+		case <-ctx.Done():
 		}
-		close(event)
-	}()
+	}
+	aiSvc := opts.AiSvc
+	if aiSvc == nil {
+		aiSvc = c.AiSvc
+	}
 
 	// 处理自定义 key
 	// todo 改成自定义类型
@@ -121,6 +138,7 @@ func (c ChatSvc) Chat(ctx context.Context, userId string, conversationId string,
 		fileContent, err := c.officeSvc.GetFileContent(conversationId) // todo 改成文件 id
 		if err != nil {
 			elog.Error("get file content failed", zap.Error(err), elog.FieldCtxTid(ctx))
+			c.sendError(send, dto.ErrContentHandle)
 			return err
 		}
 
@@ -128,66 +146,165 @@ func (c ChatSvc) Chat(ctx context.Context, userId string, conversationId string,
 		chatInput = fmt.Sprintf("请总结以下内容：%s", fileContent)
 	}
 
-	// 调用 ai
-	c.AiSvc.CompletionsStream(chatInput, teeWriter)
+	// todo 改成 workflow
+	teeWriter := utils.NewTeeWriter(partWriter{send: send, part: streaming.TextPart})
+
+	// 调用 ai，对话关联了文件时可以通过工具读取文件内容
+	var (
+		completion aisvc.Completion
+		err        error
+	)
+	if file, tools := c.loadTools(ctx, userId, conversationId); tools != nil {
+		defer tools.Close()
+		completion, err = c.runAgent(ctx, aiSvc, file, tools, chatInput, teeWriter, send)
+	} else {
+		completion, err = aiSvc.CompletionsStream(ctx, chatInput, teeWriter)
+	}
+	if err != nil {
+		elog.Error("completions stream failed", zap.Error(err), elog.FieldCtxTid(ctx))
+		c.recordFailedUsage(ctx, userId, conversationId, completion, opts)
+		c.sendError(send, err)
+		return err
+	}
+	response := teeWriter.GetBuffer().String()
 
 	// 记到数据库
-	go func(userId string, conversationId string, isFree bool) {
-		response := teeWriter.GetBuffer().String()
+	go c.saveMessages(userId, conversationId, chatInput, response)
+	c.finishMessage(ctx, send, userId, conversationId, completion, opts)
+	return nil
+}
 
-		// 获取现有对话
-		conversation, err := c.chatStore.GetConversation(ctx, userId, conversationId)
-		if err != nil {
-			elog.Error("get conversation failed", zap.Error(err))
-			return
-		}
-		if conversation == nil {
-			elog.Error("conversation not found")
-			return
+// recordUsage 记录用量及费用，使用试用额度时扣减并返回最新额度
+func (c ChatSvc) recordUsage(ctx context.Context, userId string, conversationId string, completion aisvc.Completion, opts ChatOptions) *quotasvc.QuotaStatus {
+	c.usageSvc.Record(ctx, userId, conversationId, completion, opts.Trial)
+	if !opts.Trial {
+		return nil
+	}
+	status, err := c.quotaSvc.Consume(ctx, userId, completion.Usage)
+	if err != nil {
+		elog.Error("consume quota failed", zap.Error(err), zap.String("userId", userId))
+		return nil
+	}
+	return status
+}
+
+// recordFailedUsage 调用失败或中断时，服务方已计费的部分同样计入用量、费用及试用额度，客户端断开也不能绕过
+func (c ChatSvc) recordFailedUsage(ctx context.Context, userId string, conversationId string, completion aisvc.Completion, opts ChatOptions) {
+	if completion.Usage.TotalTokens > 0 {
+		c.recordUsage(context.WithoutCancel(ctx), userId, conversationId, completion, opts)
+	}
+}
+
+// finishMessage 记录用量，试用额度扣减后把最新额度放到消息注释里，最后发送结束消息
+func (c ChatSvc) finishMessage(ctx context.Context, send func(string), userId string, conversationId string, completion aisvc.Completion, opts ChatOptions) {
+	if status := c.recordUsage(ctx, userId, conversationId, completion, opts); status != nil {
+		if msg, err := streaming.FormatJSONContent([]interface{}{map[string]interface{}{"quota": status}}, streaming.MessageAnnotationPart); err == nil {
+			send(msg)
 		}
+	}
+
+	finish, err := streaming.FormatJSONContent(streaming.FinishMessage{
+		FinishReason: toFinishReason(completion.FinishReason),
+		Usage: streaming.Usage{
+			PromptTokens:     completion.Usage.PromptTokens,
+			CompletionTokens: completion.Usage.CompletionTokens,
+		},
+	}, streaming.FinishMessagePart)
+	if err == nil {
+		send(finish)
+	}
+}
+
+// ChatError 通过消息注释返回给前端的错误，前端根据 code 提示用户
+type ChatError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"`
+}
+
+// sendError 先以注释返回结构化错误，再发送错误部分及结束消息
+func (c ChatSvc) sendError(send func(string), err error) {
+	chatErr := ChatError{}
+	if dto.IsApiErr(err) {
+		apiErr := dto.FromError(err)
+		chatErr.Code, chatErr.Message = apiErr.Code, apiErr.Message
+	} else {
+		upstreamErr := aisvc.ClassifyError(err)
+		apiErr := upstreamErr.ApiError()
+		chatErr.Code, chatErr.Message, chatErr.Kind = apiErr.Code, apiErr.Message, string(upstreamErr.Kind)
+	}
+	if msg, err := streaming.FormatJSONContent([]interface{}{map[string]interface{}{"error": chatErr}}, streaming.MessageAnnotationPart); err == nil {
+		send(msg)
+	}
+	send(streaming.FormatDataContent(chatErr.Message, streaming.ErrorPart))
+	if msg, err := streaming.FormatJSONContent(streaming.FinishMessage{FinishReason: streaming.FinishReasonError}, streaming.FinishMessagePart); err == nil {
+		send(msg)
+	}
+}
+
+// toFinishReason 将 openai 的 finish_reason 转为流协议中的类型
+func toFinishReason(reason string) streaming.FinishReason {
+	switch reason {
+	case "", "stop":
+		return streaming.FinishReasonStop
+	case "length":
+		return streaming.FinishReasonLength
+	case "content_filter":
+		return streaming.FinishReasonContentFilter
+	case "tool_calls", "function_call":
+		return streaming.FinishReasonToolCalls
+	default:
+		return streaming.FinishReasonOther
+	}
+}
 
-		// 追加新消息到现有对话
-
-		messages := []dto.ChatMessage{
-			{
-				ConversationId: conversationId,
-				Content:        chatInput,
-				Parts: []dto.ContentPart{
-					{
-						Type: "text",
-						Text: chatInput,
-					},
+func (c ChatSvc) saveMessages(userId string, conversationId string, chatInput string, response string) {
+	ctx := context.Background()
+	// 获取现有对话
+	conversation, err := c.chatStore.GetConversation(ctx, userId, conversationId)
+	if err != nil {
+		elog.Error("get conversation failed", zap.Error(err))
+		return
+	}
+	if conversation == nil {
+		elog.Error("conversation not found")
+		return
+	}
+
+	// 追加新消息到现有对话
+
+	messages := []dto.ChatMessage{
+		{
+			ConversationId: conversationId,
+			Content:        chatInput,
+			Parts: []dto.ContentPart{
+				{
+					Type: "text",
+					Text: chatInput,
 				},
-				Role: "user",
 			},
-			{
-				ConversationId: conversationId,
-				Content:        response,
-				Parts: []dto.ContentPart{
-					{
-						Type: "text",
-						Text: response,
-					},
+			Role: "user",
+		},
+		{
+			ConversationId: conversationId,
+			Content:        response,
+			Parts: []dto.ContentPart{
+				{
+					Type: "text",
+					Text: response,
 				},
-				Role: "assistant",
 			},
-		}
-
-		// 更新对话消息
-		err = c.chatStore.AddMessages(ctx, conversationId, messages)
-		if err != nil {
-			elog.Error("update conversation messages failed",
-				zap.Error(err),
-				zap.String("conversationId", conversationId))
-		}
-
-		// 	免费次数更新
-		if isFree {
-			UserFreeTimes(userId)
-		}
-	}(userId, conversationId, isFree)
+			Role: "assistant",
+		},
+	}
 
-	return nil
+	// 更新对话消息
+	err = c.chatStore.AddMessages(ctx, conversationId, messages)
+	if err != nil {
+		elog.Error("update conversation messages failed",
+			zap.Error(err),
+			zap.String("conversationId", conversationId))
+	}
 }
 
 // BreakConversation break conversation
@@ -203,26 +320,24 @@ func (c ChatSvc) DeleteConversation(ctx context.Context, userId string, fileGuid
 	return c.chatStore.DeleteConversation(ctx, userId, fileGuid)
 }
 
-func UserFreeTimes(userId string) {
-	if userId == "" {
-		elog.Error("userId not found:")
-		return
+// JobOptions 后台任务使用的 ai 服务，创建任务时已检查过限流，执行时重新检查试用额度及月度预算
+func (c ChatSvc) JobOptions(ctx context.Context, userId string, trial bool) (ChatOptions, error) {
+	opts := ChatOptions{AiSvc: c.AiSvc, Trial: trial}
+	if trial {
+		if err := c.quotaSvc.Check(ctx, userId); err != nil {
+			return opts, err
+		}
+		opts.AiSvc = c.quotaSvc.TrialAiSvc()
 	}
-	// 请求免费次数信息
-	req, err := http.NewRequest("PUT", fmt.Sprintf("http://localhost:9001/api/auth/%s/free", userId), nil)
+	budget, err := c.usageSvc.CheckBudget(ctx, userId)
 	if err != nil {
-		elog.Error("创建请求失败:", l.E(err))
-		return
+		return opts, err
 	}
-
-	// 创建客户端
-	client := &http.Client{}
-	// 发送请求
-	resp, err := client.Do(req)
-	if err != nil {
-		elog.Error("请求失败:", l.E(err))
-		return
+	if budget.Blocked {
+		return opts, dto.ErrBudgetExceeded
+	}
+	if budget.Downgrade {
+		opts.AiSvc = opts.AiSvc.WithModel(budget.DowngradeModel)
 	}
-	defer resp.Body.Close()
-	return
+	return opts, nil
 }
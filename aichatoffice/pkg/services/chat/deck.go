@@ -0,0 +1,221 @@
+package chatsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/streaming"
+	chartsvc "aichatoffice/pkg/services/chart"
+	docsvc "aichatoffice/pkg/services/doc"
+	"aichatoffice/pkg/utils"
+)
+
+// maxDeckSourceRunes 提示词中参考文档的长度上限
+const maxDeckSourceRunes = 30000
+
+// SlideOutline 大纲中的一页幻灯片，Chart 为可选的 Vega-Lite 图表
+type SlideOutline struct {
+	Layout  string         `json:"layout,omitempty"`
+	Title   string         `json:"title"`
+	Bullets []string       `json:"bullets,omitempty"`
+	Notes   string         `json:"notes,omitempty"`
+	Chart   *chartsvc.Spec `json:"chart,omitempty"`
+}
+
+// DeckRequest 生成演示文稿的参数，Outline 不为空时直接使用，否则由 ai 根据 Prompt 及参考文档生成大纲
+type DeckRequest struct {
+	Name         string
+	Prompt       string
+	SourceFileId string
+	Outline      []SlideOutline
+	Template     []byte
+}
+
+// lineWriter 按行回调模型输出，用于逐行解析 JSON Lines
+type lineWriter struct {
+	buf    bytes.Buffer
+	onLine func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.onLine(line)
+	}
+	return len(p), nil
+}
+
+// Flush 处理最后一行没有换行的内容
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.onLine(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func maxDeckSlides() int {
+	if n := econf.GetInt("deck.maxSlides"); n > 0 {
+		return n
+	}
+	return 20
+}
+
+// GenerateDeck 生成演示文稿并保存为新文件。每生成一页发送一个步骤，步骤中以数据部分返回该页的大纲，
+// 全部完成后以数据部分返回新文件的信息
+func (c ChatSvc) GenerateDeck(ctx context.Context, userId string, req DeckRequest, event chan<- string, opts ChatOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer close(event)
+	send := func(msg string) {
+		select {
+		case event <- msg:
+		case <-ctx.Done():
+		}
+	}
+	aiSvc := opts.AiSvc
+	if aiSvc == nil {
+		aiSvc = c.AiSvc
+	}
+
+	limit := maxDeckSlides()
+	var slides []docsvc.DeckSlide
+	addSlide := func(o SlideOutline) {
+		if len(slides) >= limit || (o.Title == "" && len(o.Bullets) == 0) {
+			return
+		}
+		slide := docsvc.DeckSlide{Layout: o.Layout, Title: o.Title, Bullets: o.Bullets, Notes: o.Notes}
+		if slide.Layout == "" {
+			slide.Layout = docsvc.SlideLayoutContent
+		}
+		if o.Chart != nil {
+			// 图表定义不合法时只保留文字内容
+			if err := o.Chart.Validate(); err != nil {
+				elog.Warn("invalid slide chart", zap.Error(err), zap.String("title", o.Title))
+				o.Chart = nil
+			} else if slide.Image, err = chartsvc.RenderPNG(o.Chart); err != nil {
+				elog.Warn("render slide chart failed", zap.Error(err), zap.String("title", o.Title))
+				o.Chart = nil
+			}
+		}
+		slides = append(slides, slide)
+
+		messageId, _ := utils.NewGuid(16)
+		sendPart(send, streaming.StartStep{MessageId: messageId}, streaming.StartStepPart)
+		sendPart(send, []interface{}{map[string]interface{}{"slide": map[string]interface{}{"index": len(slides) - 1, "outline": o}}}, streaming.DataPart)
+		sendPart(send, streaming.FinishStep{FinishReason: streaming.FinishReasonStop, IsContinued: true}, streaming.FinishStepPart)
+	}
+
+	name := req.Name
+	if len(req.Outline) > 0 {
+		for _, o := range req.Outline {
+			addSlide(o)
+		}
+		if err := c.saveDeck(ctx, send, userId, name, req.Template, slides); err != nil {
+			return err
+		}
+		sendPart(send, streaming.FinishMessage{FinishReason: streaming.FinishReasonStop}, streaming.FinishMessagePart)
+		return nil
+	}
+
+	var source string
+	if req.SourceFileId != "" {
+		file, doc, err := c.docSvc.Load(ctx, req.SourceFileId)
+		if err != nil {
+			c.sendError(send, err)
+			return err
+		}
+		source = fmt.Sprintf("《%s》\n%s", file.Name, clipRunes(doc.Text(), maxDeckSourceRunes))
+		if name == "" {
+			name = strings.TrimSuffix(file.Name, file.Ext)
+		}
+	}
+
+	w := &lineWriter{onLine: func(line string) {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			// 忽略代码块标记等非 JSON 内容
+			return
+		}
+		var o SlideOutline
+		if err := json.Unmarshal([]byte(line), &o); err != nil {
+			elog.Warn("parse slide outline failed", zap.Error(err), zap.String("line", line))
+			return
+		}
+		addSlide(o)
+	}}
+	completion, err := aiSvc.CompletionsStream(ctx, deckPrompt(req.Prompt, source, limit), utils.NewTeeWriter(w))
+	if err != nil {
+		elog.Error("generate deck outline failed", zap.Error(err), elog.FieldCtxTid(ctx))
+		c.recordFailedUsage(ctx, userId, "", completion, opts)
+		c.sendError(send, err)
+		return err
+	}
+	w.Flush()
+	if len(slides) == 0 {
+		c.recordFailedUsage(ctx, userId, "", completion, opts)
+		c.sendError(send, dto.ErrContentHandle)
+		return dto.ErrContentHandle
+	}
+	if err := c.saveDeck(ctx, send, userId, name, req.Template, slides); err != nil {
+		c.recordFailedUsage(ctx, userId, "", completion, opts)
+		return err
+	}
+	c.finishMessage(ctx, send, userId, "", completion, opts)
+	return nil
+}
+
+// saveDeck 生成 pptx 并保存为新文件，以数据部分返回文件信息
+func (c ChatSvc) saveDeck(ctx context.Context, send func(string), userId string, name string, template []byte, slides []docsvc.DeckSlide) error {
+	if name == "" && len(slides) > 0 {
+		name = slides[0].Title
+	}
+	if name == "" {
+		name = "presentation"
+	}
+	if !strings.EqualFold(filepath.Ext(name), ".pptx") {
+		name += ".pptx"
+	}
+	content, err := docsvc.BuildDeck(template, slides)
+	if err != nil {
+		elog.Error("build deck failed", zap.Error(err))
+		c.sendError(send, err)
+		return err
+	}
+	file, err := c.docSvc.CreateFile(ctx, name, userId, content)
+	if err != nil {
+		c.sendError(send, err)
+		return err
+	}
+	sendPart(send, []interface{}{map[string]interface{}{"file": file}}, streaming.DataPart)
+	return nil
+}
+
+// deckPrompt 要求模型逐行输出每页幻灯片的 JSON，便于边生成边返回进度
+func deckPrompt(prompt string, source string, limit int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "请为演示文稿撰写大纲，不超过 %d 页。每页输出一行 JSON（JSON Lines），不要输出其他内容，也不要使用代码块。\n", limit)
+	b.WriteString(`每行的格式：{"layout":"title|section|content","title":"标题","bullets":["要点"],"notes":"演讲者备注","chart":{Vega-Lite 定义}}` + "\n")
+	b.WriteString("第一页为 title 版式，bullets 中写副标题；章节过渡页使用 section 版式；其余为 content 版式，每页 3 到 6 个简洁的要点，下一级要点以两个空格开头。\n")
+	b.WriteString(`资料中有适合图表展示的数据时可以加入 chart，只支持单视图、data.values 内联数据，mark 为 bar、line、point、area、arc，encoding 支持 x、y、color、theta。` + "\n")
+	if prompt != "" {
+		fmt.Fprintf(&b, "要求：\n%s\n", prompt)
+	}
+	if source != "" {
+		fmt.Fprintf(&b, "参考资料：\n%s\n", source)
+	}
+	return b.String()
+}
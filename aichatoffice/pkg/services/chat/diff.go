@@ -0,0 +1,93 @@
+package chatsvc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/streaming"
+	docsvc "aichatoffice/pkg/services/doc"
+	"aichatoffice/pkg/utils"
+)
+
+const (
+	// maxDiffPromptRunes 提示词中变更列表的长度上限
+	maxDiffPromptRunes = 12000
+	maxDiffTextRunes   = 300
+)
+
+// SummarizeDiff 先以数据部分发送结构化的变更列表，再流式输出 ai 撰写的变更总结
+func (c ChatSvc) SummarizeDiff(ctx context.Context, userId string, diff *docsvc.DiffResult, event chan<- string, opts ChatOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer close(event)
+	send := func(msg string) {
+		select {
+		case event <- msg:
+		case <-ctx.Done():
+		}
+	}
+	aiSvc := opts.AiSvc
+	if aiSvc == nil {
+		aiSvc = c.AiSvc
+	}
+
+	sendPart(send, []interface{}{map[string]interface{}{"diff": diff}}, streaming.DataPart)
+	if len(diff.Changes) == 0 {
+		send(streaming.FormatDataContent("两个版本的内容没有差异。", streaming.TextPart))
+		sendPart(send, streaming.FinishMessage{FinishReason: streaming.FinishReasonStop}, streaming.FinishMessagePart)
+		return nil
+	}
+
+	teeWriter := utils.NewTeeWriter(partWriter{send: send, part: streaming.TextPart})
+	completion, err := aiSvc.CompletionsStream(ctx, diffPrompt(diff), teeWriter)
+	if err != nil {
+		elog.Error("summarize diff failed", zap.Error(err), elog.FieldCtxTid(ctx))
+		c.recordFailedUsage(ctx, userId, "", completion, opts)
+		c.sendError(send, err)
+		return err
+	}
+	c.finishMessage(ctx, send, userId, "", completion, opts)
+	return nil
+}
+
+// diffPrompt 把变更列表写成提示词，过长的文本及列表截断
+func diffPrompt(diff *docsvc.DiffResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "请用简洁的中文总结文档的修改内容，先概括整体变化，再按重要程度列出主要修改，不要逐条复述所有变更。\n")
+	if diff.From.FileId == diff.To.FileId {
+		fmt.Fprintf(&b, "文件《%s》从版本 %d 修改为版本 %d", diff.To.Name, diff.From.Version, diff.To.Version)
+	} else {
+		fmt.Fprintf(&b, "文件《%s》（版本 %d）与文件《%s》（版本 %d）相比", diff.From.Name, diff.From.Version, diff.To.Name, diff.To.Version)
+	}
+	fmt.Fprintf(&b, "，新增 %d 处，删除 %d 处，修改 %d 处：\n", diff.Stats.Added, diff.Stats.Removed, diff.Stats.Modified)
+	runes := 0
+	for i, change := range diff.Changes {
+		line := fmt.Sprintf("- [%s %s] %s", change.Type, change.Kind, change.Location)
+		if change.Before != "" {
+			line += "\n  原文：" + clipRunes(change.Before, maxDiffTextRunes)
+		}
+		if change.After != "" {
+			line += "\n  新文：" + clipRunes(change.After, maxDiffTextRunes)
+		}
+		runes += utf8.RuneCountInString(line)
+		if runes > maxDiffPromptRunes {
+			fmt.Fprintf(&b, "……其余 %d 处变更省略\n", len(diff.Changes)-i)
+			break
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func clipRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
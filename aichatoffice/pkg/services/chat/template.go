@@ -0,0 +1,146 @@
+package chatsvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	aisvc "aichatoffice/pkg/services/ai"
+	"aichatoffice/pkg/utils"
+)
+
+// maxTemplateSourceRunes 提示词中参考文档的长度上限
+const maxTemplateSourceRunes = 20000
+
+// TemplateFill 需要 ai 填写的模板字段及参考资料
+type TemplateFill struct {
+	Fields       []dto.TemplateField
+	Data         map[string]interface{} // 已提供的数据，作为上下文
+	Prompt       string
+	SourceFileId string
+}
+
+// FillTemplate 让 ai 按字段结构输出 JSON，只返回 Fields 中的字段
+func (c ChatSvc) FillTemplate(ctx context.Context, userId string, req TemplateFill, opts ChatOptions) (map[string]interface{}, error) {
+	aiSvc := opts.AiSvc
+	if aiSvc == nil {
+		aiSvc = c.AiSvc
+	}
+	var source string
+	if req.SourceFileId != "" {
+		file, doc, err := c.docSvc.Load(ctx, req.SourceFileId)
+		if err != nil {
+			return nil, err
+		}
+		source = fmt.Sprintf("《%s》\n%s", file.Name, clipRunes(doc.Text(), maxTemplateSourceRunes))
+	}
+	prompt, err := templatePrompt(req, source)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := aiSvc.ChatStream(ctx, aisvc.ChatRequest{
+		Messages: []aisvc.Message{
+			{Role: aisvc.RoleSystem, Content: "你负责根据资料填写报告模板，只输出一个 JSON 对象，不要输出其他内容。"},
+			{Role: aisvc.RoleUser, Content: prompt},
+		},
+	}, utils.NewTeeWriter(io.Discard))
+	if err != nil {
+		elog.Error("fill template failed", zap.Error(err), elog.FieldCtxTid(ctx))
+		c.recordFailedUsage(ctx, userId, "", res.Completion, opts)
+		return nil, err
+	}
+	c.recordUsage(ctx, userId, "", res.Completion, opts)
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(stripCodeFence(res.Content)), &values); err != nil {
+		elog.Error("parse template values failed", zap.Error(err), zap.String("content", res.Content))
+		return nil, dto.ErrContentHandle
+	}
+	filled := map[string]interface{}{}
+	for _, f := range req.Fields {
+		key := strings.SplitN(f.Name, ".", 2)[0]
+		if v, ok := values[key]; ok {
+			filled[key] = v
+		}
+	}
+	return filled, nil
+}
+
+// templatePrompt 以示例 JSON 描述需要填写的字段结构
+func templatePrompt(req TemplateFill, source string) (string, error) {
+	example := map[string]interface{}{}
+	for _, f := range req.Fields {
+		setPath(example, f.Name, fieldExample(f))
+	}
+	exampleJson, err := json.MarshalIndent(example, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("请填写以下报告模板字段，输出的 JSON 结构与示例一致：字符串字段填写文本，可以包含换行；布尔字段表示对应内容是否出现；数组字段按资料列出所有条目。资料中没有的信息留空，不要编造。\n")
+	fmt.Fprintf(&b, "示例：\n%s\n", exampleJson)
+	if len(req.Data) > 0 {
+		if data, err := json.Marshal(req.Data); err == nil {
+			fmt.Fprintf(&b, "已知字段：\n%s\n", data)
+		}
+	}
+	if req.Prompt != "" {
+		fmt.Fprintf(&b, "要求：\n%s\n", req.Prompt)
+	}
+	if source != "" {
+		fmt.Fprintf(&b, "参考资料：\n%s\n", source)
+	}
+	return b.String(), nil
+}
+
+func fieldExample(f dto.TemplateField) interface{} {
+	switch f.Type {
+	case dto.TemplateFieldBool:
+		return false
+	case dto.TemplateFieldList:
+		if len(f.Fields) == 0 {
+			return []interface{}{""}
+		}
+		item := map[string]interface{}{}
+		for _, child := range f.Fields {
+			setPath(item, child.Name, fieldExample(child))
+		}
+		return []interface{}{item}
+	default:
+		return ""
+	}
+}
+
+// setPath 按 a.b 路径写入嵌套对象
+func setPath(m map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := m[p].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[p] = child
+		}
+		m = child
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// stripCodeFence 去掉模型输出中包裹 JSON 的 markdown 代码块
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
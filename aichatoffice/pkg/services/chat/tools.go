@@ -0,0 +1,512 @@
+package chatsvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	aisvc "aichatoffice/pkg/services/ai"
+	chartsvc "aichatoffice/pkg/services/chart"
+	docsvc "aichatoffice/pkg/services/doc"
+)
+
+const (
+	toolSearchDocument  = "search_document"
+	toolReadSection     = "read_section"
+	toolListSheets      = "list_sheets"
+	toolReadRange       = "read_range"
+	toolGetFileMetadata = "get_file_metadata"
+	toolEditDocument    = "edit_document"
+	toolQuerySheet      = "query_spreadsheet"
+	toolCreateChart     = "create_chart"
+
+	maxSearchHits    = 20
+	maxSectionRunes  = 8000
+	maxRangeCells    = 500
+	defaultHitsLimit = 10
+	// maxSchemaColumns 工具描述中每张表最多列出的列数
+	maxSchemaColumns    = 50
+	defaultQueryRows    = 200
+	defaultQueryTimeout = 5 * time.Second
+	// maxChartRows 图表数据的最大行数
+	maxChartRows = 5000
+)
+
+func queryTimeout() time.Duration {
+	timeout := econf.GetDuration("userChat.queryTimeout")
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	return timeout
+}
+
+// toolHandler 执行工具，args 为模型给出的 JSON 参数
+type toolHandler func(ctx context.Context, args json.RawMessage) (interface{}, error)
+
+// toolSet 提供给模型的一组工具
+type toolSet struct {
+	defs     []aisvc.Tool
+	handlers map[string]toolHandler
+	closers  []func()
+}
+
+func newToolSet() *toolSet {
+	return &toolSet{handlers: map[string]toolHandler{}}
+}
+
+func (t *toolSet) register(def aisvc.Tool, handler toolHandler) {
+	t.defs = append(t.defs, def)
+	t.handlers[def.Name] = handler
+}
+
+// onClose 对话结束时释放工具占用的资源
+func (t *toolSet) onClose(fn func()) {
+	t.closers = append(t.closers, fn)
+}
+
+func (t *toolSet) Close() {
+	for _, fn := range t.closers {
+		fn()
+	}
+}
+
+// annotated 需要额外以消息注释发送给前端的工具结果
+type annotated interface {
+	Annotation() interface{}
+}
+
+// dataResult 需要额外以数据部分发送给前端的工具结果，如查询结果表格
+type dataResult interface {
+	Data() interface{}
+}
+
+// toolError 工具执行失败时返回给模型的结果，模型可以据此调整参数
+type toolError struct {
+	Error string `json:"error"`
+}
+
+// call 执行工具调用，错误也作为结果返回给模型
+func (t *toolSet) call(ctx context.Context, call aisvc.ToolCall) interface{} {
+	handler, ok := t.handlers[call.Name]
+	if !ok {
+		return toolError{Error: fmt.Sprintf("unknown tool %s", call.Name)}
+	}
+	args := json.RawMessage(call.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	res, err := handler(ctx, args)
+	if err != nil {
+		elog.Warn("tool call failed", zap.Error(err), zap.String("tool", call.Name), zap.String("args", call.Arguments))
+		return toolError{Error: err.Error()}
+	}
+	return res
+}
+
+// docState 对话关联的文件，编辑后更新为新版本
+type docState struct {
+	file dto.FileMeta
+	doc  *docsvc.Document
+	// sql 工作表加载到的内存库，首次查询时创建，文件修改后重建
+	sql *docsvc.SqlDB
+}
+
+func (s *docState) sqlDB(ctx context.Context) (*docsvc.SqlDB, error) {
+	if s.sql != nil {
+		return s.sql, nil
+	}
+	db, err := docsvc.LoadSql(ctx, s.doc)
+	if err != nil {
+		return nil, err
+	}
+	s.sql = db
+	return db, nil
+}
+
+func (s *docState) update(file dto.FileMeta, doc *docsvc.Document) {
+	s.close()
+	s.file, s.doc = file, doc
+}
+
+func (s *docState) close() {
+	if s.sql != nil {
+		s.sql.Close()
+		s.sql = nil
+	}
+}
+
+// documentTools 当前对话文件上的工具，docx、xlsx 额外提供编辑工具
+func (c ChatSvc) documentTools(state *docState, userId string) *toolSet {
+	tools := newToolSet()
+	tools.onClose(state.close)
+	tools.register(aisvc.Tool{
+		Name:        toolGetFileMetadata,
+		Description: "获取当前文件的元信息：文件名、类型、大小、版本、章节及工作表数量",
+		Parameters:  objectSchema(nil),
+	}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		sheets := make([]string, 0, len(state.doc.Sheets))
+		for _, s := range state.doc.Sheets {
+			sheets = append(sheets, s.Name)
+		}
+		return map[string]interface{}{
+			"name":       state.file.Name,
+			"ext":        state.file.Ext,
+			"kind":       state.doc.Kind,
+			"size":       state.file.Size,
+			"version":    state.file.Version,
+			"createTime": state.file.CreateTime,
+			"modifyTime": state.file.ModifyTime,
+			"sections":   len(state.doc.Sections),
+			"sheets":     sheets,
+		}, nil
+	})
+	tools.register(aisvc.Tool{
+		Name:        toolSearchDocument,
+		Description: "在当前文件中按关键词搜索，返回命中的章节段落或单元格及上下文片段",
+		Parameters: objectSchema(map[string]interface{}{
+			"query": stringProp("搜索关键词，多个关键词用空格分隔"),
+			"limit": integerProp(fmt.Sprintf("返回结果数量，默认 %d，最大 %d", defaultHitsLimit, maxSearchHits)),
+		}, "query"),
+	}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		var req struct {
+			Query string `json:"query"`
+			Limit int    `json:"limit"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		if req.Limit <= 0 {
+			req.Limit = defaultHitsLimit
+		}
+		if req.Limit > maxSearchHits {
+			req.Limit = maxSearchHits
+		}
+		return map[string]interface{}{"hits": state.doc.Search(req.Query, req.Limit)}, nil
+	})
+	if len(state.doc.Sections) > 0 {
+		tools.register(aisvc.Tool{
+			Name:        toolReadSection,
+			Description: "读取指定章节的全部段落；index 从 0 开始，不传 index 时返回章节目录",
+			Parameters: objectSchema(map[string]interface{}{
+				"index": integerProp("章节序号，从 0 开始"),
+			}),
+		}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			var req struct {
+				Index *int `json:"index"`
+			}
+			if err := json.Unmarshal(args, &req); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+			if req.Index == nil {
+				return map[string]interface{}{"outline": outline(state.doc)}, nil
+			}
+			if *req.Index < 0 || *req.Index >= len(state.doc.Sections) {
+				return nil, fmt.Errorf("section index out of range [0, %d)", len(state.doc.Sections))
+			}
+			return truncateSection(state.doc.Sections[*req.Index]), nil
+		})
+	}
+	if len(state.doc.Sheets) > 0 {
+		tools.register(aisvc.Tool{
+			Name:        toolListSheets,
+			Description: "列出工作表及其行列数和首行内容",
+			Parameters:  objectSchema(nil),
+		}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			sheets := make([]map[string]interface{}, 0, len(state.doc.Sheets))
+			for _, s := range state.doc.Sheets {
+				rows, cols := s.Size()
+				var header []string
+				if rows > 0 {
+					header = s.Rows[0]
+				}
+				sheets = append(sheets, map[string]interface{}{
+					"name":   s.Name,
+					"rows":   rows,
+					"cols":   cols,
+					"header": header,
+				})
+			}
+			return map[string]interface{}{"sheets": sheets}, nil
+		})
+		tools.register(aisvc.Tool{
+			Name:        toolReadRange,
+			Description: fmt.Sprintf("读取工作表中指定范围的单元格值，例如 A1:D20，单次最多 %d 个单元格", maxRangeCells),
+			Parameters: objectSchema(map[string]interface{}{
+				"sheet": stringProp("工作表名称，不传时使用第一个工作表"),
+				"range": stringProp("单元格范围，例如 A1:D20"),
+			}, "range"),
+		}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			var req struct {
+				Sheet string `json:"sheet"`
+				Range string `json:"range"`
+			}
+			if err := json.Unmarshal(args, &req); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+			sheet, ok := state.doc.Sheet(req.Sheet)
+			if !ok {
+				return nil, fmt.Errorf("sheet %q not found", req.Sheet)
+			}
+			r, err := docsvc.ParseRange(req.Range)
+			if err != nil {
+				return nil, err
+			}
+			// 超过上限时截断行数
+			cols := r.To.Col - r.From.Col + 1
+			if cols*(r.To.Row-r.From.Row+1) > maxRangeCells {
+				if cols > maxRangeCells {
+					return nil, fmt.Errorf("range too wide, at most %d cells", maxRangeCells)
+				}
+				r.To.Row = r.From.Row + maxRangeCells/cols - 1
+			}
+			return map[string]interface{}{
+				"sheet":  sheet.Name,
+				"range":  r.String(),
+				"values": sheet.Range(r),
+			}, nil
+		})
+		maxRows := econf.GetInt("userChat.queryMaxRows")
+		if maxRows <= 0 {
+			maxRows = defaultQueryRows
+		}
+		timeout := queryTimeout()
+		tools.register(aisvc.Tool{
+			Name: toolQuerySheet,
+			Description: "用 SQLite 的 SELECT 语句查询工作表数据，求和、平均、计数、排序、筛选等计算必须使用本工具，不要自己计算。" +
+				fmt.Sprintf("只允许只读查询，最多返回 %d 行。每个工作表对应一张表，列名需用双引号括起来，空单元格为 NULL：\n%s", maxRows, tableSchema(docsvc.SqlTables(state.doc))),
+			Parameters: objectSchema(map[string]interface{}{
+				"sql": stringProp("SELECT 查询语句"),
+			}, "sql"),
+		}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			var req struct {
+				Sql string `json:"sql"`
+			}
+			if err := json.Unmarshal(args, &req); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+			if strings.TrimSpace(req.Sql) == "" {
+				return nil, fmt.Errorf("sql is required")
+			}
+			db, err := state.sqlDB(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res, err := db.Query(ctx, req.Sql, maxRows, timeout)
+			if err != nil {
+				return nil, err
+			}
+			return tableResult{QueryResult: res, Sql: req.Sql}, nil
+		})
+	}
+	tools.register(aisvc.Tool{
+		Name: toolCreateChart,
+		Description: "根据数据生成图表，图表会展示给用户并保存为 SVG、PNG 图片，可插入文档。spec 为 Vega-Lite 定义，" +
+			"mark 支持 bar、line、point、area、arc（饼图），encoding 支持 x、y、color、theta，aggregate 支持 sum、mean、count、min、max。" +
+			"数据来自工作表时传 sql，由查询结果作为 data.values，字段名为查询结果的列名；否则在 spec.data.values 中给出数据。",
+		Parameters: objectSchema(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"type":        "object",
+				"description": `Vega-Lite 定义，例如 {"title":"各地区销售额","mark":"bar","encoding":{"x":{"field":"region","type":"nominal"},"y":{"field":"total","type":"quantitative"}}}`,
+			},
+			"sql": stringProp("可选，查询工作表数据的 SELECT 语句，与 query_spreadsheet 相同"),
+		}, "spec"),
+	}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		var req struct {
+			Spec json.RawMessage `json:"spec"`
+			Sql  string          `json:"sql"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		var spec chartsvc.Spec
+		if err := json.Unmarshal(req.Spec, &spec); err != nil {
+			return nil, fmt.Errorf("%w: %v", chartsvc.ErrInvalidSpec, err)
+		}
+		if strings.TrimSpace(req.Sql) != "" {
+			if len(state.doc.Sheets) == 0 {
+				return nil, fmt.Errorf("sql is only supported for spreadsheets")
+			}
+			db, err := state.sqlDB(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res, err := db.Query(ctx, req.Sql, maxChartRows, queryTimeout())
+			if err != nil {
+				return nil, err
+			}
+			spec.Data.Values = res.Records()
+		}
+		chart, err := c.chartSvc.Save(ctx, state.file.FileID, &spec)
+		if err != nil {
+			return nil, err
+		}
+		return chartResult{chart}, nil
+	})
+	if state.doc.Kind == docsvc.KindDocx || state.doc.Kind == docsvc.KindXlsx {
+		tools.register(aisvc.Tool{
+			Name: toolEditDocument,
+			Description: "直接修改当前文件并保存为新版本。用户要求改写、补充、修改文档或表格时使用，不要只在回复中给出修改后的文本。" +
+				"docx 支持 replace_text（section、paragraph 定位段落，paragraph 为 -1 表示章节标题；find 为要替换的原文，不传时替换整段；text 为新文本）" +
+				"和 insert_paragraph（在 section 的 paragraph 之后插入 text，不传 paragraph 时插入到章节末尾）；" +
+				"xlsx 支持 set_cell（sheet、cell、value，value 以 = 开头时写入公式）和 add_row（sheet、values 追加一行）。" +
+				"修改前请先用 read_section 或 read_range 确认位置。",
+			Parameters: objectSchema(map[string]interface{}{
+				"ops": map[string]interface{}{
+					"type":        "array",
+					"description": "按顺序执行的编辑操作",
+					"items": objectSchema(map[string]interface{}{
+						"op": map[string]interface{}{
+							"type": "string",
+							"enum": []string{docsvc.EditReplaceText, docsvc.EditInsertParagraph, docsvc.EditSetCell, docsvc.EditAddRow},
+						},
+						"section":   integerProp("章节序号"),
+						"paragraph": integerProp("章节内段落序号，-1 表示章节标题"),
+						"find":      stringProp("要替换的原文"),
+						"text":      stringProp("新文本"),
+						"sheet":     stringProp("工作表名称"),
+						"cell":      stringProp("单元格，例如 B3"),
+						"value":     stringProp("单元格的值"),
+						"values": map[string]interface{}{
+							"type":  "array",
+							"items": map[string]interface{}{"type": "string"},
+						},
+					}, "op"),
+				},
+			}, "ops"),
+		}, func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			var req struct {
+				Ops []docsvc.EditOp `json:"ops"`
+			}
+			if err := json.Unmarshal(args, &req); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+			if len(req.Ops) == 0 {
+				return nil, fmt.Errorf("ops is required")
+			}
+			res, err := c.docSvc.Edit(ctx, state.file.FileID, userId, req.Ops)
+			if err != nil {
+				return nil, err
+			}
+			// 后续工具读取编辑后的内容
+			if file, doc, err := c.docSvc.Load(ctx, state.file.FileID); err == nil {
+				state.update(file, doc)
+			}
+			return editResult{res}, nil
+		})
+	}
+	return tools
+}
+
+// editResult 编辑结果，同时以消息注释发给前端展示差异摘要及预览链接
+type editResult struct {
+	*docsvc.EditResult
+}
+
+func (r editResult) Annotation() interface{} {
+	return map[string]interface{}{"edit": r.EditResult}
+}
+
+// tableResult 查询结果，同时以数据部分发给前端展示为表格
+type tableResult struct {
+	*docsvc.QueryResult
+	Sql string `json:"sql"`
+}
+
+func (r tableResult) Data() interface{} {
+	return map[string]interface{}{"table": r}
+}
+
+// tableSchema 工具描述中的表结构，例如 "需求排期"("需求" TEXT -- A, ...) 12 行
+func tableSchema(tables []docsvc.SqlTable) string {
+	var b strings.Builder
+	for _, t := range tables {
+		columns := make([]string, 0, len(t.Columns))
+		for i, c := range t.Columns {
+			if i >= maxSchemaColumns {
+				columns = append(columns, fmt.Sprintf("...共 %d 列", len(t.Columns)))
+				break
+			}
+			columns = append(columns, fmt.Sprintf("%q %s -- %s", c.Name, c.Type, c.Cell))
+		}
+		fmt.Fprintf(&b, "%q(%s) %d 行，来自工作表 %s\n", t.Name, strings.Join(columns, ", "), t.Rows, t.Sheet)
+	}
+	return b.String()
+}
+
+// chartResult 生成的图表，完整定义以数据部分发给前端，返回给模型的只有图片信息
+type chartResult struct {
+	*chartsvc.Chart
+}
+
+func (r chartResult) Data() interface{} {
+	return map[string]interface{}{"chart": r.Chart}
+}
+
+func (r chartResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"id": r.Id, "assets": r.Assets})
+}
+
+type sectionOutline struct {
+	Index      int    `json:"index"`
+	Title      string `json:"title"`
+	Level      int    `json:"level"`
+	Paragraphs int    `json:"paragraphs"`
+}
+
+func outline(doc *docsvc.Document) []sectionOutline {
+	res := make([]sectionOutline, 0, len(doc.Sections))
+	for _, s := range doc.Sections {
+		res = append(res, sectionOutline{Index: s.Index, Title: s.Title, Level: s.Level, Paragraphs: len(s.Paragraphs)})
+	}
+	return res
+}
+
+// truncateSection 章节过长时截断，避免超出上下文
+func truncateSection(s docsvc.Section) map[string]interface{} {
+	res := map[string]interface{}{"index": s.Index, "title": s.Title, "level": s.Level}
+	runes := 0
+	for i, p := range s.Paragraphs {
+		runes += utf8.RuneCountInString(p)
+		if runes > maxSectionRunes {
+			kept := s.Paragraphs[:i]
+			if i == 0 {
+				kept = []string{string([]rune(p)[:maxSectionRunes])}
+			}
+			res["paragraphs"] = kept
+			res["truncated"] = true
+			return res
+		}
+	}
+	res["paragraphs"] = s.Paragraphs
+	return res
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProp(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func integerProp(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "description": description}
+}
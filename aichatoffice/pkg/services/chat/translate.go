@@ -0,0 +1,89 @@
+package chatsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	aisvc "aichatoffice/pkg/services/ai"
+	"aichatoffice/pkg/utils"
+)
+
+// ErrTranslationMismatch 模型返回的译文条数与原文不一致
+var ErrTranslationMismatch = errors.New("translation count mismatch")
+
+// TranslateBatch 一批需要翻译的文本，Glossary 为固定译法的术语，译文为空表示保留原文
+type TranslateBatch struct {
+	Texts      []string
+	TargetLang string
+	Glossary   map[string]string
+}
+
+// Translate 翻译一批文本，返回与 Texts 一一对应的译文
+func (c ChatSvc) Translate(ctx context.Context, userId string, req TranslateBatch, opts ChatOptions) ([]string, error) {
+	aiSvc := opts.AiSvc
+	if aiSvc == nil {
+		aiSvc = c.AiSvc
+	}
+	if opts.Trial {
+		if err := c.quotaSvc.Check(ctx, userId); err != nil {
+			return nil, err
+		}
+	}
+	input, err := json.Marshal(req.Texts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := aiSvc.ChatStream(ctx, aisvc.ChatRequest{
+		Messages: []aisvc.Message{
+			{Role: aisvc.RoleSystem, Content: translatePrompt(req)},
+			{Role: aisvc.RoleUser, Content: string(input)},
+		},
+	}, utils.NewTeeWriter(io.Discard))
+	if err != nil {
+		elog.Error("translate failed", zap.Error(err), elog.FieldCtxTid(ctx))
+		c.recordFailedUsage(ctx, userId, "", res.Completion, opts)
+		return nil, err
+	}
+	c.recordUsage(ctx, userId, "", res.Completion, opts)
+
+	var translated []string
+	if err := json.Unmarshal([]byte(stripCodeFence(res.Content)), &translated); err != nil {
+		elog.Warn("parse translation failed", zap.Error(err), zap.String("content", res.Content))
+		return nil, fmt.Errorf("%w: %v", ErrTranslationMismatch, err)
+	}
+	if len(translated) != len(req.Texts) {
+		return nil, fmt.Errorf("%w: expect %d, got %d", ErrTranslationMismatch, len(req.Texts), len(translated))
+	}
+	return translated, nil
+}
+
+// translatePrompt 要求模型逐项翻译 JSON 数组，术语按固定译法
+func translatePrompt(req TranslateBatch) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "你是专业的翻译。用户会发送一个 JSON 字符串数组，请把每一项翻译为 %s，输出同样长度、同样顺序的 JSON 字符串数组，不要合并或拆分条目，不要输出其他内容。\n", req.TargetLang)
+	b.WriteString("保留原文中的数字、网址、邮箱、代码及 {{name}} 等占位符；已经是目标语言的内容原样输出。\n")
+	if len(req.Glossary) > 0 {
+		terms := make([]string, 0, len(req.Glossary))
+		for term := range req.Glossary {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		b.WriteString("术语表，出现时必须使用给定的译法：\n")
+		for _, term := range terms {
+			if target := req.Glossary[term]; target != "" {
+				fmt.Fprintf(&b, "- %s => %s\n", term, target)
+			} else {
+				fmt.Fprintf(&b, "- %s => 保留原文\n", term)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package docsvc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CellRef 单元格坐标，行列均从 0 开始
+type CellRef struct {
+	Row int
+	Col int
+}
+
+func (r CellRef) String() string {
+	return ColumnName(r.Col) + strconv.Itoa(r.Row+1)
+}
+
+// CellRange 闭区间的单元格范围
+type CellRange struct {
+	From CellRef
+	To   CellRef
+}
+
+func (r CellRange) String() string {
+	return r.From.String() + ":" + r.To.String()
+}
+
+// ColumnName 列序号转列名，0 -> A，26 -> AA
+func ColumnName(col int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name
+}
+
+// ColumnIndex 列名转列序号，A -> 0
+func ColumnIndex(name string) (int, error) {
+	if name == "" {
+		return 0, fmt.Errorf("empty column name")
+	}
+	col := 0
+	for _, ch := range strings.ToUpper(name) {
+		if ch < 'A' || ch > 'Z' {
+			return 0, fmt.Errorf("invalid column name %q", name)
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1, nil
+}
+
+// ParseCellRef 解析 A1 形式的坐标，忽略 $ 绝对引用符号
+func ParseCellRef(ref string) (CellRef, error) {
+	ref = strings.ReplaceAll(strings.TrimSpace(ref), "$", "")
+	i := 0
+	for i < len(ref) && (ref[i] < '0' || ref[i] > '9') {
+		i++
+	}
+	col, err := ColumnIndex(ref[:i])
+	if err != nil {
+		return CellRef{}, err
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if err != nil || row < 1 {
+		return CellRef{}, fmt.Errorf("invalid cell ref %q", ref)
+	}
+	return CellRef{Row: row - 1, Col: col}, nil
+}
+
+// ParseRange 解析 A1:C10 或单个单元格，返回的范围保证 From 在左上
+func ParseRange(s string) (CellRange, error) {
+	parts := strings.SplitN(s, ":", 2)
+	from, err := ParseCellRef(parts[0])
+	if err != nil {
+		return CellRange{}, err
+	}
+	to := from
+	if len(parts) == 2 {
+		if to, err = ParseCellRef(parts[1]); err != nil {
+			return CellRange{}, err
+		}
+	}
+	if to.Row < from.Row {
+		from.Row, to.Row = to.Row, from.Row
+	}
+	if to.Col < from.Col {
+		from.Col, to.Col = to.Col, from.Col
+	}
+	return CellRange{From: from, To: to}, nil
+}
@@ -0,0 +1,795 @@
+package docsvc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gotomicro/ego/core/econf"
+)
+
+// 生成幻灯片时选用的版式
+const (
+	SlideLayoutTitle   = "title"
+	SlideLayoutSection = "section"
+	SlideLayoutContent = "content"
+)
+
+const (
+	relTypePrefix     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+	relsNamespace     = "http://schemas.openxmlformats.org/package/2006/relationships"
+	contentTypesPart  = "[Content_Types].xml"
+	slideContentType  = "application/vnd.openxmlformats-officedocument.presentationml.slide+xml"
+	notesContentType  = "application/vnd.openxmlformats-officedocument.presentationml.notesSlide+xml"
+	notesMasterCType  = "application/vnd.openxmlformats-officedocument.presentationml.notesMaster+xml"
+	themeContentType  = "application/vnd.openxmlformats-officedocument.theme+xml"
+	pmlNamespaceAttrs = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+)
+
+var (
+	ErrInvalidDeckTemplate = errors.New("invalid deck template")
+
+	sldIdLstRe    = regexp.MustCompile(`(?s)<(\w+:)?sldIdLst\b[^>]*?/>|<(\w+:)?sldIdLst\b[^>]*>.*?</(\w+:)?sldIdLst>`)
+	sectionLstRe  = regexp.MustCompile(`(?s)<(\w+:)?sectionLst\b.*?</(\w+:)?sectionLst>`)
+	custShowLstRe = regexp.MustCompile(`(?s)<(\w+:)?custShowLst\b.*?</(\w+:)?custShowLst>`)
+	presPrefixRe  = regexp.MustCompile(`<(\w+:)?presentation[\s>]`)
+	relsPrefixRe  = regexp.MustCompile(`xmlns:(\w+)="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`)
+)
+
+// DeckSlide 一页幻灯片的内容，Bullets 每项一个段落，开头每两个空格缩进一级；
+// Image 为 PNG 图片（例如图表），与要点一起时放在正文区域的右半部分
+type DeckSlide struct {
+	Layout  string
+	Title   string
+	Bullets []string
+	Notes   string
+	Image   []byte
+}
+
+// packageRel 关系文件中的一条关系
+type packageRel struct {
+	Id         string `xml:"Id,attr"`
+	Type       string `xml:"Type,attr"`
+	Target     string `xml:"Target,attr"`
+	TargetMode string `xml:"TargetMode,attr,omitempty"`
+}
+
+func parseRels(data []byte) ([]packageRel, error) {
+	var rels struct {
+		Relationship []packageRel
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil, err
+	}
+	return rels.Relationship, nil
+}
+
+func marshalRels(rels []packageRel) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<Relationships xmlns="%s">`, relsNamespace)
+	for _, r := range rels {
+		fmt.Fprintf(&b, `<Relationship Id="%s" Type="%s" Target="%s"`, escapeText(r.Id), escapeText(r.Type), escapeText(r.Target))
+		if r.TargetMode != "" {
+			fmt.Fprintf(&b, ` TargetMode="%s"`, escapeText(r.TargetMode))
+		}
+		b.WriteString("/>")
+	}
+	b.WriteString("</Relationships>")
+	return b.Bytes()
+}
+
+func relsOfType(rels []packageRel, typ string) []packageRel {
+	var res []packageRel
+	for _, r := range rels {
+		if r.Type == relTypePrefix+typ {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// nextRelId 返回未使用的 rIdN
+func nextRelId(rels []packageRel) func() string {
+	n := 0
+	for _, r := range rels {
+		if v, err := strconv.Atoi(strings.TrimPrefix(r.Id, "rId")); err == nil && v > n {
+			n = v
+		}
+	}
+	return func() string {
+		n++
+		return fmt.Sprintf("rId%d", n)
+	}
+}
+
+// relTarget 从 from 所在目录指向 to 的相对路径
+func relTarget(from string, to string) string {
+	fromDir := strings.Split(path.Dir(from), "/")
+	toParts := strings.Split(to, "/")
+	i := 0
+	for i < len(fromDir) && i < len(toParts)-1 && fromDir[i] == toParts[i] {
+		i++
+	}
+	parts := make([]string, 0, len(fromDir)-i+len(toParts)-i)
+	for j := i; j < len(fromDir); j++ {
+		parts = append(parts, "..")
+	}
+	return path.Join(append(parts, toParts[i:]...)...)
+}
+
+// emuBox 占位符的位置及大小，单位为 EMU
+type emuBox struct {
+	X, Y, W, H int64
+}
+
+// placeholder 版式或母版中的占位符
+type placeholder struct {
+	Type string // 未设置时为空，按 obj 处理
+	Idx  string
+	Box  *emuBox
+}
+
+func (p placeholder) isTitle() bool {
+	return p.Type == "title" || p.Type == "ctrTitle"
+}
+
+func (p placeholder) isBody() bool {
+	return p.Type == "" || p.Type == "body" || p.Type == "obj" || p.Type == "subTitle"
+}
+
+// slideLayout 母版中的一个版式
+type slideLayout struct {
+	Part         string
+	Type         string
+	Placeholders []placeholder
+}
+
+func (l slideLayout) title() *placeholder {
+	for i := range l.Placeholders {
+		if l.Placeholders[i].isTitle() {
+			return &l.Placeholders[i]
+		}
+	}
+	return nil
+}
+
+// body 面积最大的正文占位符
+func (l slideLayout) body() *placeholder {
+	var res *placeholder
+	for i := range l.Placeholders {
+		p := &l.Placeholders[i]
+		if !p.isBody() {
+			continue
+		}
+		if res == nil || (p.Box != nil && (res.Box == nil || p.Box.W*p.Box.H > res.Box.W*res.Box.H)) {
+			res = p
+		}
+	}
+	return res
+}
+
+// parsePlaceholders 读取 sldLayout/sldMaster 的根元素 type 属性及其中的占位符
+func parsePlaceholders(data []byte) (string, []placeholder, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		rootType string
+		res      []placeholder
+		current  *placeholder
+		depth    int
+		inXfrm   bool
+		box      emuBox
+	)
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				rootType = attr(t, "type")
+			}
+			switch t.Name.Local {
+			case "sp":
+				current = &placeholder{}
+				box = emuBox{}
+			case "ph":
+				if current != nil {
+					current.Type, current.Idx = attr(t, "type"), attr(t, "idx")
+				}
+			case "xfrm":
+				inXfrm = current != nil
+			case "off":
+				if inXfrm {
+					box.X, _ = strconv.ParseInt(attr(t, "x"), 10, 64)
+					box.Y, _ = strconv.ParseInt(attr(t, "y"), 10, 64)
+				}
+			case "ext":
+				if inXfrm {
+					box.W, _ = strconv.ParseInt(attr(t, "cx"), 10, 64)
+					box.H, _ = strconv.ParseInt(attr(t, "cy"), 10, 64)
+				}
+			}
+		case xml.EndElement:
+			depth--
+			switch t.Name.Local {
+			case "xfrm":
+				if inXfrm && current != nil && box.W > 0 && box.H > 0 {
+					b := box
+					current.Box = &b
+				}
+				inXfrm = false
+			case "sp":
+				if current != nil && (current.Type != "" || current.Idx != "") {
+					res = append(res, *current)
+				}
+				current = nil
+			}
+		}
+	}
+	return rootType, res, nil
+}
+
+// deckBuilder 基于模板生成演示文稿，保留母版、版式及主题，删除原有的幻灯片
+type deckBuilder struct {
+	template []byte
+	zr       *zip.Reader
+	replace  map[string][]byte
+	remove   map[string]bool
+	types    [][2]string // 新增部件的路径及 ContentType
+	width    int64
+	height   int64
+	layouts  []slideLayout
+	master   []placeholder
+	presRels []packageRel
+	newRelId func() string
+}
+
+func newDeckBuilder(template []byte) (*deckBuilder, error) {
+	zr, err := openZip(template)
+	if err != nil {
+		return nil, err
+	}
+	d := &deckBuilder{template: template, zr: zr, replace: map[string][]byte{}, remove: map[string]bool{}, width: 12192000, height: 6858000}
+	presentation, err := readZipFile(zr, pptxPresentationPart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDeckTemplate, err)
+	}
+	var pres struct {
+		SldSz struct {
+			Cx int64 `xml:"cx,attr"`
+			Cy int64 `xml:"cy,attr"`
+		} `xml:"sldSz"`
+	}
+	if err = xml.Unmarshal(presentation, &pres); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", pptxPresentationPart, err)
+	}
+	if pres.SldSz.Cx > 0 && pres.SldSz.Cy > 0 {
+		d.width, d.height = pres.SldSz.Cx, pres.SldSz.Cy
+	}
+	data, err := readZipFile(zr, relsPath(pptxPresentationPart))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDeckTemplate, err)
+	}
+	if d.presRels, err = parseRels(data); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", relsPath(pptxPresentationPart), err)
+	}
+	d.newRelId = nextRelId(d.presRels)
+
+	masters := relsOfType(d.presRels, "slideMaster")
+	if len(masters) == 0 {
+		return nil, fmt.Errorf("%w: no slide master", ErrInvalidDeckTemplate)
+	}
+	masterPart := resolveTarget(pptxPresentationPart, masters[0].Target)
+	data, err = readZipFile(zr, masterPart)
+	if err != nil {
+		return nil, err
+	}
+	if _, d.master, err = parsePlaceholders(data); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", masterPart, err)
+	}
+	rels, err := relationshipsOfType(zr, masterPart, "slideLayout")
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range rels {
+		data, err := readZipFile(zr, part)
+		if err != nil {
+			return nil, err
+		}
+		typ, phs, err := parsePlaceholders(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", part, err)
+		}
+		d.layouts = append(d.layouts, slideLayout{Part: part, Type: typ, Placeholders: phs})
+	}
+	if len(d.layouts) == 0 {
+		return nil, fmt.Errorf("%w: no slide layout", ErrInvalidDeckTemplate)
+	}
+	return d, nil
+}
+
+// relationshipsOfType 按关系文件中的顺序返回指定类型的目标
+func relationshipsOfType(zr *zip.Reader, part string, typ string) ([]string, error) {
+	data, err := readZipFile(zr, relsPath(part))
+	if err != nil {
+		return nil, err
+	}
+	rels, err := parseRels(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", relsPath(part), err)
+	}
+	var res []string
+	for _, r := range relsOfType(rels, typ) {
+		res = append(res, resolveTarget(part, r.Target))
+	}
+	return res, nil
+}
+
+// layout 按用途选择版式，找不到对应类型时使用带标题及正文占位符的版式
+func (d *deckBuilder) layout(kind string) slideLayout {
+	var want []string
+	switch kind {
+	case SlideLayoutTitle:
+		want = []string{"title"}
+	case SlideLayoutSection:
+		want = []string{"secHead"}
+	}
+	want = append(want, "obj", "tx")
+	for _, typ := range want {
+		for _, l := range d.layouts {
+			if l.Type == typ {
+				return l
+			}
+		}
+	}
+	for _, l := range d.layouts {
+		if l.title() != nil && l.body() != nil {
+			return l
+		}
+	}
+	return d.layouts[0]
+}
+
+// box 占位符的位置，版式中没有时取母版中同类占位符的位置，都没有时使用默认区域
+func (d *deckBuilder) box(p *placeholder, title bool) emuBox {
+	if p != nil && p.Box != nil {
+		return *p.Box
+	}
+	for _, m := range d.master {
+		if (title && m.isTitle()) || (!title && m.isBody()) {
+			if m.Box != nil {
+				return *m.Box
+			}
+		}
+	}
+	if title {
+		return emuBox{X: d.width / 20, Y: d.height / 20, W: d.width * 9 / 10, H: d.height * 3 / 20}
+	}
+	return emuBox{X: d.width / 20, Y: d.height / 4, W: d.width * 9 / 10, H: d.height * 13 / 20}
+}
+
+// removeSlides 删除模板中原有的幻灯片及其备注页
+func (d *deckBuilder) removeSlides() error {
+	var kept []packageRel
+	for _, r := range d.presRels {
+		if r.Type != relTypePrefix+"slide" {
+			kept = append(kept, r)
+			continue
+		}
+		part := resolveTarget(pptxPresentationPart, r.Target)
+		d.remove[part] = true
+		d.remove[relsPath(part)] = true
+		notes, err := relationshipsOfType(d.zr, part, "notesSlide")
+		if err != nil && !errors.Is(err, ErrPartNotFound) {
+			return err
+		}
+		for _, n := range notes {
+			d.remove[n] = true
+			d.remove[relsPath(n)] = true
+		}
+	}
+	d.presRels = kept
+	return nil
+}
+
+func paragraphXml(text string, lvl int) string {
+	ppr := ""
+	if lvl > 0 {
+		ppr = fmt.Sprintf(`<a:pPr lvl="%d"/>`, lvl)
+	}
+	if text == "" {
+		return fmt.Sprintf(`<a:p>%s<a:endParaRPr lang="zh-CN" altLang="en-US"/></a:p>`, ppr)
+	}
+	return fmt.Sprintf(`<a:p>%s<a:r><a:rPr lang="zh-CN" altLang="en-US"/><a:t>%s</a:t></a:r></a:p>`, ppr, escapeText(text))
+}
+
+// bulletLevel 开头每两个空格缩进一级，最多 8 级
+func bulletLevel(s string) (string, int) {
+	trimmed := strings.TrimLeft(s, " ")
+	lvl := (len(s) - len(trimmed)) / 2
+	if lvl > 8 {
+		lvl = 8
+	}
+	return strings.TrimSpace(trimmed), lvl
+}
+
+func xfrmXml(b emuBox) string {
+	return fmt.Sprintf(`<a:xfrm><a:off x="%d" y="%d"/><a:ext cx="%d" cy="%d"/></a:xfrm>`, b.X, b.Y, b.W, b.H)
+}
+
+// shapeXml 有占位符时引用版式中的占位符并继承位置，否则生成文本框；box 不为空时覆盖位置
+func shapeXml(id int, name string, ph *placeholder, box *emuBox, paragraphs string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<p:sp><p:nvSpPr><p:cNvPr id="%d" name="%s"/>`, id, escapeText(name))
+	if ph != nil {
+		b.WriteString(`<p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph`)
+		if ph.Type != "" {
+			fmt.Fprintf(&b, ` type="%s"`, ph.Type)
+		}
+		if ph.Idx != "" {
+			fmt.Fprintf(&b, ` idx="%s"`, ph.Idx)
+		}
+		b.WriteString(`/></p:nvPr></p:nvSpPr>`)
+	} else {
+		b.WriteString(`<p:cNvSpPr txBox="1"/><p:nvPr/></p:nvSpPr>`)
+	}
+	if box != nil {
+		fmt.Fprintf(&b, `<p:spPr>%s<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr>`, xfrmXml(*box))
+	} else {
+		b.WriteString(`<p:spPr/>`)
+	}
+	b.WriteString(`<p:txBody><a:bodyPr`)
+	if ph == nil {
+		b.WriteString(` wrap="square"`)
+	}
+	b.WriteString(`><a:normAutofit/></a:bodyPr><a:lstStyle/>`)
+	b.WriteString(paragraphs)
+	b.WriteString(`</p:txBody></p:sp>`)
+	return b.String()
+}
+
+// fitImage 按图片比例放入区域中并居中
+func fitImage(content []byte, area emuBox) (emuBox, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return area, fmt.Errorf("decode slide image: %w", err)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return area, nil
+	}
+	w, h := area.W, area.W*int64(cfg.Height)/int64(cfg.Width)
+	if h > area.H {
+		w, h = area.H*int64(cfg.Width)/int64(cfg.Height), area.H
+	}
+	return emuBox{X: area.X + (area.W-w)/2, Y: area.Y + (area.H-h)/2, W: w, H: h}, nil
+}
+
+// addSlide 写入第 n 页幻灯片及其关系、图片、备注页
+func (d *deckBuilder) addSlide(n int, s DeckSlide, notesMaster string) (string, error) {
+	part := fmt.Sprintf("ppt/slides/slide%d.xml", n)
+	layout := d.layout(s.Layout)
+	rels := []packageRel{{Id: "rId1", Type: relTypePrefix + "slideLayout", Target: relTarget(part, layout.Part)}}
+
+	var shapes strings.Builder
+	titlePh := layout.title()
+	var titleBox *emuBox
+	if titlePh == nil {
+		b := d.box(nil, true)
+		titleBox = &b
+	}
+	shapes.WriteString(shapeXml(2, "Title 1", titlePh, titleBox, paragraphXml(s.Title, 0)))
+
+	bodyPh := layout.body()
+	area := d.box(bodyPh, false)
+	var bodyBox *emuBox
+	if bodyPh == nil {
+		bodyBox = &area
+	}
+	if len(s.Image) > 0 && len(s.Bullets) > 0 {
+		// 要点在左，图片在右
+		left := emuBox{X: area.X, Y: area.Y, W: area.W / 2, H: area.H}
+		bodyBox = &left
+		area = emuBox{X: area.X + area.W/2, Y: area.Y, W: area.W - area.W/2, H: area.H}
+	}
+	if len(s.Bullets) > 0 {
+		var paragraphs strings.Builder
+		for _, bullet := range s.Bullets {
+			text, lvl := bulletLevel(bullet)
+			paragraphs.WriteString(paragraphXml(text, lvl))
+		}
+		shapes.WriteString(shapeXml(3, "Content 2", bodyPh, bodyBox, paragraphs.String()))
+	}
+	if len(s.Image) > 0 {
+		media := fmt.Sprintf("ppt/media/deck_image%d.png", n)
+		box, err := fitImage(s.Image, area)
+		if err != nil {
+			return "", err
+		}
+		d.replace[media] = s.Image
+		rels = append(rels, packageRel{Id: "rId2", Type: relTypePrefix + "image", Target: relTarget(part, media)})
+		fmt.Fprintf(&shapes, `<p:pic><p:nvPicPr><p:cNvPr id="4" name="Picture 3"/><p:cNvPicPr><a:picLocks noChangeAspect="1"/></p:cNvPicPr><p:nvPr/></p:nvPicPr>`+
+			`<p:blipFill><a:blip r:embed="rId2"/><a:stretch><a:fillRect/></a:stretch></p:blipFill>`+
+			`<p:spPr>%s<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr></p:pic>`, xfrmXml(box))
+	}
+
+	d.replace[part] = []byte(xml.Header + `<p:sld ` + pmlNamespaceAttrs + `><p:cSld><p:spTree>` +
+		`<p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr><p:grpSpPr/>` +
+		shapes.String() + `</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:sld>`)
+	d.types = append(d.types, [2]string{part, slideContentType})
+
+	if strings.TrimSpace(s.Notes) != "" {
+		notes := fmt.Sprintf("ppt/notesSlides/notesSlide%d.xml", n)
+		var paragraphs strings.Builder
+		for _, line := range strings.Split(strings.TrimSpace(s.Notes), "\n") {
+			paragraphs.WriteString(paragraphXml(strings.TrimSpace(line), 0))
+		}
+		d.replace[notes] = []byte(xml.Header + `<p:notes ` + pmlNamespaceAttrs + `><p:cSld><p:spTree>` +
+			`<p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr><p:grpSpPr/>` +
+			`<p:sp><p:nvSpPr><p:cNvPr id="2" name="Slide Image Placeholder 1"/><p:cNvSpPr><a:spLocks noGrp="1" noRot="1" noChangeAspect="1"/></p:cNvSpPr><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr><p:spPr/></p:sp>` +
+			`<p:sp><p:nvSpPr><p:cNvPr id="3" name="Notes Placeholder 2"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:spPr/>` +
+			`<p:txBody><a:bodyPr/><a:lstStyle/>` + paragraphs.String() + `</p:txBody></p:sp>` +
+			`</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:notes>`)
+		d.replace[relsPath(notes)] = marshalRels([]packageRel{
+			{Id: "rId1", Type: relTypePrefix + "notesMaster", Target: relTarget(notes, notesMaster)},
+			{Id: "rId2", Type: relTypePrefix + "slide", Target: relTarget(notes, part)},
+		})
+		d.types = append(d.types, [2]string{notes, notesContentType})
+		rels = append(rels, packageRel{Id: fmt.Sprintf("rId%d", len(rels)+1), Type: relTypePrefix + "notesSlide", Target: relTarget(part, notes)})
+	}
+	d.replace[relsPath(part)] = marshalRels(rels)
+	return part, nil
+}
+
+// notesMaster 返回模板中的备注母版，没有时新建一个，主题复制自幻灯片母版
+func (d *deckBuilder) notesMaster(presentation *string) (string, error) {
+	if rels := relsOfType(d.presRels, "notesMaster"); len(rels) > 0 {
+		return resolveTarget(pptxPresentationPart, rels[0].Target), nil
+	}
+	masters := relsOfType(d.presRels, "slideMaster")
+	masterPart := resolveTarget(pptxPresentationPart, masters[0].Target)
+	themes, err := relationshipsOfType(d.zr, masterPart, "theme")
+	if err != nil {
+		return "", err
+	}
+	if len(themes) == 0 {
+		return "", fmt.Errorf("%w: slide master has no theme", ErrInvalidDeckTemplate)
+	}
+	theme, err := readZipFile(d.zr, themes[0])
+	if err != nil {
+		return "", err
+	}
+	themePart := ""
+	for i := 1; themePart == ""; i++ {
+		name := fmt.Sprintf("ppt/theme/theme%d.xml", i)
+		if _, err := readZipFile(d.zr, name); errors.Is(err, ErrPartNotFound) {
+			themePart = name
+		}
+	}
+	part := "ppt/notesMasters/notesMaster1.xml"
+	d.replace[themePart] = theme
+	d.replace[part] = []byte(xml.Header + `<p:notesMaster ` + pmlNamespaceAttrs + `><p:cSld><p:spTree>` +
+		`<p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr><p:grpSpPr/>` +
+		`<p:sp><p:nvSpPr><p:cNvPr id="2" name="Slide Image Placeholder 1"/><p:cNvSpPr><a:spLocks noGrp="1" noRot="1" noChangeAspect="1"/></p:cNvSpPr><p:nvPr><p:ph type="sldImg" idx="2"/></p:nvPr></p:nvSpPr>` +
+		`<p:spPr><a:xfrm><a:off x="685800" y="1143000"/><a:ext cx="5486400" cy="3086100"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom><a:noFill/></p:spPr></p:sp>` +
+		`<p:sp><p:nvSpPr><p:cNvPr id="3" name="Notes Placeholder 2"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph type="body" sz="quarter" idx="3"/></p:nvPr></p:nvSpPr>` +
+		`<p:spPr><a:xfrm><a:off x="685800" y="4400550"/><a:ext cx="5486400" cy="3600450"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr>` +
+		`<p:txBody><a:bodyPr/><a:lstStyle/><a:p><a:endParaRPr lang="zh-CN" altLang="en-US"/></a:p></p:txBody></p:sp>` +
+		`</p:spTree></p:cSld>` +
+		`<p:clrMap bg1="lt1" tx1="dk1" bg2="lt2" tx2="dk2" accent1="accent1" accent2="accent2" accent3="accent3" accent4="accent4" accent5="accent5" accent6="accent6" hlink="hlink" folHlink="folHlink"/>` +
+		`<p:notesStyle><a:lvl1pPr marL="0" algn="l" defTabSz="914400" rtl="0" eaLnBrk="1" latinLnBrk="0" hangingPunct="1"><a:defRPr sz="1200" kern="1200"><a:solidFill><a:schemeClr val="tx1"/></a:solidFill><a:latin typeface="+mn-lt"/><a:ea typeface="+mn-ea"/><a:cs typeface="+mn-cs"/></a:defRPr></a:lvl1pPr></p:notesStyle>` +
+		`</p:notesMaster>`)
+	d.replace[relsPath(part)] = marshalRels([]packageRel{{Id: "rId1", Type: relTypePrefix + "theme", Target: relTarget(part, themePart)}})
+	d.types = append(d.types, [2]string{part, notesMasterCType}, [2]string{themePart, themeContentType})
+
+	id := d.newRelId()
+	d.presRels = append(d.presRels, packageRel{Id: id, Type: relTypePrefix + "notesMaster", Target: relTarget(pptxPresentationPart, part)})
+	// notesMasterIdLst 紧跟在 sldMasterIdLst 之后
+	pfx, r := presentationPrefixes(*presentation)
+	end := "</" + pfx + "sldMasterIdLst>"
+	i := strings.Index(*presentation, end)
+	if i < 0 {
+		return "", fmt.Errorf("%w: sldMasterIdLst not found", ErrInvalidDeckTemplate)
+	}
+	i += len(end)
+	*presentation = (*presentation)[:i] + fmt.Sprintf(`<%snotesMasterIdLst><%snotesMasterId %sid="%s"/></%snotesMasterIdLst>`, pfx, pfx, r, id, pfx) + (*presentation)[i:]
+	return part, nil
+}
+
+// presentationPrefixes 返回 presentation.xml 中 presentationml 及关系命名空间的前缀
+func presentationPrefixes(presentation string) (string, string) {
+	pfx, r := "", "r:"
+	if m := presPrefixRe.FindStringSubmatch(presentation); m != nil {
+		pfx = m[1]
+	}
+	if m := relsPrefixRe.FindStringSubmatch(presentation); m != nil {
+		r = m[1] + ":"
+	}
+	return pfx, r
+}
+
+// updateContentTypes 删除已移除部件的 Override，添加新部件的 Override 及 png 默认类型
+func (d *deckBuilder) updateContentTypes() error {
+	data, err := readZipFile(d.zr, contentTypesPart)
+	if err != nil {
+		return err
+	}
+	var types struct {
+		Default []struct {
+			Extension   string `xml:"Extension,attr"`
+			ContentType string `xml:"ContentType,attr"`
+		}
+		Override []struct {
+			PartName    string `xml:"PartName,attr"`
+			ContentType string `xml:"ContentType,attr"`
+		}
+	}
+	if err = xml.Unmarshal(data, &types); err != nil {
+		return fmt.Errorf("parse %s: %w", contentTypesPart, err)
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	hasPng := false
+	for _, t := range types.Default {
+		hasPng = hasPng || strings.EqualFold(t.Extension, "png")
+		fmt.Fprintf(&b, `<Default Extension="%s" ContentType="%s"/>`, escapeText(t.Extension), escapeText(t.ContentType))
+	}
+	if !hasPng {
+		b.WriteString(`<Default Extension="png" ContentType="image/png"/>`)
+	}
+	for _, t := range types.Override {
+		if d.remove[strings.TrimPrefix(t.PartName, "/")] {
+			continue
+		}
+		fmt.Fprintf(&b, `<Override PartName="%s" ContentType="%s"/>`, escapeText(t.PartName), escapeText(t.ContentType))
+	}
+	for _, t := range d.types {
+		fmt.Fprintf(&b, `<Override PartName="/%s" ContentType="%s"/>`, escapeText(t[0]), t[1])
+	}
+	b.WriteString(`</Types>`)
+	d.replace[contentTypesPart] = []byte(b.String())
+	return nil
+}
+
+// removeUnusedMedia 删除不再被任何关系引用的媒体文件，例如原有幻灯片中的图片
+func (d *deckBuilder) removeUnusedMedia() error {
+	used := map[string]bool{}
+	addRels := func(part string, data []byte) error {
+		rels, err := parseRels(data)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", part, err)
+		}
+		// _rels/x.xml.rels 描述的是 x.xml
+		dir := path.Dir(path.Dir(part))
+		source := path.Join(dir, strings.TrimSuffix(path.Base(part), ".rels"))
+		for _, r := range rels {
+			if r.TargetMode != "External" {
+				used[resolveTarget(source, r.Target)] = true
+			}
+		}
+		return nil
+	}
+	for _, f := range d.zr.File {
+		if !strings.HasSuffix(f.Name, ".rels") || d.remove[f.Name] {
+			continue
+		}
+		if _, ok := d.replace[f.Name]; ok {
+			continue
+		}
+		data, err := readZipFile(d.zr, f.Name)
+		if err != nil {
+			return err
+		}
+		if err = addRels(f.Name, data); err != nil {
+			return err
+		}
+	}
+	for name, data := range d.replace {
+		if strings.HasSuffix(name, ".rels") {
+			if err := addRels(name, data); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range d.zr.File {
+		if strings.HasPrefix(f.Name, "ppt/media/") && !used[f.Name] {
+			d.remove[f.Name] = true
+		}
+	}
+	return nil
+}
+
+// BuildDeck 以 template 为母版模板生成演示文稿，模板中原有的幻灯片会被删除
+func BuildDeck(template []byte, slides []DeckSlide) ([]byte, error) {
+	d, err := newDeckBuilder(template)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.removeSlides(); err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(d.zr, pptxPresentationPart)
+	if err != nil {
+		return nil, err
+	}
+	presentation := sectionLstRe.ReplaceAllString(custShowLstRe.ReplaceAllString(string(data), ""), "")
+
+	notesMaster := ""
+	for _, s := range slides {
+		if strings.TrimSpace(s.Notes) != "" {
+			if notesMaster, err = d.notesMaster(&presentation); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	pfx, r := presentationPrefixes(presentation)
+	var ids strings.Builder
+	fmt.Fprintf(&ids, "<%ssldIdLst>", pfx)
+	for i, s := range slides {
+		part, err := d.addSlide(i+1, s, notesMaster)
+		if err != nil {
+			return nil, err
+		}
+		id := d.newRelId()
+		d.presRels = append(d.presRels, packageRel{Id: id, Type: relTypePrefix + "slide", Target: relTarget(pptxPresentationPart, part)})
+		fmt.Fprintf(&ids, `<%ssldId id="%d" %sid="%s"/>`, pfx, 256+i, r, id)
+	}
+	fmt.Fprintf(&ids, "</%ssldIdLst>", pfx)
+	if loc := sldIdLstRe.FindStringIndex(presentation); loc != nil {
+		presentation = presentation[:loc[0]] + ids.String() + presentation[loc[1]:]
+	} else {
+		// sldIdLst 位于各母版列表之后、sldSz 之前
+		i := strings.Index(presentation, "<"+pfx+"sldSz")
+		if i < 0 {
+			return nil, fmt.Errorf("%w: sldSz not found", ErrInvalidDeckTemplate)
+		}
+		presentation = presentation[:i] + ids.String() + presentation[i:]
+	}
+	d.replace[pptxPresentationPart] = []byte(presentation)
+	d.replace[relsPath(pptxPresentationPart)] = marshalRels(d.presRels)
+
+	if err = d.updateContentTypes(); err != nil {
+		return nil, err
+	}
+	if err = d.removeUnusedMedia(); err != nil {
+		return nil, err
+	}
+	// 新旧幻灯片可能同名，新写入的部件不能删除
+	for name := range d.replace {
+		delete(d.remove, name)
+	}
+	return rewriteZip(d.template, d.replace, d.remove)
+}
+
+// DeckTemplate 读取生成演示文稿使用的模板，fileId 为空时使用配置中的 deck.template
+func (d *DocSvc) DeckTemplate(ctx context.Context, fileId string) ([]byte, error) {
+	if fileId == "" {
+		return os.ReadFile(econf.GetString("deck.template"))
+	}
+	file, err := d.fileSvc.GetFileMeta(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if KindOf(file.Ext) != KindPptx {
+		return nil, fmt.Errorf("%w: template must be a pptx file", ErrInvalidDeckTemplate)
+	}
+	return d.fileSvc.GetFileContent(ctx, fileId)
+}
@@ -0,0 +1,382 @@
+package docsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+var ErrIncomparable = errors.New("documents cannot be compared")
+
+const (
+	DiffAdded    = "added"
+	DiffRemoved  = "removed"
+	DiffModified = "modified"
+
+	DiffKindHeading   = "heading"
+	DiffKindParagraph = "paragraph"
+	DiffKindSlide     = "slide"
+	DiffKindSheet     = "sheet"
+	DiffKindRow       = "row"
+	DiffKindCell      = "cell"
+
+	// maxDiffChanges 变更过多时截断，避免响应及总结的提示词过大
+	maxDiffChanges = 1000
+	// maxLcsCells 对齐时 LCS 表的上限，超过后按位置逐个比较
+	maxLcsCells = 4000000
+)
+
+// DiffChange 一处变更；位置与 read_section、read_range 一致，新增及修改取新文档中的位置，删除取旧文档中的位置
+type DiffChange struct {
+	Type     string `json:"type"`
+	Kind     string `json:"kind"`
+	Location string `json:"location"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+}
+
+// DiffStats 各类变更的数量
+type DiffStats struct {
+	Added    int `json:"added"`
+	Removed  int `json:"removed"`
+	Modified int `json:"modified"`
+}
+
+// DiffSide 参与比较的文件版本
+type DiffSide struct {
+	FileId  string `json:"fileId"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+// DiffResult 两个文档的结构化差异
+type DiffResult struct {
+	From      DiffSide     `json:"from"`
+	To        DiffSide     `json:"to"`
+	Kind      Kind         `json:"kind"`
+	Changes   []DiffChange `json:"changes"`
+	Stats     DiffStats    `json:"stats"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+// Diff 比较两个文档的结构：docx、文本按标题及段落，xlsx、csv 按工作表、行及单元格，pptx 按幻灯片
+func Diff(from *Document, to *Document) (*DiffResult, error) {
+	d := &differ{}
+	switch {
+	case from.Kind == KindPptx && to.Kind == KindPptx:
+		d.diffSlides(from.Sections, to.Sections)
+		d.res.Kind = KindPptx
+	case isTabular(from) && isTabular(to):
+		d.diffSheets(from.Sheets, to.Sheets)
+		d.res.Kind = to.Kind
+	case !isTabular(from) && !isTabular(to) && from.Kind != KindPptx && to.Kind != KindPptx:
+		d.diffItems(sectionItems(from.Sections), sectionItems(to.Sections))
+		d.res.Kind = to.Kind
+	default:
+		return nil, fmt.Errorf("%w: %s and %s", ErrIncomparable, from.Kind, to.Kind)
+	}
+	if d.res.Changes == nil {
+		d.res.Changes = []DiffChange{}
+	}
+	return &d.res, nil
+}
+
+func isTabular(doc *Document) bool {
+	return doc.Kind == KindXlsx || doc.Kind == KindCsv
+}
+
+type differ struct {
+	res DiffResult
+}
+
+func (d *differ) add(c DiffChange) {
+	if len(d.res.Changes) >= maxDiffChanges {
+		d.res.Truncated = true
+		return
+	}
+	switch c.Type {
+	case DiffAdded:
+		d.res.Stats.Added++
+	case DiffRemoved:
+		d.res.Stats.Removed++
+	case DiffModified:
+		d.res.Stats.Modified++
+	}
+	d.res.Changes = append(d.res.Changes, c)
+}
+
+// diffItem 参与对齐的一个单元，Key 相同视为未变更，Kind 相同的才能配对为修改
+type diffItem struct {
+	Kind     string
+	Location string
+	Text     string
+}
+
+func (i diffItem) key() string {
+	return i.Kind + "\x00" + i.Text
+}
+
+// sectionItems 把章节展开为标题及段落
+func sectionItems(sections []Section) []diffItem {
+	var items []diffItem
+	for _, s := range sections {
+		if s.Title != "" {
+			items = append(items, diffItem{Kind: DiffKindHeading, Location: paragraphLocation(s.Index, -1), Text: s.Title})
+		}
+		for i, p := range s.Paragraphs {
+			items = append(items, diffItem{Kind: DiffKindParagraph, Location: paragraphLocation(s.Index, i), Text: p})
+		}
+	}
+	return items
+}
+
+// slideItems 把幻灯片展开为标题及段落
+func slideItems(s Section) []diffItem {
+	var items []diffItem
+	if s.Title != "" {
+		items = append(items, diffItem{Kind: DiffKindHeading, Location: slideLocation(s) + " title", Text: s.Title})
+	}
+	for i, p := range s.Paragraphs {
+		items = append(items, diffItem{Kind: DiffKindParagraph, Location: fmt.Sprintf("%s paragraph %d", slideLocation(s), i), Text: p})
+	}
+	return items
+}
+
+func (d *differ) diffItems(a []diffItem, b []diffItem) {
+	ops := alignSeq(len(a), len(b), func(i, j int) bool { return a[i].key() == b[j].key() }, func(i, j int) bool { return a[i].Kind == b[j].Kind })
+	for _, op := range ops {
+		switch op.Type {
+		case DiffAdded:
+			d.add(DiffChange{Type: DiffAdded, Kind: b[op.B].Kind, Location: b[op.B].Location, After: b[op.B].Text})
+		case DiffRemoved:
+			d.add(DiffChange{Type: DiffRemoved, Kind: a[op.A].Kind, Location: a[op.A].Location, Before: a[op.A].Text})
+		case DiffModified:
+			d.add(DiffChange{Type: DiffModified, Kind: b[op.B].Kind, Location: b[op.B].Location, Before: a[op.A].Text, After: b[op.B].Text})
+		}
+	}
+}
+
+// diffSlides 先按幻灯片内容对齐，修改过的幻灯片再比较其中的标题及段落
+func (d *differ) diffSlides(a []Section, b []Section) {
+	ops := alignSeq(len(a), len(b), func(i, j int) bool { return slideText(a[i]) == slideText(b[j]) }, nil)
+	for _, op := range ops {
+		switch op.Type {
+		case DiffAdded:
+			d.add(DiffChange{Type: DiffAdded, Kind: DiffKindSlide, Location: slideLocation(b[op.B]), After: slideText(b[op.B])})
+		case DiffRemoved:
+			d.add(DiffChange{Type: DiffRemoved, Kind: DiffKindSlide, Location: slideLocation(a[op.A]), Before: slideText(a[op.A])})
+		case DiffModified:
+			d.diffItems(slideItems(a[op.A]), slideItems(b[op.B]))
+		}
+	}
+}
+
+func slideText(s Section) string {
+	return strings.Join(append([]string{s.Title}, s.Paragraphs...), "\n")
+}
+
+func slideLocation(s Section) string {
+	return fmt.Sprintf("slide %d", s.Index+1)
+}
+
+// diffSheets 按名称匹配工作表，同名工作表按行内容对齐，修改过的行再逐个比较单元格
+func (d *differ) diffSheets(a []Sheet, b []Sheet) {
+	// 单工作表的文件（如 csv 与 xlsx）不按名称匹配
+	if len(a) == 1 && len(b) == 1 {
+		d.diffRows(a[0], b[0])
+		return
+	}
+	names := map[string]bool{}
+	for _, s := range b {
+		names[s.Name] = true
+	}
+	for _, s := range a {
+		if !names[s.Name] {
+			d.add(DiffChange{Type: DiffRemoved, Kind: DiffKindSheet, Location: s.Name})
+		}
+	}
+	for _, s := range b {
+		from, ok := findSheet(a, s.Name)
+		if !ok {
+			d.add(DiffChange{Type: DiffAdded, Kind: DiffKindSheet, Location: s.Name})
+			continue
+		}
+		d.diffRows(from, s)
+	}
+}
+
+func findSheet(sheets []Sheet, name string) (Sheet, bool) {
+	for _, s := range sheets {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Sheet{}, false
+}
+
+func (d *differ) diffRows(a Sheet, b Sheet) {
+	rowText := func(row []string) string {
+		return strings.TrimRight(strings.Join(row, "\t"), "\t")
+	}
+	ops := alignSeq(len(a.Rows), len(b.Rows), func(i, j int) bool { return rowText(a.Rows[i]) == rowText(b.Rows[j]) }, nil)
+	for _, op := range ops {
+		switch op.Type {
+		case DiffAdded:
+			d.add(DiffChange{Type: DiffAdded, Kind: DiffKindRow, Location: fmt.Sprintf("%s!%d", b.Name, op.B+1), After: rowText(b.Rows[op.B])})
+		case DiffRemoved:
+			d.add(DiffChange{Type: DiffRemoved, Kind: DiffKindRow, Location: fmt.Sprintf("%s!%d", a.Name, op.A+1), Before: rowText(a.Rows[op.A])})
+		case DiffModified:
+			from, to := a.Rows[op.A], b.Rows[op.B]
+			for col := 0; col < len(from) || col < len(to); col++ {
+				before, after := cellAt(from, col), cellAt(to, col)
+				if before == after {
+					continue
+				}
+				c := DiffChange{Type: DiffModified, Kind: DiffKindCell, Location: b.Name + "!" + CellRef{Row: op.B, Col: col}.String(), Before: before, After: after}
+				if before == "" {
+					c.Type = DiffAdded
+				} else if after == "" {
+					c.Type = DiffRemoved
+				}
+				d.add(c)
+			}
+		}
+	}
+}
+
+func cellAt(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
+
+// diffOp 对齐结果，A、B 为两侧的序号，新增时 A 为 -1，删除时 B 为 -1
+type diffOp struct {
+	Type string
+	A    int
+	B    int
+}
+
+// alignSeq 用最长公共子序列对齐两个序列，只返回变更；相邻的删除及新增按顺序配对为修改，
+// pairable 为空时任意两项都可以配对
+func alignSeq(n int, m int, equal func(i, j int) bool, pairable func(i, j int) bool) []diffOp {
+	// 去掉相同的首尾，减少 LCS 的计算量
+	prefix := 0
+	for prefix < n && prefix < m && equal(prefix, prefix) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && equal(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+	n1, m1 := n-prefix-suffix, m-prefix-suffix
+
+	var matches [][2]int
+	if n1 > 0 && m1 > 0 && n1*m1 <= maxLcsCells {
+		// lcs[i][j] 为 a[i:]、b[j:] 的最长公共子序列长度
+		lcs := make([][]int32, n1+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m1+1)
+		}
+		for i := n1 - 1; i >= 0; i-- {
+			for j := m1 - 1; j >= 0; j-- {
+				switch {
+				case equal(prefix+i, prefix+j):
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i, j := 0, 0; i < n1 && j < m1; {
+			switch {
+			case equal(prefix+i, prefix+j):
+				matches = append(matches, [2]int{prefix + i, prefix + j})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+	matches = append(matches, [2]int{n - suffix, m - suffix})
+
+	var ops []diffOp
+	i, j := prefix, prefix
+	for _, match := range matches {
+		removed, added := match[0]-i, match[1]-j
+		for k := 0; k < removed || k < added; k++ {
+			switch {
+			case k < removed && k < added && (pairable == nil || pairable(i+k, j+k)):
+				ops = append(ops, diffOp{Type: DiffModified, A: i + k, B: j + k})
+			case k < removed && k < added:
+				ops = append(ops, diffOp{Type: DiffRemoved, A: i + k, B: -1}, diffOp{Type: DiffAdded, A: -1, B: j + k})
+			case k < removed:
+				ops = append(ops, diffOp{Type: DiffRemoved, A: i + k, B: -1})
+			default:
+				ops = append(ops, diffOp{Type: DiffAdded, A: -1, B: j + k})
+			}
+		}
+		i, j = match[0]+1, match[1]+1
+	}
+	return ops
+}
+
+// DiffTarget 比较的一侧，Version 为空时使用当前版本
+type DiffTarget struct {
+	FileId  string
+	Version *int64
+}
+
+// Diff 比较同一文件的两个版本，或两个不同的文件
+func (d *DocSvc) Diff(ctx context.Context, from DiffTarget, to DiffTarget) (*DiffResult, error) {
+	fromSide, fromDoc, err := d.loadVersion(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toSide, toDoc, err := d.loadVersion(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Diff(fromDoc, toDoc)
+	if err != nil {
+		return nil, err
+	}
+	res.From, res.To = fromSide, toSide
+	return res, nil
+}
+
+func (d *DocSvc) loadVersion(ctx context.Context, target DiffTarget) (DiffSide, *Document, error) {
+	file, err := d.fileSvc.GetFileMeta(ctx, target.FileId)
+	if err != nil {
+		return DiffSide{}, nil, err
+	}
+	side := DiffSide{FileId: file.FileID, Name: file.Name, Version: file.Version}
+	if target.Version != nil {
+		side.Version = *target.Version
+	}
+	var v *dto.FileVersion
+	var content []byte
+	if target.Version == nil {
+		content, err = d.fileSvc.GetFileContent(ctx, file.FileID)
+	} else {
+		v, content, err = d.fileSvc.GetVersionContent(ctx, file, *target.Version)
+	}
+	if err != nil {
+		return side, nil, err
+	}
+	ext := file.Ext
+	if v != nil && v.Ext != "" {
+		ext = v.Ext
+	}
+	doc, err := Parse(file.Name, ext, content)
+	return side, doc, err
+}
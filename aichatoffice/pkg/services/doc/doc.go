@@ -0,0 +1,397 @@
+package docsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	filesvc "aichatoffice/pkg/services/file"
+	officesvc "aichatoffice/pkg/services/office"
+	"aichatoffice/pkg/utils"
+)
+
+var ErrUnsupportedKind = errors.New("unsupported document kind")
+
+type Kind string
+
+const (
+	KindDocx Kind = "docx"
+	KindXlsx Kind = "xlsx"
+	KindPptx Kind = "pptx"
+	KindText Kind = "text"
+	KindCsv  Kind = "csv"
+)
+
+// KindOf 根据扩展名判断文档类型，无法解析的返回空
+func KindOf(ext string) Kind {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "docx", "docm", "dotx":
+		return KindDocx
+	case "xlsx", "xlsm", "xltx":
+		return KindXlsx
+	case "pptx", "pptm", "potx":
+		return KindPptx
+	case "txt", "md", "markdown":
+		return KindText
+	case "csv":
+		return KindCsv
+	default:
+		return ""
+	}
+}
+
+// Section 文档章节，docx 按标题切分，pptx 每页一个章节
+type Section struct {
+	Index      int      `json:"index"`
+	Title      string   `json:"title"`
+	Level      int      `json:"level"`
+	Paragraphs []string `json:"paragraphs"`
+
+	// 章节标题及段落在 document.xml 中的段落序号，编辑时定位使用，-1 表示没有标题
+	titleRef      int
+	paragraphRefs []int
+}
+
+func (s Section) Text() string {
+	return strings.Join(s.Paragraphs, "\n")
+}
+
+// Sheet 工作表，Rows 为单元格的显示值
+type Sheet struct {
+	Name string     `json:"name"`
+	Rows [][]string `json:"rows"`
+}
+
+// Size 返回行数及最大列数
+func (s Sheet) Size() (rows int, cols int) {
+	for _, row := range s.Rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return len(s.Rows), cols
+}
+
+// Cell 越界返回空串
+func (s Sheet) Cell(ref CellRef) string {
+	if ref.Row < 0 || ref.Row >= len(s.Rows) || ref.Col < 0 || ref.Col >= len(s.Rows[ref.Row]) {
+		return ""
+	}
+	return s.Rows[ref.Row][ref.Col]
+}
+
+// Range 读取范围内的值，结果按范围大小补齐
+func (s Sheet) Range(r CellRange) [][]string {
+	res := make([][]string, 0, r.To.Row-r.From.Row+1)
+	for row := r.From.Row; row <= r.To.Row; row++ {
+		values := make([]string, 0, r.To.Col-r.From.Col+1)
+		for col := r.From.Col; col <= r.To.Col; col++ {
+			values = append(values, s.Cell(CellRef{Row: row, Col: col}))
+		}
+		res = append(res, values)
+	}
+	return res
+}
+
+// Document 从文件中抽取出的结构，供工具调用、对比等使用
+type Document struct {
+	Kind     Kind      `json:"kind"`
+	Sections []Section `json:"sections,omitempty"`
+	Sheets   []Sheet   `json:"sheets,omitempty"`
+}
+
+func (d *Document) index() {
+	for i := range d.Sections {
+		d.Sections[i].Index = i
+	}
+}
+
+// Sheet 按名称查找工作表，名称为空时返回第一个
+func (d *Document) Sheet(name string) (Sheet, bool) {
+	for _, s := range d.Sheets {
+		if name == "" || s.Name == name {
+			return s, true
+		}
+	}
+	return Sheet{}, false
+}
+
+// Text 全文，用于不支持结构化的场景
+func (d *Document) Text() string {
+	var sb strings.Builder
+	for _, s := range d.Sections {
+		if s.Title != "" {
+			sb.WriteString(s.Title)
+			sb.WriteString("\n")
+		}
+		for _, p := range s.Paragraphs {
+			sb.WriteString(p)
+			sb.WriteString("\n")
+		}
+	}
+	for _, s := range d.Sheets {
+		sb.WriteString(s.Name)
+		sb.WriteString("\n")
+		for _, row := range s.Rows {
+			sb.WriteString(strings.Join(row, "\t"))
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// SearchHit 搜索结果，文字类文档给出章节及段落，表格给出单元格
+type SearchHit struct {
+	Section   *int   `json:"section,omitempty"`
+	Paragraph *int   `json:"paragraph,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Sheet     string `json:"sheet,omitempty"`
+	Cell      string `json:"cell,omitempty"`
+	Snippet   string `json:"snippet"`
+	score     int
+}
+
+// Search 按关键词搜索，忽略大小写，命中关键词越多越靠前
+func (d *Document) Search(query string, limit int) []SearchHit {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+	var hits []SearchHit
+	for i, s := range d.Sections {
+		for j, p := range s.Paragraphs {
+			if score := matchScore(p, query, terms); score > 0 {
+				hits = append(hits, SearchHit{Section: intPtr(i), Paragraph: intPtr(j), Title: s.Title, Snippet: snippet(p, terms), score: score})
+			}
+		}
+		if score := matchScore(s.Title, query, terms); score > 0 {
+			hits = append(hits, SearchHit{Section: intPtr(i), Title: s.Title, Snippet: s.Title, score: score})
+		}
+	}
+	for _, s := range d.Sheets {
+		for r, row := range s.Rows {
+			for c, value := range row {
+				if score := matchScore(value, query, terms); score > 0 {
+					hits = append(hits, SearchHit{Sheet: s.Name, Cell: CellRef{Row: r, Col: c}.String(), Snippet: snippet(value, terms), score: score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].score > hits[j].score
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// matchScore 完整命中查询加权，其余按命中的关键词个数计分
+func matchScore(text string, query string, terms []string) int {
+	lower := strings.ToLower(text)
+	score := 0
+	if len(terms) > 1 && strings.Contains(lower, strings.ToLower(query)) {
+		score += len(terms)
+	}
+	for _, term := range terms {
+		if strings.Contains(lower, term) {
+			score++
+		}
+	}
+	return score
+}
+
+const snippetRunes = 80
+
+// snippet 截取第一个关键词附近的内容
+func snippet(text string, terms []string) string {
+	if utf8.RuneCountInString(text) <= snippetRunes {
+		return text
+	}
+	lower := strings.ToLower(text)
+	pos := 0
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			pos = utf8.RuneCountInString(lower[:i])
+			break
+		}
+	}
+	runes := []rune(text)
+	start := pos - snippetRunes/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+		start = end - snippetRunes
+	}
+	res := string(runes[start:end])
+	if start > 0 {
+		res = "…" + res
+	}
+	if end < len(runes) {
+		res += "…"
+	}
+	return res
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// Parse 根据扩展名解析文件内容
+func Parse(name string, ext string, content []byte) (*Document, error) {
+	switch KindOf(ext) {
+	case KindDocx:
+		return parseDocx(content)
+	case KindXlsx:
+		return parseXlsx(content)
+	case KindPptx:
+		return parsePptx(content)
+	case KindText:
+		return parseText(string(content)), nil
+	case KindCsv:
+		return parseCsv(strings.TrimSuffix(name, ext), content)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKind, ext)
+	}
+}
+
+type DocSvc struct {
+	fileSvc   *filesvc.FileService
+	officeSvc officesvc.OfficeSvc
+}
+
+func NewDocSvc(fileSvc *filesvc.FileService, officeSvc officesvc.OfficeSvc) *DocSvc {
+	return &DocSvc{
+		fileSvc:   fileSvc,
+		officeSvc: officeSvc,
+	}
+}
+
+// 按内容保存的提取结果，内容相同的文件共用
+const (
+	derivedText     = "text.txt"
+	derivedDocument = "document.json"
+)
+
+// Load 读取文件并解析，不支持的格式（如 pdf）退回到 office 服务提取的纯文本；
+// 提取的文本及解析结果按内容的 SHA-256 缓存，重复上传的文件直接复用
+func (d *DocSvc) Load(ctx context.Context, fileId string) (dto.FileMeta, *Document, error) {
+	file, err := d.fileSvc.GetFileMeta(ctx, fileId)
+	if err != nil {
+		return file, nil, err
+	}
+	if KindOf(file.Ext) == "" {
+		if text, err := d.fileSvc.ReadDerived(ctx, file.Hash, derivedText); err == nil {
+			return file, parseText(string(text)), nil
+		}
+		text, err := d.officeSvc.GetFileContent(fileId)
+		if err != nil {
+			return file, nil, err
+		}
+		d.saveDerived(ctx, file, derivedText, []byte(text))
+		return file, parseText(text), nil
+	}
+	// csv 以文件名作为表名，纯文本解析很快，都不缓存
+	cacheable := KindOf(file.Ext) != KindCsv && KindOf(file.Ext) != KindText
+	if cacheable {
+		if data, err := d.fileSvc.ReadDerived(ctx, file.Hash, derivedDocument); err == nil {
+			var doc Document
+			if err = json.Unmarshal(data, &doc); err == nil && doc.Kind == KindOf(file.Ext) {
+				return file, &doc, nil
+			}
+		}
+	}
+	content, err := d.fileSvc.GetFileContent(ctx, fileId)
+	if err != nil {
+		return file, nil, err
+	}
+	doc, err := Parse(file.Name, file.Ext, content)
+	if err != nil {
+		elog.Error("parse document failed", zap.Error(err), zap.String("fileId", fileId))
+		return file, nil, err
+	}
+	if cacheable {
+		if data, err := json.Marshal(doc); err == nil {
+			d.saveDerived(ctx, file, derivedDocument, data)
+		}
+	}
+	return file, doc, nil
+}
+
+// saveDerived 缓存失败不影响本次读取
+func (d *DocSvc) saveDerived(ctx context.Context, file dto.FileMeta, name string, data []byte) {
+	if err := d.fileSvc.SaveDerived(ctx, file.Hash, name, data); err != nil {
+		elog.Warn("save derived data failed", zap.Error(err), zap.String("fileId", file.FileID), zap.String("name", name))
+	}
+}
+
+// EditResult 编辑后保存的新版本及变更
+type EditResult struct {
+	FileId     string   `json:"fileId"`
+	Version    int64    `json:"version"`
+	Changes    []Change `json:"changes"`
+	PreviewUrl string   `json:"previewUrl"`
+}
+
+// Edit 对文件执行编辑操作并保存为新版本
+func (d *DocSvc) Edit(ctx context.Context, fileId string, userId string, ops []EditOp) (*EditResult, error) {
+	file, err := d.fileSvc.GetFileMeta(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	content, err := d.fileSvc.GetFileContent(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	content, changes, err := ApplyEdits(file.Ext, content, ops)
+	if err != nil {
+		return nil, err
+	}
+	file, err = d.fileSvc.SaveVersion(ctx, fileId, content, dto.FileVersion{
+		Type:      file.Type,
+		Source:    dto.VersionSourceAi,
+		CreatorId: userId,
+	})
+	if err != nil {
+		elog.Error("save edited file failed", zap.Error(err), zap.String("fileId", fileId))
+		return nil, err
+	}
+	return &EditResult{
+		FileId:     fileId,
+		Version:    file.Version,
+		Changes:    changes,
+		PreviewUrl: d.fileSvc.GetVersionDownloadUrl(fileId, file.Version, 0),
+	}, nil
+}
+
+// CreateFile 把生成的内容保存为新文件，返回文件信息
+func (d *DocSvc) CreateFile(ctx context.Context, name string, userId string, content []byte) (dto.FileMeta, error) {
+	file := dto.FileMeta{
+		Name:       name,
+		Size:       int64(len(content)),
+		FileID:     utils.GenFileGuid(),
+		Type:       mimetype.Detect(content).String(),
+		CreateTime: time.Now().Unix(),
+		Ext:        filepath.Ext(name),
+		CreatorId:  userId,
+	}
+	if err := d.fileSvc.UploadFile(ctx, &file, content); err != nil {
+		elog.Error("save generated file failed", zap.Error(err), zap.String("name", name))
+		return file, err
+	}
+	return file, nil
+}
@@ -0,0 +1,221 @@
+package docsvc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const docxMainPart = "word/document.xml"
+
+var headingNameRe = regexp.MustCompile(`heading\s*(\d)`)
+
+func isWordNs(space string) bool {
+	return space == "http://schemas.openxmlformats.org/wordprocessingml/2006/main" ||
+		space == "http://purl.oclc.org/ooxml/wordprocessingml/main"
+}
+
+// docxParagraph w:p 段落，Start/End 为整个 w:p 元素的字节偏移，ContentEnd 为 </w:p> 的起始位置，
+// PPr、RPr 为段落属性及第一个 run 属性的范围，插入新段落时复用格式
+type docxParagraph struct {
+	Style        string
+	OutlineLevel int // -1 表示未设置
+	Runs         []textSpan
+	Start        int64
+	End          int64
+	ContentEnd   int64
+	PPr          [2]int64
+	RPr          [2]int64
+	inRun        bool
+}
+
+func (p docxParagraph) Text() string {
+	var sb strings.Builder
+	for _, r := range p.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+// parseDocxParagraphs 顺序扫描 document.xml 中的段落，文本框中的段落按出现顺序单独返回
+func parseDocxParagraphs(data []byte) ([]docxParagraph, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		paragraphs []docxParagraph
+		stack      []docxParagraph
+		inText     bool
+		span       textSpan
+	)
+	for {
+		before := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", docxMainPart, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !isWordNs(t.Name.Space) {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				stack = append(stack, docxParagraph{OutlineLevel: -1, Start: before})
+			case "pPr":
+				if len(stack) > 0 && stack[len(stack)-1].PPr[1] == 0 {
+					stack[len(stack)-1].PPr[0] = before
+				}
+			case "r":
+				if len(stack) > 0 {
+					stack[len(stack)-1].inRun = true
+				}
+			case "rPr":
+				if top := len(stack) - 1; top >= 0 && stack[top].inRun && stack[top].RPr[1] == 0 {
+					stack[top].RPr[0] = before
+				}
+			case "pStyle":
+				if len(stack) > 0 {
+					stack[len(stack)-1].Style = attr(t, "val")
+				}
+			case "outlineLvl":
+				if len(stack) > 0 {
+					if lvl, err := strconv.Atoi(attr(t, "val")); err == nil {
+						stack[len(stack)-1].OutlineLevel = lvl
+					}
+				}
+			case "t":
+				if len(stack) > 0 {
+					inText = true
+					span = textSpan{TagStart: before, Start: decoder.InputOffset()}
+				}
+			}
+		case xml.CharData:
+			if inText {
+				span.Text += string(t)
+			}
+		case xml.EndElement:
+			if !isWordNs(t.Name.Space) {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				if inText {
+					inText = false
+					span.End = before
+					stack[len(stack)-1].Runs = append(stack[len(stack)-1].Runs, span)
+				}
+			case "pPr":
+				if top := len(stack) - 1; top >= 0 && stack[top].PPr[1] == 0 {
+					stack[top].PPr[1] = decoder.InputOffset()
+				}
+			case "rPr":
+				if top := len(stack) - 1; top >= 0 && stack[top].inRun && stack[top].RPr[0] > 0 && stack[top].RPr[1] == 0 {
+					stack[top].RPr[1] = decoder.InputOffset()
+				}
+			case "r":
+				if len(stack) > 0 {
+					stack[len(stack)-1].inRun = false
+				}
+			case "p":
+				if len(stack) == 0 {
+					continue
+				}
+				p := stack[len(stack)-1]
+				p.ContentEnd = before
+				p.End = decoder.InputOffset()
+				stack = stack[:len(stack)-1]
+				paragraphs = append(paragraphs, p)
+			}
+		}
+	}
+	return paragraphs, nil
+}
+
+// docxStyles 读取样式 id -> 样式名
+func docxStyles(zr *zip.Reader) map[string]string {
+	data, err := readZipFile(zr, "word/styles.xml")
+	if err != nil {
+		return map[string]string{}
+	}
+	var styles struct {
+		Style []struct {
+			StyleId string `xml:"styleId,attr"`
+			Name    struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	if err = xml.Unmarshal(data, &styles); err != nil {
+		return map[string]string{}
+	}
+	res := make(map[string]string, len(styles.Style))
+	for _, s := range styles.Style {
+		res[s.StyleId] = s.Name.Val
+	}
+	return res
+}
+
+// headingLevel 根据样式名或大纲级别判断标题级别，0 表示正文
+func headingLevel(p docxParagraph, styles map[string]string) int {
+	if p.OutlineLevel >= 0 && p.OutlineLevel < 9 {
+		return p.OutlineLevel + 1
+	}
+	for _, name := range []string{styles[p.Style], p.Style} {
+		name = strings.ToLower(name)
+		if name == "title" {
+			return 1
+		}
+		if m := headingNameRe.FindStringSubmatch(name); m != nil {
+			lvl, _ := strconv.Atoi(m[1])
+			if lvl > 0 {
+				return lvl
+			}
+		}
+	}
+	return 0
+}
+
+// parseDocx 按标题切分章节，第一个标题前的内容作为无标题章节
+func parseDocx(content []byte) (*Document, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readZipFile(zr, docxMainPart)
+	if err != nil {
+		return nil, err
+	}
+	paragraphs, err := parseDocxParagraphs(data)
+	if err != nil {
+		return nil, err
+	}
+	styles := docxStyles(zr)
+
+	doc := &Document{Kind: KindDocx}
+	for i, p := range paragraphs {
+		text := p.Text()
+		if level := headingLevel(p, styles); level > 0 && strings.TrimSpace(text) != "" {
+			doc.Sections = append(doc.Sections, Section{Title: strings.TrimSpace(text), Level: level, titleRef: i})
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if len(doc.Sections) == 0 {
+			doc.Sections = append(doc.Sections, Section{titleRef: -1})
+		}
+		last := &doc.Sections[len(doc.Sections)-1]
+		last.Paragraphs = append(last.Paragraphs, text)
+		last.paragraphRefs = append(last.paragraphRefs, i)
+	}
+	doc.index()
+	return doc, nil
+}
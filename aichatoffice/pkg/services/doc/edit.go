@@ -0,0 +1,225 @@
+package docsvc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidEdit = errors.New("invalid edit operation")
+
+const (
+	EditReplaceText     = "replace_text"
+	EditInsertParagraph = "insert_paragraph"
+	EditSetCell         = "set_cell"
+	EditAddRow          = "add_row"
+)
+
+// EditOp 结构化的编辑操作，段落按 Section/Paragraph 定位（与 read_section、search_document 返回一致），
+// Paragraph 为 -1 表示章节标题；单元格按 Sheet/Cell 定位
+type EditOp struct {
+	Op        string   `json:"op"`
+	Section   int      `json:"section,omitempty"`
+	Paragraph *int     `json:"paragraph,omitempty"`
+	Find      string   `json:"find,omitempty"`
+	Text      string   `json:"text,omitempty"`
+	Sheet     string   `json:"sheet,omitempty"`
+	Cell      string   `json:"cell,omitempty"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// Change 一次编辑产生的变更，用于在回复中展示差异
+type Change struct {
+	Op       string `json:"op"`
+	Location string `json:"location"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after"`
+}
+
+// ApplyEdits 在原文件上依次执行编辑操作，返回新文件内容及变更列表；每个操作后重新解析，后面的操作基于前面的结果定位
+func ApplyEdits(ext string, content []byte, ops []EditOp) ([]byte, []Change, error) {
+	kind := KindOf(ext)
+	if kind != KindDocx && kind != KindXlsx {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedKind, ext)
+	}
+	changes := make([]Change, 0, len(ops))
+	for i, op := range ops {
+		var (
+			change Change
+			err    error
+		)
+		switch {
+		case kind == KindDocx && (op.Op == EditReplaceText || op.Op == EditInsertParagraph):
+			content, change, err = editDocx(content, op)
+		case kind == KindXlsx && (op.Op == EditSetCell || op.Op == EditAddRow):
+			content, change, err = editXlsx(content, op)
+		default:
+			err = fmt.Errorf("%w: %s is not supported for %s", ErrInvalidEdit, op.Op, kind)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("op %d: %w", i, err)
+		}
+		change.Op = op.Op
+		changes = append(changes, change)
+	}
+	return content, changes, nil
+}
+
+func editDocx(content []byte, op EditOp) ([]byte, Change, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	data, err := readZipFile(zr, docxMainPart)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	paragraphs, err := parseDocxParagraphs(data)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	doc, err := parseDocx(content)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	if op.Section < 0 || op.Section >= len(doc.Sections) {
+		return nil, Change{}, fmt.Errorf("%w: section %d out of range [0, %d)", ErrInvalidEdit, op.Section, len(doc.Sections))
+	}
+	section := doc.Sections[op.Section]
+
+	var (
+		splices []splice
+		change  Change
+	)
+	switch op.Op {
+	case EditReplaceText:
+		if op.Paragraph == nil {
+			return nil, Change{}, fmt.Errorf("%w: paragraph is required", ErrInvalidEdit)
+		}
+		ref, err := paragraphRef(section, *op.Paragraph)
+		if err != nil {
+			return nil, Change{}, err
+		}
+		p := paragraphs[ref]
+		before := p.Text()
+		splices, err = replaceParagraphText(data, p, op.Find, op.Text)
+		if err != nil {
+			return nil, Change{}, err
+		}
+		change = Change{Location: paragraphLocation(op.Section, *op.Paragraph), Before: before}
+		if op.Find == "" {
+			change.After = op.Text
+		} else {
+			change.After = strings.Replace(before, op.Find, op.Text, 1)
+		}
+	case EditInsertParagraph:
+		// 默认插入到章节末尾
+		after := len(section.Paragraphs) - 1
+		if op.Paragraph != nil {
+			after = *op.Paragraph
+		}
+		if after < 0 && section.titleRef < 0 {
+			return nil, Change{}, fmt.Errorf("%w: section %d has no title", ErrInvalidEdit, op.Section)
+		}
+		ref, err := paragraphRef(section, after)
+		if err != nil {
+			return nil, Change{}, err
+		}
+		// 格式取章节中的第一个正文段落，避免插入的段落继承标题样式
+		format := paragraphs[ref]
+		if after < 0 {
+			format = docxParagraph{}
+			if len(section.paragraphRefs) > 0 {
+				format = paragraphs[section.paragraphRefs[0]]
+			}
+		}
+		splices = []splice{{Start: paragraphs[ref].End, End: paragraphs[ref].End, Text: newDocxParagraphs(data, paragraphs[ref].Start, format, op.Text)}}
+		change = Change{Location: paragraphLocation(op.Section, after+1), After: op.Text}
+	}
+	data = applySplices(data, splices)
+	content, err = rewriteZip(content, map[string][]byte{docxMainPart: data}, nil)
+	return content, change, err
+}
+
+// paragraphRef 章节内段落序号转为 document.xml 中的段落序号
+func paragraphRef(section Section, paragraph int) (int, error) {
+	if paragraph == -1 {
+		if section.titleRef < 0 {
+			return 0, fmt.Errorf("%w: section %d has no title", ErrInvalidEdit, section.Index)
+		}
+		return section.titleRef, nil
+	}
+	if paragraph < 0 || paragraph >= len(section.paragraphRefs) {
+		return 0, fmt.Errorf("%w: paragraph %d out of range [-1, %d)", ErrInvalidEdit, paragraph, len(section.paragraphRefs))
+	}
+	return section.paragraphRefs[paragraph], nil
+}
+
+func paragraphLocation(section int, paragraph int) string {
+	if paragraph < 0 {
+		return fmt.Sprintf("section %d title", section)
+	}
+	return fmt.Sprintf("section %d paragraph %d", section, paragraph)
+}
+
+// replaceParagraphText 替换段落中第一次出现的 find，find 为空时替换整个段落；
+// 替换的文本写入命中的第一个文本节点，其余命中部分从各自节点中删除，保留各 run 的格式
+func replaceParagraphText(data []byte, p docxParagraph, find string, text string) ([]splice, error) {
+	text = strings.ReplaceAll(text, "\n", " ")
+	full := p.Text()
+	from, to := 0, len(full)
+	if find != "" {
+		from = strings.Index(full, find)
+		if from < 0 {
+			return nil, fmt.Errorf("%w: %q not found in paragraph", ErrInvalidEdit, find)
+		}
+		to = from + len(find)
+	}
+	if len(p.Runs) == 0 {
+		prefix := tagPrefix(data, p.Start)
+		run := fmt.Sprintf("<%sr>%s</%sr>", prefix, textTag(prefix, text), prefix)
+		return []splice{{Start: p.ContentEnd, End: p.ContentEnd, Text: run}}, nil
+	}
+
+	var (
+		splices  []splice
+		offset   int
+		inserted bool
+	)
+	for i, run := range p.Runs {
+		runFrom, runTo := offset, offset+len(run.Text)
+		offset = runTo
+		// 整段替换且段落为空时写入第一个节点
+		overlap := runFrom < to && runTo > from || (from == to && i == 0)
+		if !overlap {
+			continue
+		}
+		cutFrom, cutTo := max(from, runFrom)-runFrom, min(to, runTo)-runFrom
+		newText := run.Text[:cutFrom]
+		if !inserted {
+			newText += text
+			inserted = true
+		}
+		newText += run.Text[cutTo:]
+		splices = append(splices, setSpanText(data, run, newText)...)
+	}
+	return splices, nil
+}
+
+// newDocxParagraphs 按 format 的段落及 run 格式生成新段落，文本中的换行拆成多个段落
+func newDocxParagraphs(data []byte, at int64, format docxParagraph, text string) string {
+	prefix := tagPrefix(data, at)
+	pPr, rPr := "", ""
+	if format.PPr[1] > format.PPr[0] {
+		pPr = string(data[format.PPr[0]:format.PPr[1]])
+	}
+	if format.RPr[1] > format.RPr[0] {
+		rPr = string(data[format.RPr[0]:format.RPr[1]])
+	}
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(&sb, "<%sp>%s<%sr>%s%s</%sr></%sp>", prefix, pPr, prefix, rPr, textTag(prefix, line), prefix, prefix)
+	}
+	return sb.String()
+}
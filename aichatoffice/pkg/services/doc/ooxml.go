@@ -0,0 +1,206 @@
+package docsvc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+var ErrPartNotFound = errors.New("ooxml part not found")
+
+// textSpan 一段文本节点（w:t、a:t、t）在 xml 中的位置，Start/End 是文本内容的字节偏移，
+// TagStart 为开始标签的位置，用于原地修改
+type textSpan struct {
+	Text     string
+	TagStart int64
+	Start    int64
+	End      int64
+}
+
+func openZip(content []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("open ooxml package: %w", err)
+	}
+	return zr, nil
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrPartNotFound, name)
+}
+
+// relsPath 返回 part 对应的关系文件路径，例如 word/document.xml -> word/_rels/document.xml.rels
+func relsPath(part string) string {
+	dir, file := path.Split(part)
+	return path.Join(dir, "_rels", file+".rels")
+}
+
+// relationships 读取 part 的关系，返回 id -> 包内绝对路径
+func relationships(zr *zip.Reader, part string) (map[string]string, error) {
+	data, err := readZipFile(zr, relsPath(part))
+	if err != nil {
+		return nil, err
+	}
+	var rels struct {
+		Relationship []struct {
+			Id         string `xml:"Id,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		}
+	}
+	if err = xml.Unmarshal(data, &rels); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", relsPath(part), err)
+	}
+	res := make(map[string]string, len(rels.Relationship))
+	for _, rel := range rels.Relationship {
+		if rel.TargetMode == "External" {
+			continue
+		}
+		res[rel.Id] = resolveTarget(part, rel.Target)
+	}
+	return res, nil
+}
+
+func resolveTarget(part string, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(path.Dir(part), target)
+}
+
+// attr 按本地名取属性值，忽略命名空间前缀
+func attr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// splice 用 Text 替换 [Start, End) 的内容，Start == End 时为插入
+type splice struct {
+	Start int64
+	End   int64
+	Text  string
+}
+
+// applySplices 按位置从后往前替换，调用方保证各区间不重叠
+func applySplices(data []byte, splices []splice) []byte {
+	sort.SliceStable(splices, func(i, j int) bool {
+		return splices[i].Start > splices[j].Start
+	})
+	res := append([]byte(nil), data...)
+	for _, s := range splices {
+		tail := append([]byte(s.Text), res[s.End:]...)
+		res = append(res[:s.Start], tail...)
+	}
+	return res
+}
+
+func escapeText(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// tagPrefix 取 start 处开始标签的命名空间前缀，例如 <w:p> -> "w:"，没有前缀时返回空
+func tagPrefix(data []byte, start int64) string {
+	end := start + 1
+	for end < int64(len(data)) && !strings.ContainsRune(" />\t\r\n", rune(data[end])) {
+		end++
+	}
+	name := string(data[start+1 : end])
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i+1]
+	}
+	return ""
+}
+
+// textTag 生成文本节点，首尾有空白时需要 xml:space="preserve"
+func textTag(prefix string, text string) string {
+	return fmt.Sprintf(`<%st xml:space="preserve">%s</%st>`, prefix, escapeText(text), prefix)
+}
+
+// setSpanText 修改文本节点的内容，首尾有空白且原标签未声明 preserve 时一并替换开始标签
+func setSpanText(data []byte, span textSpan, text string) []splice {
+	tag := string(data[span.TagStart:span.Start])
+	if strings.HasSuffix(tag, "/>") {
+		prefix := tagPrefix(data, span.TagStart)
+		return []splice{{Start: span.TagStart, End: span.Start, Text: textTag(prefix, text)}}
+	}
+	res := []splice{{Start: span.Start, End: span.End, Text: escapeText(text)}}
+	if text != strings.TrimSpace(text) && !strings.Contains(tag, "xml:space") {
+		res = append(res, splice{Start: span.TagStart, End: span.Start, Text: strings.TrimSuffix(tag, ">") + ` xml:space="preserve">`})
+	}
+	return res
+}
+
+// rewriteZip 复制原包，替换或新增 replace 中的文件并删除 remove 中的文件，未修改的文件直接复制压缩后的数据
+func rewriteZip(content []byte, replace map[string][]byte, remove map[string]bool) ([]byte, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	written := map[string]bool{}
+	write := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		written[name] = true
+		_, err = w.Write(data)
+		return err
+	}
+	for _, f := range zr.File {
+		if remove[f.Name] {
+			continue
+		}
+		data, ok := replace[f.Name]
+		if !ok {
+			if err = zw.Copy(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = write(f.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(replace))
+	for name := range replace {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = write(name, replace[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,161 @@
+package docsvc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const pptxPresentationPart = "ppt/presentation.xml"
+
+// slideParagraph 幻灯片中的一个 a:p 段落，Title 表示属于标题占位符
+type slideParagraph struct {
+	Title bool
+	Runs  []textSpan
+}
+
+func (p slideParagraph) Text() string {
+	var sb strings.Builder
+	for _, r := range p.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+// pptxSlidePaths 按放映顺序返回幻灯片路径
+func pptxSlidePaths(zr *zip.Reader) ([]string, error) {
+	data, err := readZipFile(zr, pptxPresentationPart)
+	if err != nil {
+		return nil, err
+	}
+	var presentation struct {
+		SldId []struct {
+			Attr []xml.Attr `xml:",any,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err = xml.Unmarshal(data, &presentation); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", pptxPresentationPart, err)
+	}
+	rels, err := relationships(zr, pptxPresentationPart)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(presentation.SldId))
+	for _, s := range presentation.SldId {
+		for _, a := range s.Attr {
+			if a.Name.Local == "id" && rels[a.Value] != "" {
+				res = append(res, rels[a.Value])
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseSlideParagraphs 顺序扫描幻灯片中的文本段落，包括表格中的段落
+func parseSlideParagraphs(data []byte) ([]slideParagraph, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		paragraphs []slideParagraph
+		current    *slideParagraph
+		titleShape bool
+		inText     bool
+		span       textSpan
+	)
+	for {
+		before := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse slide: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				titleShape = false
+			case "ph":
+				phType := attr(t, "type")
+				titleShape = phType == "title" || phType == "ctrTitle"
+			case "p":
+				if strings.HasSuffix(t.Name.Space, "drawingml/2006/main") {
+					current = &slideParagraph{Title: titleShape}
+				}
+			case "t":
+				if current != nil {
+					inText = true
+					span = textSpan{TagStart: before, Start: decoder.InputOffset()}
+				}
+			}
+		case xml.CharData:
+			if inText {
+				span.Text += string(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				if inText {
+					inText = false
+					span.End = before
+					current.Runs = append(current.Runs, span)
+				}
+			case "p":
+				if current != nil && strings.HasSuffix(t.Name.Space, "drawingml/2006/main") {
+					paragraphs = append(paragraphs, *current)
+					current = nil
+				}
+			case "sp":
+				titleShape = false
+			}
+		}
+	}
+	return paragraphs, nil
+}
+
+// parsePptx 每页幻灯片作为一个章节，标题取标题占位符的文本
+func parsePptx(content []byte) (*Document, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	slides, err := pptxSlidePaths(zr)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Kind: KindPptx}
+	for i, slide := range slides {
+		data, err := readZipFile(zr, slide)
+		if err != nil {
+			return nil, err
+		}
+		paragraphs, err := parseSlideParagraphs(data)
+		if err != nil {
+			return nil, fmt.Errorf("slide %d: %w", i+1, err)
+		}
+		section := Section{Level: 1}
+		var titles []string
+		for _, p := range paragraphs {
+			text := strings.TrimSpace(p.Text())
+			if text == "" {
+				continue
+			}
+			if p.Title {
+				titles = append(titles, text)
+				continue
+			}
+			section.Paragraphs = append(section.Paragraphs, text)
+		}
+		section.Title = strings.Join(titles, " ")
+		if section.Title == "" {
+			section.Title = fmt.Sprintf("Slide %d", i+1)
+		}
+		doc.Sections = append(doc.Sections, section)
+	}
+	doc.index()
+	return doc, nil
+}
@@ -0,0 +1,360 @@
+package docsvc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrQueryNotAllowed = errors.New("only read-only SELECT queries are allowed")
+
+const (
+	SqlTypeInteger = "INTEGER"
+	SqlTypeReal    = "REAL"
+	SqlTypeText    = "TEXT"
+
+	maxHeaderSearchRows = 5
+
+	// sqliteRecursive 递归 CTE，驱动中没有导出
+	sqliteRecursive = 33
+)
+
+// SqlColumn 表中的一列，Cell 为工作表中的列名
+type SqlColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Cell string `json:"cell"`
+}
+
+// SqlTable 由工作表生成的表
+type SqlTable struct {
+	Name    string      `json:"name"`
+	Sheet   string      `json:"sheet"`
+	Columns []SqlColumn `json:"columns"`
+	Rows    int         `json:"rows"`
+	// HeaderRow 作为列名的行号，从 1 开始，没有表头时为 0
+	HeaderRow int `json:"headerRow"`
+}
+
+// QueryResult 查询结果，超过行数上限时截断
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// SqlDB 把工作表加载为内存中的 SQLite 表，供模型用 SQL 计算，只允许只读查询
+type SqlDB struct {
+	db     *sql.DB
+	conn   *sql.Conn
+	Tables []SqlTable
+}
+
+// SqlTables 工作表对应的表结构：表头作为列名，列类型按全部非空值推断
+func SqlTables(doc *Document) []SqlTable {
+	tables := make([]SqlTable, 0, len(doc.Sheets))
+	names := map[string]bool{}
+	for _, sheet := range doc.Sheets {
+		table, _ := sheetTable(sheet, uniqueName(sqlName(sheet.Name, "sheet"), names))
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// LoadSql 每个工作表生成一张表，加载完成后连接只允许只读查询
+func LoadSql(ctx context.Context, doc *Document) (*SqlDB, error) {
+	if len(doc.Sheets) == 0 {
+		return nil, fmt.Errorf("%w: document has no sheets", ErrUnsupportedKind)
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// 内存库只存在于单个连接上，整个生命周期固定使用这个连接
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SqlDB{db: db, conn: conn}
+	names := map[string]bool{}
+	for _, sheet := range doc.Sheets {
+		table, data := sheetTable(sheet, uniqueName(sqlName(sheet.Name, "sheet"), names))
+		if err := s.load(ctx, table, data); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("load sheet %s: %w", sheet.Name, err)
+		}
+		s.Tables = append(s.Tables, table)
+	}
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected sqlite connection %T", driverConn)
+		}
+		c.RegisterAuthorizer(readOnlyAuthorizer)
+		return nil
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readOnlyAuthorizer 编译语句时只放行查询、读取及函数调用，写入、PRAGMA、ATTACH 等一律拒绝
+func readOnlyAuthorizer(action int, arg1 string, arg2 string, arg3 string) int {
+	switch action {
+	case sqlite3.SQLITE_SELECT, sqlite3.SQLITE_READ, sqlite3.SQLITE_FUNCTION, sqliteRecursive:
+		return sqlite3.SQLITE_OK
+	default:
+		return sqlite3.SQLITE_DENY
+	}
+}
+
+// sheetTable 推断表结构，返回去掉表头及末尾空行后的数据
+func sheetTable(sheet Sheet, name string) (SqlTable, [][]string) {
+	table := SqlTable{Name: name, Sheet: sheet.Name}
+	rows := sheet.Rows
+	if last := lastDataRow(rows); last+1 < len(rows) {
+		rows = rows[:last+1]
+	}
+	_, cols := Sheet{Rows: rows}.Size()
+	if cols == 0 {
+		cols = 1
+	}
+	var data [][]string
+	header := headerRow(rows, cols)
+	if header >= 0 {
+		table.HeaderRow = header + 1
+		data = rows[header+1:]
+	} else {
+		data = rows
+	}
+
+	columnNames := map[string]bool{}
+	for col := 0; col < cols; col++ {
+		column := SqlColumn{Cell: ColumnName(col), Type: inferType(data, col)}
+		header := ""
+		if table.HeaderRow > 0 {
+			header = cellAt(rows[table.HeaderRow-1], col)
+		}
+		column.Name = uniqueName(sqlName(header, strings.ToLower(column.Cell)), columnNames)
+		table.Columns = append(table.Columns, column)
+	}
+	table.Rows = len(data)
+	return table, data
+}
+
+func (s *SqlDB) load(ctx context.Context, table SqlTable, data [][]string) error {
+	defs := make([]string, 0, len(table.Columns))
+	for _, c := range table.Columns {
+		defs = append(defs, quoteIdent(c.Name)+" "+c.Type)
+	}
+	if _, err := s.conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(table.Name), strings.Join(defs, ", "))); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdent(table.Name), placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range data {
+		values := make([]interface{}, len(table.Columns))
+		for col := range values {
+			values[col] = sqlValue(cellAt(row, col), table.Columns[col].Type)
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// headerRow 在前几行中查找表头：非空值都不是数字，且至少占一半的列；表头之前的标题行忽略，没有表头时返回 -1
+func headerRow(rows [][]string, cols int) int {
+	for i := 0; i < len(rows) && i < maxHeaderSearchRows; i++ {
+		filled := 0
+		for _, v := range rows[i] {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if isNumber(v) {
+				return -1
+			}
+			filled++
+		}
+		if filled > 0 && filled*2 >= cols {
+			return i
+		}
+	}
+	return -1
+}
+
+// inferType 非空值都是整数为 INTEGER，都是数字为 REAL，否则为 TEXT
+func inferType(rows [][]string, col int) string {
+	typ := ""
+	for _, row := range rows {
+		v := strings.TrimSpace(cellAt(row, col))
+		if v == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if typ == "" {
+				typ = SqlTypeInteger
+			}
+			continue
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			typ = SqlTypeReal
+			continue
+		}
+		return SqlTypeText
+	}
+	if typ == "" {
+		return SqlTypeText
+	}
+	return typ
+}
+
+// sqlValue 空值写入 NULL，便于 SUM、AVG 等聚合忽略空单元格
+func sqlValue(v string, typ string) interface{} {
+	trimmed := strings.TrimSpace(v)
+	if trimmed == "" {
+		return nil
+	}
+	switch typ {
+	case SqlTypeInteger:
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return i
+		}
+	case SqlTypeReal:
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// sqlName 把表头转换为标识符，保留中文等字符，空白及标点替换为下划线
+func sqlName(s string, fallback string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127 && !isSpaceOrPunct(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name := strings.Trim(b.String(), "_")
+	if name == "" {
+		return fallback
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func isSpaceOrPunct(r rune) bool {
+	return strings.ContainsRune("　，。、；：？！（）【】《》“”‘’·…", r)
+}
+
+func uniqueName(name string, used map[string]bool) string {
+	res := name
+	for i := 2; used[strings.ToLower(res)]; i++ {
+		res = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[strings.ToLower(res)] = true
+	return res
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Query 执行只读查询，超过 maxRows 行时截断，超过 timeout 时中断
+func (s *SqlDB) Query(ctx context.Context, query string, maxRows int, timeout time.Duration) (*QueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	rows, err := s.conn.QueryContext(ctx, query)
+	if err != nil {
+		if strings.Contains(err.Error(), "not authorized") {
+			return nil, fmt.Errorf("%w: %v", ErrQueryNotAllowed, err)
+		}
+		return nil, queryError(ctx, err, timeout)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := &QueryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if len(res.Rows) >= maxRows {
+			res.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		res.Rows = append(res.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, err, timeout)
+	}
+	return res, nil
+}
+
+// Records 把结果转为按列名取值的记录，用作图表数据
+func (r *QueryResult) Records() []map[string]interface{} {
+	records := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		record := make(map[string]interface{}, len(r.Columns))
+		for i, column := range r.Columns {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// queryError 超时后驱动返回的是 interrupted，转换为超时提示
+func queryError(ctx context.Context, err error, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("query timed out after %s", timeout)
+	}
+	return err
+}
+
+func (s *SqlDB) Close() error {
+	s.conn.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,583 @@
+package docsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+// 模板语法为 mustache 的子集：
+//   - {{name}}、{{a.b}} 替换为数据中的值，{{.}} 为列表中的当前项，值中的换行输出为换行符
+//   - {{#name}}…{{/name}} name 为非空数组时逐项重复，为其他真值时输出一次
+//   - {{^name}}…{{/name}} name 为假值、空字符串或空数组时输出
+//
+// 开始、结束标记在同一段落中时按文本处理；跨段落时标记需要单独成段，跨表格单元格或表格行时以表格行为单位重复。
+
+var ErrInvalidTemplate = errors.New("invalid template")
+
+var (
+	templateTagRe  = regexp.MustCompile(`\{\{\s*([#^/]?)\s*([^{}]*?)\s*\}\}`)
+	templateNameRe = regexp.MustCompile(`^(\.|[\p{L}\p{N}_\-]+(\.[\p{L}\p{N}_\-]+)*)$`)
+	// 页眉、页脚同样支持占位符
+	templatePartRe = regexp.MustCompile(`^word/(header|footer)\d*\.xml$`)
+)
+
+type templateNode struct {
+	text     string // 原样输出的内容
+	name     string // 字段名，为空时是文本节点
+	section  bool
+	inverted bool
+	children []templateNode
+}
+
+// parseTemplateNodes 把处理过的 xml 解析为语法树，区块标记必须成对且正确嵌套
+func parseTemplateNodes(src string) ([]templateNode, error) {
+	type frame struct {
+		node  templateNode
+		nodes []templateNode
+	}
+	stack := []frame{{}}
+	pos := 0
+	for _, m := range templateTagRe.FindAllStringSubmatchIndex(src, -1) {
+		top := &stack[len(stack)-1]
+		if m[0] > pos {
+			top.nodes = append(top.nodes, templateNode{text: src[pos:m[0]]})
+		}
+		pos = m[1]
+		kind, name := src[m[2]:m[3]], src[m[4]:m[5]]
+		if !templateNameRe.MatchString(name) {
+			return nil, fmt.Errorf("%w: invalid field name %q", ErrInvalidTemplate, name)
+		}
+		switch kind {
+		case "":
+			top.nodes = append(top.nodes, templateNode{name: name})
+		case "#", "^":
+			if name == "." {
+				return nil, fmt.Errorf("%w: section name must not be \".\"", ErrInvalidTemplate)
+			}
+			stack = append(stack, frame{node: templateNode{name: name, section: true, inverted: kind == "^"}})
+		case "/":
+			if len(stack) == 1 || stack[len(stack)-1].node.name != name {
+				return nil, fmt.Errorf("%w: unexpected {{/%s}}", ErrInvalidTemplate, name)
+			}
+			node := top.node
+			node.children = top.nodes
+			stack = stack[:len(stack)-1]
+			parent := &stack[len(stack)-1]
+			parent.nodes = append(parent.nodes, node)
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("%w: {{#%s}} is not closed", ErrInvalidTemplate, stack[len(stack)-1].node.name)
+	}
+	if pos < len(src) {
+		stack[0].nodes = append(stack[0].nodes, templateNode{text: src[pos:]})
+	}
+	return stack[0].nodes, nil
+}
+
+// templateFields 汇总语法树中引用的字段，同名字段合并
+func templateFields(nodes []templateNode) []dto.TemplateField {
+	var fields []dto.TemplateField
+	index := map[string]int{}
+	add := func(f dto.TemplateField) {
+		i, ok := index[f.Name]
+		if !ok {
+			index[f.Name] = len(fields)
+			fields = append(fields, f)
+			return
+		}
+		if fields[i].Type == dto.TemplateFieldText || f.Type == dto.TemplateFieldList {
+			fields[i].Type = f.Type
+		}
+		fields[i].Fields = mergeTemplateFields(fields[i].Fields, f.Fields)
+	}
+	for _, n := range nodes {
+		switch {
+		case n.name == "" || n.name == ".":
+		case !n.section:
+			add(dto.TemplateField{Name: n.name, Type: dto.TemplateFieldText})
+		default:
+			children := templateFields(n.children)
+			f := dto.TemplateField{Name: n.name, Type: dto.TemplateFieldBool}
+			if len(children) > 0 || hasCurrentItem(n.children) {
+				f.Type, f.Fields = dto.TemplateFieldList, children
+			}
+			add(f)
+		}
+	}
+	return fields
+}
+
+func mergeTemplateFields(a, b []dto.TemplateField) []dto.TemplateField {
+	names := map[string]bool{}
+	for _, f := range a {
+		names[f.Name] = true
+	}
+	for _, f := range b {
+		if !names[f.Name] {
+			a = append(a, f)
+		}
+	}
+	return a
+}
+
+func hasCurrentItem(nodes []templateNode) bool {
+	for _, n := range nodes {
+		if n.name == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// templateContext 字段查找的作用域，内层区块优先
+type templateContext []interface{}
+
+func (c templateContext) lookup(name string) interface{} {
+	if name == "." {
+		return c[len(c)-1]
+	}
+	parts := strings.Split(name, ".")
+	for i := len(c) - 1; i >= 0; i-- {
+		m, ok := c[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		v, ok := m[parts[0]]
+		if !ok {
+			continue
+		}
+		for _, p := range parts[1:] {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[p]
+		}
+		return v
+	}
+	return nil
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case float64:
+		return t != 0
+	case []interface{}:
+		return len(t) > 0
+	default:
+		return true
+	}
+}
+
+// templateValue 把字段值转为文本，对象及数组输出为 JSON
+func templateValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		// 整数不带小数点
+		if t == math.Trunc(t) && math.Abs(t) < 1e15 {
+			return strconv.FormatInt(int64(t), 10)
+		}
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool, json.Number:
+		return fmt.Sprint(t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	}
+}
+
+func renderTemplateNodes(b *strings.Builder, nodes []templateNode, ctx templateContext, prefix string) {
+	for _, n := range nodes {
+		switch {
+		case n.name == "":
+			b.WriteString(n.text)
+		case !n.section:
+			// 占位符位于 w:t 中，换行时先结束当前文本节点
+			lines := strings.Split(strings.ReplaceAll(templateValue(ctx.lookup(n.name)), "\r\n", "\n"), "\n")
+			for i, line := range lines {
+				if i > 0 {
+					fmt.Fprintf(b, `</%st><%sbr/><%st xml:space="preserve">`, prefix, prefix, prefix)
+				}
+				b.WriteString(escapeText(line))
+			}
+		case n.inverted:
+			if !truthy(ctx.lookup(n.name)) {
+				renderTemplateNodes(b, n.children, ctx, prefix)
+			}
+		default:
+			v := ctx.lookup(n.name)
+			if !truthy(v) {
+				continue
+			}
+			if items, ok := v.([]interface{}); ok {
+				for _, item := range items {
+					renderTemplateNodes(b, n.children, append(ctx, item), prefix)
+				}
+				continue
+			}
+			renderTemplateNodes(b, n.children, append(ctx, v), prefix)
+		}
+	}
+}
+
+// parseTableRows 返回所有 w:tr 的范围，按开始位置排序
+func parseTableRows(data []byte) ([][2]int64, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var rows, stack [][2]int64
+	for {
+		before := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if isWordNs(t.Name.Space) && t.Name.Local == "tr" {
+				stack = append(stack, [2]int64{before, 0})
+			}
+		case xml.EndElement:
+			if isWordNs(t.Name.Space) && t.Name.Local == "tr" && len(stack) > 0 {
+				row := stack[len(stack)-1]
+				row[1] = decoder.InputOffset()
+				stack = stack[:len(stack)-1]
+				rows = append(rows, row)
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+	return rows, nil
+}
+
+// innermostRow 包含 [start, end) 的最内层表格行
+func innermostRow(rows [][2]int64, start, end int64) ([2]int64, bool) {
+	var res [2]int64
+	found := false
+	for _, r := range rows {
+		if r[0] <= start && end <= r[1] && (!found || r[0] >= res[0]) {
+			res, found = r, true
+		}
+	}
+	return res, found
+}
+
+// runTexts 删除段落文本中 remove 范围内的内容，并把被拆到多个文本节点中的占位符合并到第一个节点，
+// 返回需要修改的文本节点
+func runTexts(p docxParagraph, remove [][2]int) map[int]string {
+	text := p.Text()
+	owner := make([]int, 0, len(text))
+	for i, r := range p.Runs {
+		for j := 0; j < len(r.Text); j++ {
+			owner = append(owner, i)
+		}
+	}
+	drop := make([]bool, len(text))
+	insert := map[int]string{}
+	changed := map[int]bool{}
+	for _, r := range remove {
+		for i := r[0]; i < r[1]; i++ {
+			drop[i] = true
+			changed[owner[i]] = true
+		}
+	}
+	for _, m := range templateTagRe.FindAllStringIndex(text, -1) {
+		if drop[m[0]] || owner[m[0]] == owner[m[1]-1] {
+			continue
+		}
+		insert[m[0]] = text[m[0]:m[1]]
+		for i := m[0]; i < m[1]; i++ {
+			drop[i] = true
+			changed[owner[i]] = true
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	texts := make([]strings.Builder, len(p.Runs))
+	for i := 0; i < len(text); i++ {
+		if s, ok := insert[i]; ok {
+			texts[owner[i]].WriteString(s)
+		}
+		if !drop[i] {
+			texts[owner[i]].WriteByte(text[i])
+		}
+	}
+	res := map[int]string{}
+	for i := range changed {
+		res[i] = texts[i].String()
+	}
+	return res
+}
+
+// templateTag 段落中的区块标记，start、end 为在段落文本中的位置
+type templateTag struct {
+	para   int
+	start  int
+	end    int
+	kind   string
+	name   string
+	lifted bool
+}
+
+func (t templateTag) String() string {
+	return "{{" + t.kind + t.name + "}}"
+}
+
+// remainText 去掉段落中提出去的区块标记后剩余的文本
+func remainText(text string, tags []templateTag) string {
+	for i := len(tags) - 1; i >= 0; i-- {
+		text = text[:tags[i].start] + text[tags[i].end:]
+	}
+	return strings.TrimSpace(text)
+}
+
+// prepareTemplatePart 合并拆开的占位符，并把跨段落的区块标记提到段落或表格行之外，
+// 之后可以直接在 xml 上按文本处理：
+//   - 区块标记所在的段落只有标记时整段替换为标记，段落中还有其他内容时报错
+//   - 区块标记位于表格中时以表格行为单位重复，只有标记的行整行替换为标记，否则保留该行并移除标记
+func prepareTemplatePart(data []byte) ([]byte, string, error) {
+	paragraphs, err := parseDocxParagraphs(data)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := parseTableRows(data)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.SliceStable(paragraphs, func(i, j int) bool {
+		return paragraphs[i].Start < paragraphs[j].Start
+	})
+	prefix := "w:"
+	if len(paragraphs) > 0 {
+		prefix = tagPrefix(data, paragraphs[0].Start)
+	}
+
+	// 开始、结束标记不在同一段落时需要提出去
+	var tags []templateTag
+	var stack []int
+	for i, p := range paragraphs {
+		text := p.Text()
+		for _, m := range templateTagRe.FindAllStringSubmatchIndex(text, -1) {
+			tag := templateTag{para: i, start: m[0], end: m[1], kind: text[m[2]:m[3]], name: text[m[4]:m[5]]}
+			switch tag.kind {
+			case "":
+				continue
+			case "/":
+				if len(stack) == 0 || tags[stack[len(stack)-1]].name != tag.name {
+					return nil, "", fmt.Errorf("%w: unexpected %s", ErrInvalidTemplate, tag)
+				}
+				open := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if tags[open].para != i {
+					tags[open].lifted, tag.lifted = true, true
+				}
+			default:
+				stack = append(stack, len(tags))
+			}
+			tags = append(tags, tag)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, "", fmt.Errorf("%w: %s is not closed", ErrInvalidTemplate, tags[stack[len(stack)-1]])
+	}
+	lifted := map[int][]templateTag{}
+	for _, t := range tags {
+		if t.lifted {
+			lifted[t.para] = append(lifted[t.para], t)
+		}
+	}
+
+	var splices []splice
+	// 同一位置可能插入多个标记，按文档顺序拼接后一次插入
+	inserts := map[int64]string{}
+	done := map[int]bool{}
+	for i, p := range paragraphs {
+		if done[i] || len(lifted[i]) == 0 {
+			continue
+		}
+		row, inRow := innermostRow(rows, p.Start, p.End)
+		if !inRow {
+			if remainText(p.Text(), lifted[i]) != "" || hasNestedParagraph(paragraphs, p) {
+				return nil, "", fmt.Errorf("%w: %s must be in its own paragraph or table row", ErrInvalidTemplate, lifted[i][0])
+			}
+			var sb strings.Builder
+			for _, t := range lifted[i] {
+				sb.WriteString(t.String())
+			}
+			splices = append(splices, splice{Start: p.Start, End: p.End, Text: sb.String()})
+			done[i] = true
+			continue
+		}
+		empty := true
+		var inside []int
+		for j, q := range paragraphs {
+			if q.Start >= row[0] && q.End <= row[1] {
+				inside = append(inside, j)
+				empty = empty && remainText(q.Text(), lifted[j]) == ""
+			}
+		}
+		var open, closing strings.Builder
+		for _, j := range inside {
+			for _, t := range lifted[j] {
+				if empty || t.kind != "/" {
+					open.WriteString(t.String())
+				} else {
+					closing.WriteString(t.String())
+				}
+			}
+			if empty {
+				done[j] = true
+			}
+		}
+		if empty {
+			splices = append(splices, splice{Start: row[0], End: row[1], Text: open.String()})
+			continue
+		}
+		inserts[row[0]] += open.String()
+		inserts[row[1]] += closing.String()
+		for _, j := range inside {
+			if len(lifted[j]) == 0 || done[j] {
+				continue
+			}
+			// 单元格中至少保留一个段落，只移除标记
+			var remove [][2]int
+			for _, t := range lifted[j] {
+				remove = append(remove, [2]int{t.start, t.end})
+			}
+			for k, s := range runTexts(paragraphs[j], remove) {
+				splices = append(splices, setSpanText(data, paragraphs[j].Runs[k], s)...)
+			}
+			done[j] = true
+		}
+	}
+	for i, p := range paragraphs {
+		if done[i] || !strings.Contains(p.Text(), "{{") {
+			continue
+		}
+		for k, s := range runTexts(p, nil) {
+			splices = append(splices, setSpanText(data, p.Runs[k], s)...)
+		}
+	}
+	for pos, tag := range inserts {
+		if tag != "" {
+			splices = append(splices, splice{Start: pos, End: pos, Text: tag})
+		}
+	}
+	return applySplices(data, splices), prefix, nil
+}
+
+func hasNestedParagraph(paragraphs []docxParagraph, p docxParagraph) bool {
+	for _, q := range paragraphs {
+		if q.Start > p.Start && q.End <= p.End {
+			return true
+		}
+	}
+	return false
+}
+
+// templateParts 模板中需要处理的部件：正文、页眉及页脚
+func templateParts(content []byte) (map[string][]byte, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		if f.Name != docxMainPart && !templatePartRe.MatchString(f.Name) {
+			continue
+		}
+		data, err := readZipFile(zr, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		parts[f.Name] = data
+	}
+	if _, ok := parts[docxMainPart]; !ok {
+		return nil, fmt.Errorf("%w: %s not found", ErrInvalidTemplate, docxMainPart)
+	}
+	return parts, nil
+}
+
+// ParseTemplate 校验模板语法并返回模板中引用的字段
+func ParseTemplate(content []byte) ([]dto.TemplateField, error) {
+	parts, err := templateParts(content)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	// 正文的字段排在前面
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == docxMainPart) != (names[j] == docxMainPart) {
+			return names[i] == docxMainPart
+		}
+		return names[i] < names[j]
+	})
+	var all []templateNode
+	for _, name := range names {
+		data, _, err := prepareTemplatePart(parts[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		nodes, err := parseTemplateNodes(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		all = append(all, nodes...)
+	}
+	return templateFields(all), nil
+}
+
+// RenderTemplate 用数据填充模板，data 一般来自 JSON 解析
+func RenderTemplate(content []byte, data map[string]interface{}) ([]byte, error) {
+	parts, err := templateParts(content)
+	if err != nil {
+		return nil, err
+	}
+	replace := map[string][]byte{}
+	for name, part := range parts {
+		prepared, prefix, err := prepareTemplatePart(part)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		nodes, err := parseTemplateNodes(string(prepared))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		var b strings.Builder
+		renderTemplateNodes(&b, nodes, templateContext{data}, prefix)
+		replace[name] = []byte(b.String())
+	}
+	return rewriteZip(content, replace, nil)
+}
@@ -0,0 +1,66 @@
+package docsvc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// parseText 纯文本及 markdown，按 # 标题切分章节，空行分段
+func parseText(content string) *Document {
+	doc := &Document{Kind: KindText}
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		if len(doc.Sections) == 0 {
+			doc.Sections = append(doc.Sections, Section{})
+		}
+		last := &doc.Sections[len(doc.Sections)-1]
+		last.Paragraphs = append(last.Paragraphs, strings.Join(paragraph, "\n"))
+		paragraph = nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if level := markdownHeadingLevel(trimmed); level > 0 {
+			flush()
+			doc.Sections = append(doc.Sections, Section{Title: strings.TrimSpace(trimmed[level:]), Level: level})
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	doc.index()
+	return doc
+}
+
+func markdownHeadingLevel(line string) int {
+	level := 0
+	for level < len(line) && level < 6 && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level >= len(line) || line[level] != ' ' {
+		return 0
+	}
+	return level
+}
+
+// parseCsv csv 文件作为只有一个工作表的表格
+func parseCsv(name string, content []byte) (*Document, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+	doc := &Document{Kind: KindCsv, Sheets: []Sheet{{Name: name, Rows: rows}}}
+	doc.index()
+	return doc, nil
+}
@@ -0,0 +1,371 @@
+package docsvc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	translateDocxPartRe  = regexp.MustCompile(`^word/(header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+	translateNotesPartRe = regexp.MustCompile(`^ppt/notesSlides/notesSlide\d+\.xml$`)
+	translateSheetPartRe = regexp.MustCompile(`^xl/worksheets/sheet\d+\.xml$`)
+
+	markdownFenceRe  = regexp.MustCompile("^\\s*(```|~~~)")
+	markdownPrefixRe = regexp.MustCompile(`^\s*(?:(?:#{1,6}|>|[-*+](?:\s+\[[ xX]\])?|\d+[.)])\s+)*`)
+	markdownTableRe  = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+)
+
+// translationUnit 一段需要翻译的文本，part 为所在的包内文件，markdown 为空；
+// spans 为组成这段文本的文本节点，译文写入第一个节点，其余节点清空
+type translationUnit struct {
+	part  string
+	spans []textSpan
+}
+
+func (u translationUnit) text() string {
+	var sb strings.Builder
+	for _, s := range u.spans {
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
+// Translation 文件中需要翻译的文本，docx、pptx 按段落，xlsx 按共享字符串及内联字符串，markdown 按行（表格按单元格），
+// 代码块、只有数字和符号的文本不翻译
+type Translation struct {
+	kind    Kind
+	content []byte
+	parts   map[string][]byte
+	units   []translationUnit
+}
+
+// ExtractTranslation 抽取文件中需要翻译的文本
+func ExtractTranslation(ext string, content []byte) (*Translation, error) {
+	t := &Translation{kind: KindOf(ext), content: content, parts: map[string][]byte{}}
+	var err error
+	switch t.kind {
+	case KindDocx:
+		err = t.extractDocx()
+	case KindPptx:
+		err = t.extractPptx()
+	case KindXlsx:
+		err = t.extractXlsx()
+	case KindText:
+		t.extractMarkdown()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKind, ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Texts 按顺序返回需要翻译的文本
+func (t *Translation) Texts() []string {
+	res := make([]string, 0, len(t.units))
+	for _, u := range t.units {
+		res = append(res, u.text())
+	}
+	return res
+}
+
+// Apply 按 Texts 的顺序写回译文，保留原文首尾的空白及各文本节点所在 run 的格式，返回新文件内容
+func (t *Translation) Apply(translated []string) ([]byte, error) {
+	if len(translated) != len(t.units) {
+		return nil, fmt.Errorf("expect %d translations, got %d", len(t.units), len(translated))
+	}
+	splices := map[string][]splice{}
+	for i, u := range t.units {
+		text := keepSpace(u.text(), translated[i])
+		// 只有表格单元格可以保留换行
+		if t.kind != KindXlsx {
+			text = strings.Join(strings.Fields(strings.ReplaceAll(text, "\n", " ")), " ")
+			text = keepSpace(u.text(), text)
+		}
+		for j, span := range u.spans {
+			value := ""
+			if j == 0 {
+				value = text
+			}
+			if t.kind == KindText {
+				splices[u.part] = append(splices[u.part], splice{Start: span.Start, End: span.End, Text: value})
+				continue
+			}
+			splices[u.part] = append(splices[u.part], setSpanText(t.parts[u.part], span, value)...)
+		}
+	}
+	if t.kind == KindText {
+		return applySplices(t.content, splices[""]), nil
+	}
+	replace := make(map[string][]byte, len(splices))
+	for part, s := range splices {
+		replace[part] = applySplices(t.parts[part], s)
+	}
+	return rewriteZip(t.content, replace, nil)
+}
+
+// keepSpace 译文沿用原文首尾的空白
+func keepSpace(source string, text string) string {
+	trimmed := strings.TrimSpace(source)
+	if trimmed == "" {
+		return text
+	}
+	lead := source[:strings.Index(source, trimmed)]
+	trail := source[len(lead)+len(trimmed):]
+	return lead + strings.TrimSpace(text) + trail
+}
+
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+func (t *Translation) add(part string, spans []textSpan) {
+	u := translationUnit{part: part, spans: spans}
+	if len(spans) > 0 && hasLetter(u.text()) {
+		t.units = append(t.units, u)
+	}
+}
+
+// readParts 读取包内的文件，保存原始内容用于写回
+func (t *Translation) readParts(names []string) error {
+	zr, err := openZip(t.content)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := readZipFile(zr, name)
+		if err != nil {
+			return err
+		}
+		t.parts[name] = data
+	}
+	return nil
+}
+
+// matchParts 按名称排序返回匹配的包内文件
+func matchParts(content []byte, re *regexp.Regexp) ([]string, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, f := range zr.File {
+		if re.MatchString(f.Name) {
+			res = append(res, f.Name)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// extractDocx 正文在前，页眉页脚及脚注在后
+func (t *Translation) extractDocx() error {
+	others, err := matchParts(t.content, translateDocxPartRe)
+	if err != nil {
+		return err
+	}
+	names := append([]string{docxMainPart}, others...)
+	if err = t.readParts(names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		paragraphs, err := parseDocxParagraphs(t.parts[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		// 文本框中的段落先于外层段落结束，按起始位置排序恢复阅读顺序
+		sort.SliceStable(paragraphs, func(i, j int) bool {
+			return paragraphs[i].Start < paragraphs[j].Start
+		})
+		for _, p := range paragraphs {
+			t.add(name, p.Runs)
+		}
+	}
+	return nil
+}
+
+// extractPptx 按放映顺序翻译幻灯片，备注页在后
+func (t *Translation) extractPptx() error {
+	zr, err := openZip(t.content)
+	if err != nil {
+		return err
+	}
+	slides, err := pptxSlidePaths(zr)
+	if err != nil {
+		return err
+	}
+	notes, err := matchParts(t.content, translateNotesPartRe)
+	if err != nil {
+		return err
+	}
+	names := append(slides, notes...)
+	if err = t.readParts(names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		paragraphs, err := parseSlideParagraphs(t.parts[name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, p := range paragraphs {
+			t.add(name, p.Runs)
+		}
+	}
+	return nil
+}
+
+// extractXlsx 翻译共享字符串及工作表中的内联字符串，工作表名称被公式引用，不翻译
+func (t *Translation) extractXlsx() error {
+	sheets, err := matchParts(t.content, translateSheetPartRe)
+	if err != nil {
+		return err
+	}
+	names := sheets
+	zr, err := openZip(t.content)
+	if err != nil {
+		return err
+	}
+	if _, err = readZipFile(zr, "xl/sharedStrings.xml"); err == nil {
+		names = append([]string{"xl/sharedStrings.xml"}, sheets...)
+	} else if !errors.Is(err, ErrPartNotFound) {
+		return err
+	}
+	if err = t.readParts(names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		item := "is"
+		if name == "xl/sharedStrings.xml" {
+			item = "si"
+		}
+		items, err := parseStringItems(t.parts[name], item)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, spans := range items {
+			t.add(name, spans)
+		}
+	}
+	return nil
+}
+
+// parseStringItems 读取 si 或 is 中的文本节点，富文本的每个 run 一个节点，忽略注音（rPh）
+func parseStringItems(data []byte, item string) ([][]textSpan, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		res    [][]textSpan
+		spans  []textSpan
+		inItem bool
+		inRPh  bool
+		inText bool
+		span   textSpan
+	)
+	for {
+		before := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case item:
+				inItem, spans = true, nil
+			case "rPh":
+				inRPh = true
+			case "t":
+				if inItem && !inRPh {
+					inText = true
+					span = textSpan{TagStart: before, Start: decoder.InputOffset()}
+				}
+			}
+		case xml.CharData:
+			if inText {
+				span.Text += string(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case item:
+				if inItem {
+					res = append(res, spans)
+				}
+				inItem = false
+			case "rPh":
+				inRPh = false
+			case "t":
+				if inText {
+					inText = false
+					span.End = before
+					spans = append(spans, span)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// extractMarkdown 按行翻译，保留标题、列表、引用等行首标记，表格按单元格翻译，代码块不翻译
+func (t *Translation) extractMarkdown() {
+	var (
+		offset int64
+		inCode bool
+	)
+	for _, line := range strings.SplitAfter(string(t.content), "\n") {
+		start := offset
+		offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+		if markdownFenceRe.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "|") {
+			if markdownTableRe.MatchString(line) {
+				continue
+			}
+			pos := 0
+			for _, cell := range splitTableRow(line) {
+				from := pos
+				pos += len(cell) + 1
+				if strings.TrimSpace(cell) == "" {
+					continue
+				}
+				t.add("", []textSpan{{Text: cell, Start: start + int64(from), End: start + int64(from+len(cell))}})
+			}
+			continue
+		}
+		prefix := markdownPrefixRe.FindString(line)
+		t.add("", []textSpan{{Text: line[len(prefix):], Start: start + int64(len(prefix)), End: start + int64(len(line))}})
+	}
+}
+
+// splitTableRow 按未转义的 | 拆分表格行，返回的各部分连同分隔符拼接后与原行一致
+func splitTableRow(line string) []string {
+	var (
+		res  []string
+		last int
+	)
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			res = append(res, line[last:i])
+			last = i + 1
+		}
+	}
+	return append(res, line[last:])
+}
@@ -0,0 +1,211 @@
+package docsvc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const xlsxWorkbookPart = "xl/workbook.xml"
+
+// xlsxSheetPart 工作表名称及其在包内的路径
+type xlsxSheetPart struct {
+	Name string
+	Path string
+}
+
+func xlsxSheets(zr *zip.Reader) ([]xlsxSheetPart, error) {
+	data, err := readZipFile(zr, xlsxWorkbookPart)
+	if err != nil {
+		return nil, err
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string     `xml:"name,attr"`
+			Attr []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err = xml.Unmarshal(data, &workbook); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", xlsxWorkbookPart, err)
+	}
+	rels, err := relationships(zr, xlsxWorkbookPart)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]xlsxSheetPart, 0, len(workbook.Sheets))
+	for _, s := range workbook.Sheets {
+		for _, a := range s.Attr {
+			if a.Name.Local == "id" && rels[a.Value] != "" {
+				res = append(res, xlsxSheetPart{Name: s.Name, Path: rels[a.Value]})
+			}
+		}
+	}
+	return res, nil
+}
+
+// xlsxSharedStrings 读取共享字符串表，忽略注音（rPh）
+func xlsxSharedStrings(zr *zip.Reader) ([]string, error) {
+	data, err := readZipFile(zr, "xl/sharedStrings.xml")
+	if errors.Is(err, ErrPartNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		res    []string
+		sb     strings.Builder
+		inText bool
+		inRPh  bool
+	)
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse sharedStrings: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				sb.Reset()
+			case "rPh":
+				inRPh = true
+			case "t":
+				inText = !inRPh
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				res = append(res, sb.String())
+			case "rPh":
+				inRPh = false
+			case "t":
+				inText = false
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseSheetRows 读取工作表单元格的显示值，按 r 属性放到对应位置，缺失的单元格为空串
+func parseSheetRows(data []byte, shared []string) ([][]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		rows     [][]string
+		row, col = -1, -1
+		cellType string
+		value    strings.Builder
+		inValue  bool
+	)
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse sheet: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row++
+				col = -1
+				if r, err := strconv.Atoi(attr(t, "r")); err == nil && r > 0 {
+					row = r - 1
+				}
+			case "c":
+				col++
+				if ref, err := ParseCellRef(attr(t, "r")); err == nil {
+					row, col = ref.Row, ref.Col
+				}
+				cellType = attr(t, "t")
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				text := cellValue(cellType, value.String(), shared)
+				if text == "" || row < 0 || col < 0 {
+					continue
+				}
+				for len(rows) <= row {
+					rows = append(rows, nil)
+				}
+				for len(rows[row]) <= col {
+					rows[row] = append(rows[row], "")
+				}
+				rows[row][col] = text
+			}
+		}
+	}
+	return rows, nil
+}
+
+func cellValue(cellType string, raw string, shared []string) string {
+	switch cellType {
+	case "s":
+		idx, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || idx < 0 || idx >= len(shared) {
+			return ""
+		}
+		return shared[idx]
+	case "b":
+		if raw == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return raw
+	}
+}
+
+func parseXlsx(content []byte) (*Document, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := xlsxSheets(zr)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := xlsxSharedStrings(zr)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{Kind: KindXlsx}
+	for _, part := range parts {
+		data, err := readZipFile(zr, part.Path)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := parseSheetRows(data, shared)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", part.Name, err)
+		}
+		doc.Sheets = append(doc.Sheets, Sheet{Name: part.Name, Rows: rows})
+	}
+	doc.index()
+	return doc, nil
+}
@@ -0,0 +1,260 @@
+package docsvc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xlsxCalcChainPart = "xl/calcChain.xml"
+
+var (
+	calcChainRelRe      = regexp.MustCompile(`<Relationship [^>]*Target="[^"]*calcChain\.xml"[^>]*/>`)
+	calcChainOverrideRe = regexp.MustCompile(`<Override [^>]*PartName="/xl/calcChain\.xml"[^>]*/>`)
+)
+
+// sheetPos 工作表 sheetData 中行和单元格的位置
+type sheetPos struct {
+	Start       int64
+	End         int64
+	ContentEnd  int64
+	SelfClosing bool
+	Rows        []rowPos
+}
+
+type rowPos struct {
+	Row         int // 从 0 开始
+	Start       int64
+	End         int64
+	ContentEnd  int64
+	SelfClosing bool
+	Cells       []cellPos
+}
+
+type cellPos struct {
+	Col   int
+	Style string
+	Start int64
+	End   int64
+}
+
+func parseSheetPos(data []byte) (sheetPos, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		pos     sheetPos
+		found   bool
+		current *rowPos
+		nextRow = -1
+	)
+	for {
+		before := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return pos, fmt.Errorf("parse sheet: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sheetData":
+				found = true
+				pos.Start = before
+			case "row":
+				nextRow++
+				if r, err := strconv.Atoi(attr(t, "r")); err == nil && r > 0 {
+					nextRow = r - 1
+				}
+				pos.Rows = append(pos.Rows, rowPos{Row: nextRow, Start: before})
+				current = &pos.Rows[len(pos.Rows)-1]
+			case "c":
+				if current == nil {
+					continue
+				}
+				col := len(current.Cells)
+				if len(current.Cells) > 0 {
+					col = current.Cells[len(current.Cells)-1].Col + 1
+				}
+				if ref, err := ParseCellRef(attr(t, "r")); err == nil {
+					col = ref.Col
+				}
+				current.Cells = append(current.Cells, cellPos{Col: col, Style: attr(t, "s"), Start: before})
+			}
+		case xml.EndElement:
+			after := decoder.InputOffset()
+			switch t.Name.Local {
+			case "sheetData":
+				pos.ContentEnd, pos.End, pos.SelfClosing = before, after, before == after
+			case "row":
+				if current != nil {
+					current.ContentEnd, current.End, current.SelfClosing = before, after, before == after
+					current = nil
+				}
+			case "c":
+				if current != nil && len(current.Cells) > 0 {
+					current.Cells[len(current.Cells)-1].End = after
+				}
+			}
+		}
+	}
+	if !found {
+		return pos, fmt.Errorf("%w: sheetData not found", ErrInvalidEdit)
+	}
+	return pos, nil
+}
+
+// newCell 生成单元格：数字写为数值，以 = 开头写为公式，其余使用内联字符串，不改动共享字符串表
+func newCell(prefix string, ref CellRef, style string, value string) string {
+	attrs := fmt.Sprintf(` r="%s"`, ref.String())
+	if style != "" {
+		attrs += fmt.Sprintf(` s="%s"`, style)
+	}
+	switch {
+	case value == "":
+		return fmt.Sprintf("<%sc%s/>", prefix, attrs)
+	case strings.HasPrefix(value, "=") && len(value) > 1:
+		return fmt.Sprintf("<%sc%s><%sf>%s</%sf></%sc>", prefix, attrs, prefix, escapeText(value[1:]), prefix, prefix)
+	case isNumber(value):
+		return fmt.Sprintf("<%sc%s><%sv>%s</%sv></%sc>", prefix, attrs, prefix, value, prefix, prefix)
+	default:
+		return fmt.Sprintf(`<%sc%s t="inlineStr"><%sis>%s</%sis></%sc>`, prefix, attrs, prefix, textTag(prefix, value), prefix, prefix)
+	}
+}
+
+func isNumber(value string) bool {
+	if strings.TrimSpace(value) != value {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// setCellSplice 修改或新增单元格，缺失的行按行号顺序插入
+func setCellSplice(data []byte, pos sheetPos, ref CellRef, value string) splice {
+	prefix := tagPrefix(data, pos.Start)
+	for _, row := range pos.Rows {
+		if row.Row < ref.Row {
+			continue
+		}
+		if row.Row > ref.Row {
+			text := fmt.Sprintf(`<%srow r="%d">%s</%srow>`, prefix, ref.Row+1, newCell(prefix, ref, "", value), prefix)
+			return splice{Start: row.Start, End: row.Start, Text: text}
+		}
+		for _, cell := range row.Cells {
+			if cell.Col == ref.Col {
+				return splice{Start: cell.Start, End: cell.End, Text: newCell(prefix, ref, cell.Style, value)}
+			}
+			if cell.Col > ref.Col {
+				return splice{Start: cell.Start, End: cell.Start, Text: newCell(prefix, ref, "", value)}
+			}
+		}
+		if row.SelfClosing {
+			open := strings.TrimSpace(strings.TrimSuffix(string(data[row.Start:row.End]), "/>")) + ">"
+			return splice{Start: row.Start, End: row.End, Text: open + newCell(prefix, ref, "", value) + fmt.Sprintf("</%srow>", prefix)}
+		}
+		return splice{Start: row.ContentEnd, End: row.ContentEnd, Text: newCell(prefix, ref, "", value)}
+	}
+	text := fmt.Sprintf(`<%srow r="%d">%s</%srow>`, prefix, ref.Row+1, newCell(prefix, ref, "", value), prefix)
+	if pos.SelfClosing {
+		return splice{Start: pos.Start, End: pos.End, Text: fmt.Sprintf("<%ssheetData>%s</%ssheetData>", prefix, text, prefix)}
+	}
+	return splice{Start: pos.ContentEnd, End: pos.ContentEnd, Text: text}
+}
+
+// lastDataRow 最后一个有内容的行，没有内容时返回 -1
+func lastDataRow(rows [][]string) int {
+	for i := len(rows) - 1; i >= 0; i-- {
+		for _, value := range rows[i] {
+			if value != "" {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// editXlsx 修改单元格后删除计算链，由 Excel 打开时重建，避免公式被覆盖后提示文件损坏
+func editXlsx(content []byte, op EditOp) ([]byte, Change, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	parts, err := xlsxSheets(zr)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	var part xlsxSheetPart
+	for _, p := range parts {
+		if op.Sheet == "" || p.Name == op.Sheet {
+			part = p
+			break
+		}
+	}
+	if part.Path == "" {
+		return nil, Change{}, fmt.Errorf("%w: sheet %q not found", ErrInvalidEdit, op.Sheet)
+	}
+	data, err := readZipFile(zr, part.Path)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	pos, err := parseSheetPos(data)
+	if err != nil {
+		return nil, Change{}, err
+	}
+
+	shared, err := xlsxSharedStrings(zr)
+	if err != nil {
+		return nil, Change{}, err
+	}
+	rows, err := parseSheetRows(data, shared)
+	if err != nil {
+		return nil, Change{}, err
+	}
+
+	var change Change
+	switch op.Op {
+	case EditSetCell:
+		ref, err := ParseCellRef(op.Cell)
+		if err != nil {
+			return nil, Change{}, fmt.Errorf("%w: %v", ErrInvalidEdit, err)
+		}
+		data = applySplices(data, []splice{setCellSplice(data, pos, ref, op.Value)})
+		change = Change{Location: part.Name + "!" + ref.String(), Before: Sheet{Rows: rows}.Cell(ref), After: op.Value}
+	case EditAddRow:
+		if len(op.Values) == 0 {
+			return nil, Change{}, fmt.Errorf("%w: values is required", ErrInvalidEdit)
+		}
+		// 追加到最后一个有内容的行之后，已存在的空行保留原有格式
+		row := lastDataRow(rows) + 1
+		for col, value := range op.Values {
+			if value == "" {
+				continue
+			}
+			if pos, err = parseSheetPos(data); err != nil {
+				return nil, Change{}, err
+			}
+			data = applySplices(data, []splice{setCellSplice(data, pos, CellRef{Row: row, Col: col}, value)})
+		}
+		change = Change{Location: fmt.Sprintf("%s!%d", part.Name, row+1), After: strings.Join(op.Values, "\t")}
+	}
+
+	replace := map[string][]byte{part.Path: data}
+	remove := map[string]bool{}
+	if _, err := readZipFile(zr, xlsxCalcChainPart); err == nil {
+		remove[xlsxCalcChainPart] = true
+		if rels, err := readZipFile(zr, relsPath(xlsxWorkbookPart)); err == nil {
+			replace[relsPath(xlsxWorkbookPart)] = calcChainRelRe.ReplaceAll(rels, nil)
+		}
+		if types, err := readZipFile(zr, "[Content_Types].xml"); err == nil {
+			replace["[Content_Types].xml"] = calcChainOverrideRe.ReplaceAll(types, nil)
+		}
+	}
+	content, err = rewriteZip(content, replace, remove)
+	return content, change, err
+}
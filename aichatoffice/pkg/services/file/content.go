@@ -0,0 +1,150 @@
+package filesvc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	blobsvc "aichatoffice/pkg/services/blob"
+)
+
+// ContentKey 按 SHA-256 保存的内容，内容相同的版本共用一个对象
+func ContentKey(hash string) string {
+	return fmt.Sprintf("contents/sha256/%s/%s", hash[:2], hash)
+}
+
+// DerivedPrefix 由内容生成的数据（提取的文本、解析结果、摘要等），按内容的 SHA-256 保存，内容相同的文件共用
+func DerivedPrefix(hash string) string {
+	return "derived/" + hash + "/"
+}
+
+// versionObjectKey 版本内容所在的对象，去重之前保存的版本仍在版本目录中
+func versionObjectKey(v dto.FileVersion) string {
+	if v.ContentKey != "" {
+		return v.ContentKey
+	}
+	return VersionKey(v.FileId, v.Version, v.Ext)
+}
+
+// contentLock 同一内容的写入与删除在进程内串行，避免删除最后一个引用时另一个版本正引用同一内容
+type contentLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (f *FileService) lockContent(hash string) func() {
+	f.contentMu.Lock()
+	l, ok := f.contentLocks[hash]
+	if !ok {
+		l = &contentLock{}
+		f.contentLocks[hash] = l
+	}
+	l.refs++
+	f.contentMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		f.contentMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(f.contentLocks, hash)
+		}
+		f.contentMu.Unlock()
+	}
+}
+
+// acquireContent 引用内容，内容尚未保存时从 r 读取写入；返回内容所在的对象
+func (f *FileService) acquireContent(ctx context.Context, hash string, r io.Reader, size int64, contentType string) (string, error) {
+	unlock := f.lockContent(hash)
+	defer unlock()
+
+	key := ContentKey(hash)
+	created, err := f.contentStore.AcquireContent(ctx, hash, size)
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		// 对象被意外删除时重新写入
+		_, err = f.blobs.Stat(ctx, key)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, blobsvc.ErrNotFound) {
+			f.releaseContentLocked(ctx, hash)
+			return "", err
+		}
+		elog.Warn("content object missing, store again", zap.String("hash", hash))
+	}
+	if err = f.blobs.Put(ctx, key, r, size, contentType); err != nil {
+		f.releaseContentLocked(ctx, hash)
+		return "", err
+	}
+	return key, nil
+}
+
+// acquireBytes 引用内容，hash 为 content 的 SHA-256
+func (f *FileService) acquireBytes(ctx context.Context, hash string, content []byte, contentType string) (string, error) {
+	return f.acquireContent(ctx, hash, bytes.NewReader(content), int64(len(content)), contentType)
+}
+
+// discardVersion 版本写入后更新文件信息失败时撤销该版本：删除版本记录，释放内容引用及占用的空间
+func (f *FileService) discardVersion(ctx context.Context, v dto.FileVersion, creatorId string) {
+	f.discardVersionContent(ctx, v)
+	f.releaseStorage(ctx, creatorId, v.Size)
+}
+
+// discardVersionContent 删除版本记录并释放内容引用，占用的空间由调用方处理
+func (f *FileService) discardVersionContent(ctx context.Context, v dto.FileVersion) {
+	if err := f.versionStore.DeleteFileVersion(ctx, v.FileId, v.Version); err != nil {
+		elog.Error("delete file version failed", zap.Error(err), zap.String("fileId", v.FileId), zap.Int64("version", v.Version))
+	}
+	f.releaseContent(ctx, v)
+}
+
+// releaseContent 释放版本对内容的引用，最后一个引用释放后删除内容及由其生成的数据，失败只记录日志
+func (f *FileService) releaseContent(ctx context.Context, v dto.FileVersion) {
+	if v.ContentKey == "" || v.Hash == "" {
+		return
+	}
+	unlock := f.lockContent(v.Hash)
+	defer unlock()
+	f.releaseContentLocked(ctx, v.Hash)
+}
+
+func (f *FileService) releaseContentLocked(ctx context.Context, hash string) {
+	remaining, err := f.contentStore.ReleaseContent(ctx, hash)
+	if err != nil {
+		elog.Error("release content failed", zap.Error(err), zap.String("hash", hash))
+		return
+	}
+	if remaining > 0 {
+		return
+	}
+	f.deleteObjectQuietly(ctx, ContentKey(hash))
+	if err = f.DeleteObjects(ctx, DerivedPrefix(hash)); err != nil {
+		elog.Warn("delete derived data failed", zap.Error(err), zap.String("hash", hash))
+	}
+}
+
+// ReadDerived 读取由内容生成的数据，不存在时返回 blobsvc.ErrNotFound
+func (f *FileService) ReadDerived(ctx context.Context, hash string, name string) ([]byte, error) {
+	if hash == "" {
+		return nil, blobsvc.ErrNotFound
+	}
+	return f.ReadObject(ctx, DerivedPrefix(hash)+name)
+}
+
+// SaveDerived 保存由内容生成的数据，随内容的最后一个引用一起删除；hash 为空（如示例文件）时不保存
+func (f *FileService) SaveDerived(ctx context.Context, hash string, name string, data []byte) error {
+	if hash == "" {
+		return nil
+	}
+	return f.PutBytes(ctx, DerivedPrefix(hash)+name, data, "")
+}
@@ -1,30 +1,54 @@
 package filesvc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
-	"github.com/gin-gonic/gin"
 	"github.com/gotomicro/ego/core/econf"
 	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
 
 	"aichatoffice/pkg/models/dto"
 	"aichatoffice/pkg/models/store"
+	blobsvc "aichatoffice/pkg/services/blob"
 )
 
 type FileService struct {
-	store store.FileStore
-}
-
-func NewFileService(s store.FileStore) *FileService {
+	store        store.FileStore
+	versionStore store.FileVersionStore
+	storageStore store.StorageStore
+	contentStore store.ContentStore
+	folderStore  store.FolderStore
+	tagStore     store.TagStore
+	blobs        blobsvc.BlobStore
+	// 版本号在进程内串行分配
+	versionMu    sync.Mutex
+	contentMu    sync.Mutex
+	contentLocks map[string]*contentLock
+	signer       *urlSigner
+}
+
+func NewFileService(s store.FileStore, versionStore store.FileVersionStore, storageStore store.StorageStore, contentStore store.ContentStore, folderStore store.FolderStore, tagStore store.TagStore, blobs blobsvc.BlobStore) *FileService {
 	return &FileService{
-		store: s,
+		store:        s,
+		versionStore: versionStore,
+		storageStore: storageStore,
+		contentStore: contentStore,
+		folderStore:  folderStore,
+		tagStore:     tagStore,
+		blobs:        blobs,
+		contentLocks: map[string]*contentLock{},
+		signer:       newURLSigner(),
 	}
 }
 
@@ -49,13 +73,19 @@ func (f *FileService) InitCaseFile() {
 		// 使用相对路径作为键，将文件内容作为值存入LevelDB
 		key := fmt.Sprintf("case_%s", fileName)
 		ext := filepath.Ext(fileName)
+		// 已存在的示例文件不再覆盖，保留修改后的版本
+		if _, err := f.store.GetFileMeta(context.Background(), key); err == nil {
+			return nil
+		}
 		err = f.store.SetFileMeta(context.Background(), dto.FileMeta{
 			FileID:     key,
 			Name:       fileName,
 			CreateTime: time.Now().Unix(),
+			ModifyTime: time.Now().Unix(),
 			Size:       info.Size(),
 			Type:       mimetype.Detect(data).String(),
 			Ext:        ext,
+			Kind:       dto.FileKindCase,
 		})
 		if err != nil {
 			elog.Panic(fmt.Sprintf("存储文件 %s 到Store 失败: %v", path, err))
@@ -71,114 +101,152 @@ func (f *FileService) InitCaseFile() {
 	}
 }
 
-func (f *FileService) GetFilesList(c *gin.Context) (files []dto.FileMeta, err error) {
-	return f.store.GetFilesList(c)
+// UploadFile 新上传的文件作为第 1 个版本
+func (f *FileService) UploadFile(c context.Context, file *dto.FileMeta, content []byte) error {
+	return f.UploadStream(c, file, bytes.NewReader(content))
+}
+
+func (f *FileService) GetFileMeta(c context.Context, fileId string) (file dto.FileMeta, err error) {
+	return f.getFile(c, fileId)
 }
 
-func (f *FileService) UploadFile(c *gin.Context, file dto.FileMeta, content []byte) error {
-	// 存储文件元数据
-	err := f.store.SetFileMeta(c, file)
+// CheckContentExist 编辑器是否保存过内容
+func (f *FileService) CheckContentExist(c context.Context, fileId string) bool {
+	objects, err := f.blobs.List(c, SdkContentPrefix(fileId))
 	if err != nil {
-		return err
+		elog.Warn("list sdk content failed", zap.Error(err), zap.String("fileId", fileId))
+		return false
 	}
-	// 存储文件内容
-	return f.WriteBytesToFile(content, UploadFilePath(file.FileID, file.Ext))
+	return len(objects) > 0
 }
 
-func (f *FileService) GetFileMeta(c *gin.Context, fileId string) (file dto.FileMeta, err error) {
-	return f.store.GetFileMeta(c, fileId)
+// GetDownloadUrl 当前版本的签名下载地址，expiresIn <= 0 时使用默认有效期
+func (f *FileService) GetDownloadUrl(fileId string, expiresIn time.Duration) string {
+	return f.signedUrl(SignScopeGet, fileId, "/download", nil, expiresIn)
 }
 
-func (f *FileService) CheckContentExist(c *gin.Context, fileId string) bool {
-	dirPath := fmt.Sprintf("%s/%s/content", econf.GetString("case.filepath"), fileId)
-	// 检查是否存在
-	_, err := os.Stat(dirPath)
-	if os.IsNotExist(err) {
-		return false // 路径不存在
-	}
-	if err != nil {
-		return false // 其他错误
+// GetVersionDownloadUrl 指定版本的签名下载地址
+func (f *FileService) GetVersionDownloadUrl(fileId string, version int64, expiresIn time.Duration) string {
+	return f.signedUrl(SignScopeGet, fileId, "/download", url.Values{"version": {strconv.FormatInt(version, 10)}}, expiresIn)
+}
+
+// FillDownloadUrls 填充文件当前版本的签名下载地址
+func (f *FileService) FillDownloadUrls(files []dto.FileMeta) {
+	for i := range files {
+		files[i].DownloadUrl = f.GetDownloadUrl(files[i].FileID, 0)
 	}
-	return true
 }
 
-func (f *FileService) GetDownloadUrl(fileId string) (url string) {
-	host := econf.GetString("host.downloadUrlPrefix")
-	return fmt.Sprintf("%s/showcase/%s/download", host, fileId)
+// FillVersionDownloadUrls 填充各版本的签名下载地址
+func (f *FileService) FillVersionDownloadUrls(versions []dto.FileVersion) {
+	for i := range versions {
+		versions[i].DownloadUrl = f.GetVersionDownloadUrl(versions[i].FileId, versions[i].Version, 0)
+	}
 }
 
-func (f *FileService) GetUploadPathUrl(fileId string, path string) (url string) {
-	host := econf.GetString("host.downloadUrlPrefix")
-	return fmt.Sprintf("%s/showcase/%s/upload/path?path=%s", host, fileId, path)
+// GetUploadPathUrl 编辑器上传对象的签名地址，只能用 PUT 上传到该对象
+func (f *FileService) GetUploadPathUrl(fileId string, path string, expiresIn time.Duration) string {
+	return f.signedUrl(SignScopePut, fileId, "/upload/path", url.Values{"path": {path}}, expiresIn)
 }
 
-func (f *FileService) GetDownloadPathUrl(fileId string, path string, disposition string) (url string) {
-	host := econf.GetString("host.downloadUrlPrefix")
-	return fmt.Sprintf("%s/showcase/%s/download/path?path=%s&disposition=%s", host, fileId, path, disposition)
+// GetDownloadPathUrl 编辑器上传的对象及附件资源的签名下载地址
+func (f *FileService) GetDownloadPathUrl(fileId string, path string, disposition string, expiresIn time.Duration) string {
+	return f.signedUrl(SignScopeGet, fileId, "/download/path", url.Values{"path": {path}, "disposition": {disposition}}, expiresIn)
 }
 
-func (f *FileService) DeleteFile(c *gin.Context, fileId string) (err error) {
+// DeleteFile 彻底删除文件（包括回收站中的）及其所有版本，释放创建人占用的空间；内容只在没有其他版本引用时删除
+func (f *FileService) DeleteFile(c context.Context, fileId string) (err error) {
+	file, err := f.store.GetFileMeta(c, fileId)
+	if err != nil {
+		return err
+	}
+	versions, err := f.versionStore.ListFileVersions(c, fileId)
+	if err != nil {
+		return err
+	}
 	err = f.store.DeleteFileMeta(c, fileId)
 	if err != nil {
 		return err
 	}
-	return f.DeleteFileContent(fmt.Sprintf("%s/%s", econf.GetString("case.filepath"), fileId))
-}
-
-// WriteBytesToFile 将字节数据写入指定文件，如果目录或文件不存在则创建
-func (f *FileService) WriteBytesToFile(data []byte, filePath string) error {
-	// 获取文件所在目录
-	dir := filepath.Dir(filePath)
-
-	// 检查目录是否存在，如果不存在则创建
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		err = os.MkdirAll(dir, 0755) // 创建目录，权限为 0755
-		if err != nil {
-			return err
-		}
+	err = f.versionStore.DeleteFileVersions(c, fileId)
+	if err != nil {
+		return err
 	}
-
-	// 写入文件，如果文件不存在则创建，权限为 0644
-	err := os.WriteFile(filePath, data, 0644)
+	err = f.tagStore.DeleteFileTags(c, fileId)
 	if err != nil {
 		return err
 	}
+	var size int64
+	for _, v := range versions {
+		size += v.Size
+		f.releaseContent(c, v)
+	}
+	f.releaseStorage(c, file.CreatorId, size)
+	return f.DeleteObjects(c, fileId+"/")
+}
 
-	return nil
+// PutObject 写入对象，size 未知时传 -1
+func (f *FileService) PutObject(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	return f.blobs.Put(ctx, key, r, size, contentType)
 }
 
-func (f *FileService) DeleteFileContent(filePath string) (err error) {
-	// 检查路径是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return nil // 如果文件不存在，直接返回成功
+// PutBytes 写入对象，contentType 为空时按内容识别
+func (f *FileService) PutBytes(ctx context.Context, key string, data []byte, contentType string) error {
+	if contentType == "" {
+		contentType = mimetype.Detect(data).String()
 	}
+	return f.blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
 
-	// 尝试删除文件或目录
-	err = os.RemoveAll(filePath)
-	if err != nil {
-		return fmt.Errorf("删除文件失败: %v", err)
+// OpenObject 读取对象，调用方负责关闭；对象不存在时返回 blobsvc.ErrNotFound
+func (f *FileService) OpenObject(ctx context.Context, key string) (io.ReadCloser, *blobsvc.ObjectInfo, error) {
+	return f.blobs.Get(ctx, key)
+}
+
+// OpenObjectSeeker 以可随机读取的方式打开对象，调用方负责关闭；对象不存在时返回 blobsvc.ErrNotFound
+func (f *FileService) OpenObjectSeeker(ctx context.Context, key string) (io.ReadSeekCloser, *blobsvc.ObjectInfo, error) {
+	return blobsvc.Open(ctx, f.blobs, key)
+}
+
+// ReadObject 读取整个对象
+func (f *FileService) ReadObject(ctx context.Context, key string) ([]byte, error) {
+	return blobsvc.ReadAll(ctx, f.blobs, key)
+}
+
+// ListObjects 按 key 顺序返回以 prefix 开头的对象
+func (f *FileService) ListObjects(ctx context.Context, prefix string) ([]blobsvc.ObjectInfo, error) {
+	return f.blobs.List(ctx, prefix)
+}
+
+// DeleteObject 删除对象，对象不存在时不报错
+func (f *FileService) DeleteObject(ctx context.Context, key string) error {
+	return f.blobs.Delete(ctx, key)
+}
+
+// DeleteObjects 删除以 prefix 开头的所有对象，prefix 为目录时需以 / 结尾
+func (f *FileService) DeleteObjects(ctx context.Context, prefix string) error {
+	if err := blobsvc.DeletePrefix(ctx, f.blobs, prefix); err != nil {
+		return fmt.Errorf("删除文件失败: %w", err)
 	}
 	return nil
 }
 
-func (f *FileService) GetFileContent(c *gin.Context, fileId string) (content []byte, err error) {
-	file, err := f.store.GetFileMeta(c, fileId)
+// GetFileContent 读取当前版本的内容
+func (f *FileService) GetFileContent(c context.Context, fileId string) (content []byte, err error) {
+	file, err := f.getFile(c, fileId)
 	if err != nil {
 		return nil, err
 	}
-	filePath := ""
-	if strings.HasPrefix(fileId, "case_") {
-		filePath = ResourceFilePath(fileId[5:], file.Ext)
-	} else {
-		filePath = UploadFilePath(fileId, file.Ext)
-	}
-	return os.ReadFile(filePath)
+	_, content, err = f.GetVersionContent(c, file, file.Version)
+	return content, err
 }
 
-func UploadFilePath(fileID string, fileExt string) string {
-	return filepath.Join(econf.GetString("case.filepath"), fileID, fmt.Sprintf("source%s", fileExt))
+// UploadKey 版本化之前上传的文件内容
+func UploadKey(fileID string, fileExt string) string {
+	return fmt.Sprintf("%s/source%s", fileID, fileExt)
 }
 
-func ResourceFilePath(fileID string, fileExt string) string {
-	return filepath.Join(econf.GetString("case.resourcePath"), fileID, fileExt)
+// ResourceFilePath 示例文件直接以文件名存放在资源目录下
+func ResourceFilePath(fileName string) string {
+	return filepath.Join(econf.GetString("case.resourcePath"), fileName)
 }
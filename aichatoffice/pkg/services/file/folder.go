@@ -0,0 +1,340 @@
+package filesvc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/utils"
+)
+
+const (
+	// 文件列表每页默认及最多的数量
+	defaultPageSize = 50
+	maxPageSize     = 200
+
+	maxNameLen     = 255
+	maxTags        = 32
+	maxTagLen      = 64
+	maxFolderDepth = 32
+)
+
+// QueryFiles 按条件分页查询文件，cursor 为上一页返回的 NextCursor；未指定类别时只返回用户文件，查询回收站时不限类别
+func (f *FileService) QueryFiles(ctx context.Context, query dto.FileQuery, cursor string) (*dto.FileList, error) {
+	if query.Kind == "" && !query.Trashed {
+		query.Kind = dto.FileKindUser
+	}
+	if query.Sort == "" {
+		query.Sort = dto.FileSortModifyTime
+		if query.Trashed {
+			query.Sort = dto.FileSortDeleteTime
+		}
+	}
+	if !validFileSort(query.Sort) {
+		return nil, fmt.Errorf("%w: sort %q", dto.ErrInvalidParam, query.Sort)
+	}
+	if query.TimeField == "" {
+		query.TimeField = dto.FileSortModifyTime
+	}
+	if query.TimeField != dto.FileSortCreateTime && query.TimeField != dto.FileSortModifyTime {
+		return nil, fmt.Errorf("%w: time field %q", dto.ErrInvalidParam, query.TimeField)
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultPageSize
+	}
+	query.Limit = min(query.Limit, maxPageSize)
+	if cursor != "" {
+		after, err := decodeFileCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+	}
+	limit := query.Limit
+	// 多取一个判断是否还有下一页
+	query.Limit++
+	files, total, err := f.store.QueryFiles(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	list := &dto.FileList{Files: files, Total: total}
+	if len(files) > limit {
+		list.Files = files[:limit]
+		list.NextCursor = encodeFileCursor(list.Files[limit-1], query.Sort)
+	}
+	if err = f.FillTags(ctx, list.Files); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func validFileSort(sort string) bool {
+	switch sort {
+	case dto.FileSortName, dto.FileSortSize, dto.FileSortCreateTime, dto.FileSortModifyTime, dto.FileSortDeleteTime:
+		return true
+	}
+	return false
+}
+
+func encodeFileCursor(file dto.FileMeta, sort string) string {
+	c := dto.FileCursor{FileId: file.FileID}
+	switch sort {
+	case dto.FileSortName:
+		c.Value = file.Name
+	case dto.FileSortSize:
+		c.Value = strconv.FormatInt(file.Size, 10)
+	case dto.FileSortCreateTime:
+		c.Value = strconv.FormatInt(file.CreateTime, 10)
+	case dto.FileSortDeleteTime:
+		c.Value = strconv.FormatInt(file.DeleteTime, 10)
+	default:
+		c.Value = strconv.FormatInt(file.ModifyTime, 10)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFileCursor(cursor string) (*dto.FileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor", dto.ErrInvalidParam)
+	}
+	var c dto.FileCursor
+	if err = json.Unmarshal(data, &c); err != nil || c.FileId == "" {
+		return nil, fmt.Errorf("%w: cursor", dto.ErrInvalidParam)
+	}
+	return &c, nil
+}
+
+// FillTags 填充文件的标签
+func (f *FileService) FillTags(ctx context.Context, files []dto.FileMeta) error {
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.FileID)
+	}
+	tags, err := f.tagStore.ListFileTags(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		files[i].Tags = tags[files[i].FileID]
+		if files[i].Tags == nil {
+			files[i].Tags = []string{}
+		}
+	}
+	return nil
+}
+
+// SetTags 替换文件的标签，去掉首尾空白及重复的标签；只有创建人及管理员可以修改
+func (f *FileService) SetTags(ctx context.Context, fileId string, tags []string, userId string, admin bool) ([]string, error) {
+	if _, err := f.getModifiableFile(ctx, fileId, userId, admin); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(tags))
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLen {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d", dto.ErrInvalidParam, tag, maxTagLen)
+		}
+		seen[tag] = true
+		res = append(res, tag)
+	}
+	if len(res) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags", dto.ErrInvalidParam, maxTags)
+	}
+	sort.Strings(res)
+	return res, f.tagStore.SetFileTags(ctx, fileId, res)
+}
+
+// ListTags 所有标签及使用它的文件数
+func (f *FileService) ListTags(ctx context.Context) ([]dto.TagCount, error) {
+	return f.tagStore.ListTags(ctx)
+}
+
+// validateName 文件及文件夹名不能为空，不能包含路径分隔符
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || utf8.RuneCountInString(name) > maxNameLen {
+		return "", fmt.Errorf("%w: name %q", dto.ErrInvalidParam, name)
+	}
+	return name, nil
+}
+
+// getModifiableFile 获取 userId 可以修改的文件，不是创建人或管理员时返回 dto.ErrFilePermissionDenied
+func (f *FileService) getModifiableFile(ctx context.Context, fileId string, userId string, admin bool) (dto.FileMeta, error) {
+	file, err := f.getFile(ctx, fileId)
+	if err != nil {
+		return file, err
+	}
+	if !canModify(file.CreatorId, userId, admin) {
+		return file, dto.ErrFilePermissionDenied
+	}
+	return file, nil
+}
+
+// RenameFile 修改文件名，扩展名决定文件的解析方式，不能修改
+func (f *FileService) RenameFile(ctx context.Context, fileId string, name string, userId string, admin bool) (dto.FileMeta, error) {
+	file, err := f.getModifiableFile(ctx, fileId, userId, admin)
+	if err != nil {
+		return file, err
+	}
+	if name, err = validateName(name); err != nil {
+		return file, err
+	}
+	if !strings.EqualFold(filepath.Ext(name), file.Ext) {
+		return file, fmt.Errorf("%w: extension must be %q", dto.ErrInvalidParam, file.Ext)
+	}
+	if err = f.store.RenameFile(ctx, fileId, name); err != nil {
+		return file, err
+	}
+	file.Name = name
+	return file, nil
+}
+
+// MoveFile 把文件移动到文件夹中，folderId 为空时移动到根目录；文件及目标文件夹都需要 userId 可以修改
+func (f *FileService) MoveFile(ctx context.Context, fileId string, folderId string, userId string, admin bool) (dto.FileMeta, error) {
+	file, err := f.getModifiableFile(ctx, fileId, userId, admin)
+	if err != nil {
+		return file, err
+	}
+	if folderId != "" {
+		if _, err = f.GetWritableFolder(ctx, folderId, userId, admin); err != nil {
+			return file, err
+		}
+	}
+	if err = f.store.MoveFile(ctx, fileId, folderId); err != nil {
+		return file, err
+	}
+	file.FolderId = folderId
+	return file, nil
+}
+
+// GetFolder 文件夹不存在时返回 dto.ErrTargetFolderNotFoundOrNoPerm
+func (f *FileService) GetFolder(ctx context.Context, folderId string) (*dto.Folder, error) {
+	folder, err := f.folderStore.GetFolder(ctx, folderId)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil {
+		return nil, dto.ErrTargetFolderNotFoundOrNoPerm
+	}
+	return folder, nil
+}
+
+// GetWritableFolder 获取 userId 可以写入的文件夹，只有创建人及管理员可以写入，
+// 不存在或没有权限时都返回 dto.ErrTargetFolderNotFoundOrNoPerm
+func (f *FileService) GetWritableFolder(ctx context.Context, folderId string, userId string, admin bool) (*dto.Folder, error) {
+	folder, err := f.GetFolder(ctx, folderId)
+	if err != nil {
+		return nil, err
+	}
+	if !canModify(folder.CreatorId, userId, admin) {
+		return nil, dto.ErrTargetFolderNotFoundOrNoPerm
+	}
+	return folder, nil
+}
+
+// ListFolders 列出文件夹下的子文件夹，parentId 为空时列出根目录
+func (f *FileService) ListFolders(ctx context.Context, parentId string) ([]dto.Folder, error) {
+	if parentId != "" {
+		if _, err := f.GetFolder(ctx, parentId); err != nil {
+			return nil, err
+		}
+	}
+	return f.folderStore.ListFolders(ctx, parentId)
+}
+
+// CreateFolder 在 parentId 下创建文件夹，parentId 为空时在根目录，不为空时需要 creatorId 可以写入（admin 为 true 时不限）
+func (f *FileService) CreateFolder(ctx context.Context, name string, parentId string, creatorId string, admin bool) (dto.Folder, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return dto.Folder{}, err
+	}
+	if parentId != "" {
+		if _, err = f.GetWritableFolder(ctx, parentId, creatorId, admin); err != nil {
+			return dto.Folder{}, err
+		}
+	}
+	now := time.Now().Unix()
+	folder := dto.Folder{
+		FolderId:   utils.GenFileGuid(),
+		Name:       name,
+		ParentId:   parentId,
+		CreatorId:  creatorId,
+		CreateTime: now,
+		ModifyTime: now,
+	}
+	return folder, f.folderStore.AddFolder(ctx, folder)
+}
+
+// UpdateFolder 重命名或移动文件夹，参数为 nil 时不修改；不能移动到自身或其子文件夹中，
+// 文件夹及新的父文件夹都需要 userId 可以写入
+func (f *FileService) UpdateFolder(ctx context.Context, folderId string, name *string, parentId *string, userId string, admin bool) (dto.Folder, error) {
+	folder, err := f.GetWritableFolder(ctx, folderId, userId, admin)
+	if err != nil {
+		return dto.Folder{}, err
+	}
+	if name != nil {
+		if folder.Name, err = validateName(*name); err != nil {
+			return *folder, err
+		}
+	}
+	if parentId != nil && *parentId != folder.ParentId {
+		if *parentId != "" {
+			if _, err = f.GetWritableFolder(ctx, *parentId, userId, admin); err != nil {
+				return *folder, err
+			}
+		}
+		if err = f.checkFolderParent(ctx, folderId, *parentId); err != nil {
+			return *folder, err
+		}
+		folder.ParentId = *parentId
+	}
+	folder.ModifyTime = time.Now().Unix()
+	return *folder, f.folderStore.UpdateFolder(ctx, *folder)
+}
+
+// checkFolderParent 从新的父文件夹向上查找，遇到自身说明会形成循环
+func (f *FileService) checkFolderParent(ctx context.Context, folderId string, parentId string) error {
+	for depth := 0; parentId != ""; depth++ {
+		if parentId == folderId {
+			return fmt.Errorf("%w: cannot move a folder into itself", dto.ErrInvalidParam)
+		}
+		if depth >= maxFolderDepth {
+			return fmt.Errorf("%w: folders are nested too deep", dto.ErrInvalidParam)
+		}
+		parent, err := f.GetFolder(ctx, parentId)
+		if err != nil {
+			return err
+		}
+		parentId = parent.ParentId
+	}
+	return nil
+}
+
+// DeleteFolder 只能删除 userId 可以写入的空文件夹，不为空时返回 dto.ErrFolderNotEmpty
+func (f *FileService) DeleteFolder(ctx context.Context, folderId string, userId string, admin bool) error {
+	if _, err := f.GetWritableFolder(ctx, folderId, userId, admin); err != nil {
+		return err
+	}
+	n, err := f.folderStore.CountFolderChildren(ctx, folderId)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return dto.ErrFolderNotEmpty
+	}
+	return f.folderStore.DeleteFolder(ctx, folderId)
+}
@@ -0,0 +1,309 @@
+package filesvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+// sniffLen 识别文件类型读取的开头字节数，与 mimetype 的默认值一致
+const sniffLen = 3072
+
+// StorageStatus 返回给前端的存储空间状态，LimitBytes、MaxFileSize 为 -1 表示不限制
+type StorageStatus struct {
+	UserId      string `json:"userId"`
+	UsedBytes   int64  `json:"usedBytes"`
+	LimitBytes  int64  `json:"limitBytes"`
+	MaxFileSize int64  `json:"maxFileSize"`
+}
+
+// MaxFileSize 单个文件的大小上限，未配置 storage.maxFileSizeMB 时为 100MB，配置为 0 时返回 -1 表示不限制
+func MaxFileSize() int64 {
+	if econf.Get("storage.maxFileSizeMB") == nil {
+		return 100 << 20
+	}
+	if mb := econf.GetInt64("storage.maxFileSizeMB"); mb > 0 {
+		return mb << 20
+	}
+	return -1
+}
+
+// defaultStorageLimit 用户默认的存储空间（storage.userQuotaMB），未配置或 <= 0 时不限制；
+// 匿名用户为 anonymous.storageMB，未配置或 <= 0 时为 0，不能上传
+func defaultStorageLimit(userId string) int64 {
+	if userId == dto.AnonymousUserId {
+		return max(econf.GetInt64("anonymous.storageMB"), 0) << 20
+	}
+	if mb := econf.GetInt64("storage.userQuotaMB"); mb > 0 {
+		return mb << 20
+	}
+	return -1
+}
+
+// storageAccount 计入存储空间的用户，没有创建人的文件（示例文件及接入用户之前上传的文件）计入匿名用户
+func storageAccount(userId string) string {
+	if userId == "" {
+		return dto.AnonymousUserId
+	}
+	return userId
+}
+
+// StorageStatus 获取用户已用及可用的存储空间
+func (f *FileService) StorageStatus(ctx context.Context, userId string) (*StorageStatus, error) {
+	storage, err := f.storageStore.GetUserStorage(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if storage == nil {
+		storage = &dto.UserStorage{UserId: userId}
+	}
+	limit := storage.LimitBytes
+	if limit == 0 {
+		limit = defaultStorageLimit(userId)
+	}
+	if limit < 0 {
+		limit = -1
+	}
+	return &StorageStatus{
+		UserId:      userId,
+		UsedBytes:   storage.UsedBytes,
+		LimitBytes:  limit,
+		MaxFileSize: MaxFileSize(),
+	}, nil
+}
+
+// SetStorageLimit 设置用户的存储空间，0 恢复为默认值，< 0 不限制
+func (f *FileService) SetStorageLimit(ctx context.Context, userId string, limit int64) (*StorageStatus, error) {
+	if limit < 0 {
+		limit = -1
+	}
+	if err := f.storageStore.SetUserStorageLimit(ctx, userId, limit); err != nil {
+		return nil, err
+	}
+	return f.StorageStatus(ctx, userId)
+}
+
+// remainingStorage 用户剩余的存储空间，-1 表示不限制
+func (f *FileService) remainingStorage(ctx context.Context, userId string) (int64, error) {
+	status, err := f.StorageStatus(ctx, storageAccount(userId))
+	if err != nil || status.LimitBytes < 0 {
+		return -1, err
+	}
+	return max(status.LimitBytes-status.UsedBytes, 0), nil
+}
+
+// reserveStorage 占用存储空间，超过用户的空间时返回 dto.ErrDiskVolumeExceed
+func (f *FileService) reserveStorage(ctx context.Context, userId string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	userId = storageAccount(userId)
+	status, err := f.StorageStatus(ctx, userId)
+	if err != nil {
+		return err
+	}
+	// AddUserStorage 的 limit 为 0 表示不限制，空间为 0 的用户在这里拒绝
+	if status.LimitBytes == 0 {
+		return dto.ErrDiskVolumeExceed
+	}
+	ok, err := f.storageStore.AddUserStorage(ctx, userId, size, status.LimitBytes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return dto.ErrDiskVolumeExceed
+	}
+	return nil
+}
+
+// releaseStorage 释放存储空间，失败只记录日志
+func (f *FileService) releaseStorage(ctx context.Context, userId string, size int64) {
+	if size <= 0 {
+		return
+	}
+	userId = storageAccount(userId)
+	if _, err := f.storageStore.AddUserStorage(ctx, userId, -size, 0); err != nil {
+		elog.Error("release storage failed", zap.Error(err), zap.String("userId", userId), zap.Int64("size", size))
+	}
+}
+
+// CheckSize 检查已知大小的内容是否超过单个文件上限及用户剩余空间，写入时仍以实际占用为准
+func (f *FileService) CheckSize(ctx context.Context, userId string, size int64) error {
+	if limit := MaxFileSize(); limit > 0 && size > limit {
+		return dto.ErrFileTooLarge
+	}
+	remaining, err := f.remainingStorage(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if remaining >= 0 && size > remaining {
+		return dto.ErrDiskVolumeExceed
+	}
+	return nil
+}
+
+// ReserveSize 检查单个文件上限并预先占用已知大小的空间，供分多次接收内容的上传使用，
+// 之后通过 UploadReservedStream 转为文件的占用，或通过 ReleaseSize 释放
+func (f *FileService) ReserveSize(ctx context.Context, userId string, size int64) error {
+	if limit := MaxFileSize(); limit > 0 && size > limit {
+		return dto.ErrFileTooLarge
+	}
+	return f.reserveStorage(ctx, userId, size)
+}
+
+// ReleaseSize 释放 ReserveSize 占用的空间
+func (f *FileService) ReleaseSize(ctx context.Context, userId string, size int64) {
+	f.releaseStorage(ctx, userId, size)
+}
+
+// uploadReader 边读边统计大小、计算 SHA-256，超过上限时返回 err 使存储放弃写入
+type uploadReader struct {
+	r     io.Reader
+	hash  hash.Hash
+	n     int64
+	limit int64 // < 0 不限制
+	err   error
+	// exceeded 超过上限；存储返回的错误可能经过包装，以此为准
+	exceeded bool
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	if u.exceeded {
+		return 0, u.err
+	}
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	u.hash.Write(p[:n])
+	if u.limit >= 0 && u.n > u.limit {
+		u.exceeded = true
+		return n, u.err
+	}
+	return n, err
+}
+
+func (u *uploadReader) sum() string {
+	return hex.EncodeToString(u.hash.Sum(nil))
+}
+
+// newUploadReader 按单个文件上限及用户剩余空间（加上已占用的 reserved）中较小的一个限制读取，同时读取开头用于识别类型
+func (f *FileService) newUploadReader(ctx context.Context, userId string, r io.Reader, reserved int64) (*uploadReader, []byte, error) {
+	u := &uploadReader{hash: sha256.New(), limit: MaxFileSize(), err: dto.ErrFileTooLarge}
+	remaining, err := f.remainingStorage(ctx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if remaining >= 0 {
+		remaining += reserved
+	}
+	if remaining >= 0 && (u.limit < 0 || remaining < u.limit) {
+		u.limit, u.err = remaining, dto.ErrDiskVolumeExceed
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	u.r = io.MultiReader(bytes.NewReader(head), r)
+	return u, head, nil
+}
+
+// UploadStream 流式保存上传的内容作为第 1 个版本，同时统计大小、识别类型并计算 SHA-256，内容相同时复用已保存的对象；
+// 超过单个文件上限返回 dto.ErrFileTooLarge，超过用户剩余空间返回 dto.ErrDiskVolumeExceed
+func (f *FileService) UploadStream(ctx context.Context, file *dto.FileMeta, r io.Reader) error {
+	return f.uploadStream(ctx, file, r, 0)
+}
+
+// UploadReservedStream 与 UploadStream 相同，reserved 为创建人已通过 ReserveSize 占用的空间：
+// 成功后转为文件的占用，失败时仍由调用方持有
+func (f *FileService) UploadReservedStream(ctx context.Context, file *dto.FileMeta, r io.Reader, reserved int64) error {
+	return f.uploadStream(ctx, file, r, reserved)
+}
+
+func (f *FileService) uploadStream(ctx context.Context, file *dto.FileMeta, r io.Reader, reserved int64) error {
+	u, head, err := f.newUploadReader(ctx, file.CreatorId, r, reserved)
+	if err != nil {
+		return err
+	}
+	if file.Type == "" {
+		file.Type = mimetype.Detect(head).String()
+	}
+	if file.Kind == "" {
+		file.Kind = dto.FileKindUser
+	}
+	file.Version = 1
+	file.ModifyTime = file.CreateTime
+	file.ModifierId = file.CreatorId
+	// 写完才知道 SHA-256，先暂存到本地临时文件，内容已存在时不再写入存储
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	_, err = io.Copy(tmp, u)
+	if u.exceeded {
+		return u.err
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	file.Size = u.n
+	file.Hash = u.sum()
+	// 并发上传时剩余空间可能已被占用，以原子占用的结果为准；已占用的部分不再重复占用
+	extra := file.Size - reserved
+	if err = f.reserveStorage(ctx, file.CreatorId, extra); err != nil {
+		return err
+	}
+	v := dto.FileVersion{
+		FileId:     file.FileID,
+		Version:    file.Version,
+		Size:       file.Size,
+		Type:       file.Type,
+		Ext:        file.Ext,
+		Source:     dto.VersionSourceUpload,
+		Hash:       file.Hash,
+		CreatorId:  file.CreatorId,
+		CreateTime: file.CreateTime,
+	}
+	v.ContentKey, err = f.acquireContent(ctx, v.Hash, tmp, v.Size, v.Type)
+	if err != nil {
+		f.releaseStorage(ctx, file.CreatorId, extra)
+		return err
+	}
+	if err = f.versionStore.AddFileVersion(ctx, v); err != nil {
+		f.releaseStorage(ctx, file.CreatorId, extra)
+		f.releaseContent(ctx, v)
+		return err
+	}
+	if err = f.store.SetFileMeta(ctx, *file); err != nil {
+		f.discardVersionContent(ctx, v)
+		f.releaseStorage(ctx, file.CreatorId, extra)
+		return err
+	}
+	// 实际内容比占用的少时释放多余的部分
+	f.releaseStorage(ctx, file.CreatorId, -extra)
+	return nil
+}
+
+func (f *FileService) deleteObjectQuietly(ctx context.Context, key string) {
+	if err := f.blobs.Delete(ctx, key); err != nil {
+		elog.Warn("delete object failed", zap.Error(err), zap.String("key", key))
+	}
+}
@@ -0,0 +1,92 @@
+package filesvc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+)
+
+// getFile 回收站中的文件不能读取或修改，返回 dto.ErrFileInTrash
+func (f *FileService) getFile(ctx context.Context, fileId string) (dto.FileMeta, error) {
+	file, err := f.store.GetFileMeta(ctx, fileId)
+	if err != nil {
+		return file, err
+	}
+	if file.DeleteTime > 0 {
+		return file, dto.ErrFileInTrash
+	}
+	return file, nil
+}
+
+// canModify 只有创建人及管理员可以修改文件或文件夹，没有创建人的（如示例文件）只有管理员可以
+func canModify(creatorId string, userId string, admin bool) bool {
+	return admin || creatorId != "" && creatorId == userId
+}
+
+// TrashFile 把文件移入 userId 的回收站，内容及占用的空间在彻底删除时才释放；
+// 只有创建人及管理员可以删除，否则返回 dto.ErrFilePermissionDenied
+func (f *FileService) TrashFile(ctx context.Context, fileId string, userId string, admin bool) (dto.FileMeta, error) {
+	file, err := f.getFile(ctx, fileId)
+	if err != nil {
+		return file, err
+	}
+	if !canModify(file.CreatorId, userId, admin) {
+		return file, dto.ErrFilePermissionDenied
+	}
+	file.DeleteTime = time.Now().Unix()
+	file.DeleterId = userId
+	ok, err := f.store.TrashFile(ctx, fileId, userId, file.DeleteTime)
+	if err != nil {
+		return file, err
+	}
+	if !ok {
+		return file, dto.ErrFileInTrash
+	}
+	return file, nil
+}
+
+// GetTrashedFile 获取 userId 回收站中的文件，不存在或不是该用户删除的返回 dto.ErrFileNotInTrash
+func (f *FileService) GetTrashedFile(ctx context.Context, fileId string, userId string) (dto.FileMeta, error) {
+	file, err := f.store.GetFileMeta(ctx, fileId)
+	if err != nil || file.DeleteTime == 0 || file.DeleterId != userId {
+		return file, dto.ErrFileNotInTrash
+	}
+	return file, nil
+}
+
+// RestoreFile 从回收站恢复文件，原来的文件夹已删除时恢复到根目录
+func (f *FileService) RestoreFile(ctx context.Context, fileId string, userId string) (dto.FileMeta, error) {
+	file, err := f.GetTrashedFile(ctx, fileId, userId)
+	if err != nil {
+		return file, err
+	}
+	if file.FolderId != "" {
+		folder, err := f.folderStore.GetFolder(ctx, file.FolderId)
+		if err != nil {
+			return file, err
+		}
+		if folder == nil {
+			elog.Info("folder of restored file not found, restore to root", zap.String("fileId", fileId), zap.String("folderId", file.FolderId))
+			file.FolderId = ""
+		}
+	}
+	ok, err := f.store.RestoreFile(ctx, fileId, file.FolderId)
+	if err != nil {
+		return file, err
+	}
+	if !ok {
+		return file, dto.ErrFileNotInTrash
+	}
+	file.DeleteTime = 0
+	file.DeleterId = ""
+	return file, nil
+}
+
+// ListTrashedFiles 在 before 及之前移入回收站的文件，最早删除的在前
+func (f *FileService) ListTrashedFiles(ctx context.Context, before time.Time, limit int) ([]dto.FileMeta, error) {
+	return f.store.ListTrashedFiles(ctx, before.Unix(), limit)
+}
@@ -0,0 +1,292 @@
+package filesvc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	blobsvc "aichatoffice/pkg/services/blob"
+)
+
+// VersionKey 每个版本的内容单独保存，写入后不再修改
+func VersionKey(fileID string, version int64, fileExt string) string {
+	return fmt.Sprintf("%s/versions/%d%s", fileID, version, fileExt)
+}
+
+func isCaseFile(fileId string) bool {
+	return strings.HasPrefix(fileId, "case_")
+}
+
+// ListVersions 按版本倒序返回，示例文件最后附上资源目录中的初始版本
+func (f *FileService) ListVersions(ctx context.Context, fileId string) ([]dto.FileVersion, error) {
+	file, err := f.getFile(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := f.versionStore.ListFileVersions(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if isCaseFile(fileId) {
+		versions = append(versions, dto.FileVersion{
+			FileId:     fileId,
+			Version:    0,
+			Type:       file.Type,
+			Ext:        file.Ext,
+			Source:     dto.VersionSourceCase,
+			CreatorId:  file.CreatorId,
+			CreateTime: file.CreateTime,
+		})
+	}
+	return versions, nil
+}
+
+// resolveVersion 查找版本及其内容所在的对象，示例文件的初始版本 key 为空，内容在资源目录中
+func (f *FileService) resolveVersion(ctx context.Context, file dto.FileMeta, version int64) (*dto.FileVersion, string, error) {
+	if version == 0 {
+		// 示例文件的初始版本及版本化之前上传的文件
+		v := &dto.FileVersion{FileId: file.FileID, Type: file.Type, Ext: file.Ext, Source: dto.VersionSourceUpload, CreateTime: file.CreateTime}
+		// 示例文件随程序发布，始终从资源目录读取
+		if isCaseFile(file.FileID) {
+			v.Source = dto.VersionSourceCase
+			return v, "", nil
+		}
+		key, err := f.legacyUploadKey(ctx, file)
+		if err != nil {
+			return nil, "", err
+		}
+		return v, key, nil
+	}
+	v, err := f.versionStore.GetFileVersion(ctx, file.FileID, version)
+	if err != nil {
+		return nil, "", err
+	}
+	if v == nil {
+		return nil, "", dto.ErrVersionNotFound
+	}
+	return v, versionObjectKey(*v), nil
+}
+
+// PreviousVersion 返回 version 的上一个版本。版本从 1 开始，第一个版本只有示例文件（资源目录中的初始版本）
+// 及版本化之前上传的文件（内容在 UploadKey）才有上一个版本 0，否则返回 dto.ErrNoPreviousVersion
+func (f *FileService) PreviousVersion(ctx context.Context, file dto.FileMeta, version int64) (int64, error) {
+	if version > 1 {
+		return version - 1, nil
+	}
+	if version == 1 {
+		if isCaseFile(file.FileID) {
+			return 0, nil
+		}
+		_, err := f.legacyUploadKey(ctx, file)
+		if err == nil {
+			return 0, nil
+		}
+		if !errors.Is(err, dto.ErrVersionNotFound) {
+			return 0, err
+		}
+	}
+	return 0, dto.ErrNoPreviousVersion
+}
+
+// legacyUploadKey 版本化之前上传的文件内容，版本化之后创建的文件没有，返回 dto.ErrVersionNotFound
+func (f *FileService) legacyUploadKey(ctx context.Context, file dto.FileMeta) (string, error) {
+	key := UploadKey(file.FileID, file.Ext)
+	_, err := f.blobs.Stat(ctx, key)
+	if errors.Is(err, blobsvc.ErrNotFound) {
+		return "", dto.ErrVersionNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// GetVersionContent 读取指定版本的内容
+func (f *FileService) GetVersionContent(ctx context.Context, file dto.FileMeta, version int64) (*dto.FileVersion, []byte, error) {
+	v, key, err := f.resolveVersion(ctx, file, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key == "" {
+		content, err := os.ReadFile(ResourceFilePath(file.FileID[5:]))
+		return v, content, err
+	}
+	content, err := f.ReadObject(ctx, key)
+	return v, content, err
+}
+
+// OpenVersion 以可随机读取的方式打开指定版本的内容，不一次读入内存；调用方负责关闭
+func (f *FileService) OpenVersion(ctx context.Context, file dto.FileMeta, version int64) (*dto.FileVersion, io.ReadSeekCloser, error) {
+	v, key, err := f.resolveVersion(ctx, file, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key == "" {
+		content, err := os.Open(ResourceFilePath(file.FileID[5:]))
+		return v, content, err
+	}
+	content, _, err := blobsvc.Open(ctx, f.blobs, key)
+	return v, content, err
+}
+
+// SaveVersion 保存新的内容为下一个版本，并更新文件的当前版本、修改时间及修改人
+func (f *FileService) SaveVersion(ctx context.Context, fileId string, content []byte, v dto.FileVersion) (dto.FileMeta, error) {
+	f.versionMu.Lock()
+	defer f.versionMu.Unlock()
+
+	file, err := f.getFile(ctx, fileId)
+	if err != nil {
+		return file, err
+	}
+	if v.Ext == "" {
+		v.Ext = file.Ext
+	}
+	if v.Type == "" {
+		v.Type = mimetype.Detect(content).String()
+	}
+	v.FileId = fileId
+	v.Version = file.Version + 1
+	v.Size = int64(len(content))
+	v.CreateTime = time.Now().Unix()
+	sum := sha256.Sum256(content)
+	v.Hash = hex.EncodeToString(sum[:])
+	if limit := MaxFileSize(); limit > 0 && v.Size > limit {
+		return file, dto.ErrFileTooLarge
+	}
+	// 新版本计入文件创建人的空间
+	if err = f.reserveStorage(ctx, file.CreatorId, v.Size); err != nil {
+		return file, err
+	}
+	// 与已有版本内容相同时只增加引用，不再写入
+	v.ContentKey, err = f.acquireBytes(ctx, v.Hash, content, v.Type)
+	if err == nil {
+		err = f.versionStore.AddFileVersion(ctx, v)
+		if err != nil {
+			f.releaseContent(ctx, v)
+		}
+	}
+	if err != nil {
+		f.releaseStorage(ctx, file.CreatorId, v.Size)
+		return file, err
+	}
+
+	updated := file
+	updated.Version = v.Version
+	updated.Size = v.Size
+	updated.Hash = v.Hash
+	updated.ModifyTime = v.CreateTime
+	updated.ModifierId = v.CreatorId
+	if err = f.store.SetFileMeta(ctx, updated); err != nil {
+		f.discardVersion(ctx, v, file.CreatorId)
+		return file, err
+	}
+	file = updated
+	// 非编辑器保存的版本，清掉编辑器缓存的内容，下次打开时重新从下载地址加载
+	if v.Source != dto.VersionSourceSdk {
+		if err := f.DeleteObjects(ctx, SdkContentPrefix(fileId)); err != nil {
+			elog.Warn("clear sdk content failed", zap.Error(err), zap.String("fileId", fileId))
+		}
+	}
+	return file, nil
+}
+
+// CommitSdkUpload 编辑器保存完成后，把上传的对象复制为新版本
+func (f *FileService) CommitSdkUpload(ctx context.Context, fileId string, objectName string, contentType string, modifierId string) (dto.FileMeta, error) {
+	key, err := SdkObjectKey(fileId, objectName)
+	if err != nil {
+		return dto.FileMeta{}, err
+	}
+	content, err := f.ReadObject(ctx, key)
+	if err != nil {
+		return dto.FileMeta{}, fmt.Errorf("read sdk object %s failed: %w", objectName, err)
+	}
+	return f.SaveVersion(ctx, fileId, content, dto.FileVersion{
+		Type:       contentType,
+		Ext:        filepath.Ext(objectName),
+		Source:     dto.VersionSourceSdk,
+		ObjectName: objectName,
+		CreatorId:  modifierId,
+	})
+}
+
+// RestoreVersion 以指定版本的内容创建一个新版本，不修改历史版本；只有创建人及管理员可以恢复，新版本计入创建人的空间
+func (f *FileService) RestoreVersion(ctx context.Context, fileId string, version int64, modifierId string, admin bool) (dto.FileMeta, error) {
+	file, err := f.getModifiableFile(ctx, fileId, modifierId, admin)
+	if err != nil {
+		return file, err
+	}
+	v, content, err := f.GetVersionContent(ctx, file, version)
+	if err != nil {
+		return file, err
+	}
+	return f.SaveVersion(ctx, fileId, content, dto.FileVersion{
+		Type:        v.Type,
+		Ext:         v.Ext,
+		Source:      dto.VersionSourceRestore,
+		RestoreFrom: version,
+		CreatorId:   modifierId,
+	})
+}
+
+// SdkContentPrefix 编辑器保存的内容，存在时编辑器直接加载
+func SdkContentPrefix(fileId string) string {
+	return fileId + "/content/"
+}
+
+// SdkObjectKey 编辑器上传对象及附件资源的存储位置，限定在文件自己的目录中；
+// objectName 不能跳出该目录，也不能覆盖服务管理的版本内容
+func SdkObjectKey(fileId string, objectName string) (string, error) {
+	if strings.Contains(fileId, "/") || blobsvc.ValidateKey(fileId) != nil {
+		return "", fmt.Errorf("%w: file id %q", blobsvc.ErrInvalidKey, fileId)
+	}
+	name := strings.TrimPrefix(objectName, "/")
+	if err := blobsvc.ValidateKey(name); err != nil {
+		return "", err
+	}
+	top, _, nested := strings.Cut(name, "/")
+	if top == "versions" || !nested && strings.HasPrefix(top, "source") {
+		return "", fmt.Errorf("%w: reserved object name %q", blobsvc.ErrInvalidKey, objectName)
+	}
+	return fileId + "/" + name, nil
+}
+
+// PutSdkObject 保存编辑器上传的对象，contentMD5 不为空时校验内容，不一致时不保存并返回 blobsvc.ErrDigestMismatch
+func (f *FileService) PutSdkObject(ctx context.Context, fileId string, objectName string, r io.Reader, size int64, contentType string, contentMD5 string) error {
+	key, err := SdkObjectKey(fileId, objectName)
+	if err != nil {
+		return err
+	}
+	if contentMD5 == "" {
+		return f.blobs.Put(ctx, key, r, size, contentType)
+	}
+	verifier, err := blobsvc.NewMD5Reader(r, contentMD5)
+	if err != nil {
+		return err
+	}
+	err = f.blobs.Put(ctx, key, verifier, size, contentType)
+	if verifier.Mismatch() {
+		return blobsvc.ErrDigestMismatch
+	}
+	return err
+}
+
+// SaveAsset 保存文件的附件资源，与编辑器通过 GetAssetUploadURL 上传的资源存放在同一位置，可通过 GetDownloadPathUrl 下载
+func (f *FileService) SaveAsset(ctx context.Context, fileId string, objectName string, content []byte) error {
+	key, err := SdkObjectKey(fileId, objectName)
+	if err != nil {
+		return err
+	}
+	return f.PutBytes(ctx, key, content, "")
+}
@@ -0,0 +1,88 @@
+package filesvc
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	blobsvc "aichatoffice/pkg/services/blob"
+)
+
+func TestSdkObjectKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		fileId     string
+		objectName string
+		want       string
+	}{
+		{"content", "f1", "/content/1.docx", "f1/content/1.docx"},
+		{"without leading slash", "f1", "content/1.docx", "f1/content/1.docx"},
+		{"asset", "f1", "/assets/charts/c1.png", "f1/assets/charts/c1.png"},
+		{"unicode", "f1", "/assets/图片 1.png", "f1/assets/图片 1.png"},
+		{"source prefix nested", "f1", "/sources/a.docx", "f1/sources/a.docx"},
+		{"empty file id", "", "/content/1.docx", ""},
+		{"file id with slash", "f1/versions", "/1.docx", ""},
+		{"file id traversal", "..", "/content/1.docx", ""},
+		{"file id hidden", ".f1", "/content/1.docx", ""},
+		{"file id backslash", `f1\..`, "/content/1.docx", ""},
+		{"file id nul", "f1\x00", "/content/1.docx", ""},
+		{"empty object", "f1", "", ""},
+		{"root object", "f1", "/", ""},
+		{"traversal", "f1", "/../f2/versions/1.docx", ""},
+		{"nested traversal", "f1", "/content/../../f2/a.docx", ""},
+		{"double slash absolute", "f1", "//etc/passwd", ""},
+		{"backslash traversal", "f1", `/..\f2\a.docx`, ""},
+		{"nul", "f1", "/content/a\x00.docx", ""},
+		{"control", "f1", "/content/a\r\n.docx", ""},
+		{"overlong", "f1", "/" + strings.Repeat("a", 1025), ""},
+		{"versions", "f1", "/versions/1.docx", ""},
+		{"versions dir", "f1", "/versions", ""},
+		{"source", "f1", "/source.docx", ""},
+		{"source without ext", "f1", "/source", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SdkObjectKey(tt.fileId, tt.objectName)
+			if tt.want == "" {
+				if !errors.Is(err, blobsvc.ErrInvalidKey) {
+					t.Errorf("SdkObjectKey(%q, %q) = %q, %v, want ErrInvalidKey", tt.fileId, tt.objectName, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("SdkObjectKey(%q, %q) = %q, %v, want %q", tt.fileId, tt.objectName, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutSdkObjectMD5(t *testing.T) {
+	f := &FileService{blobs: blobsvc.NewLocalStore(t.TempDir())}
+	ctx := context.Background()
+	sum := md5.Sum([]byte("original"))
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	err := f.PutSdkObject(ctx, "f1", "/content/1.docx", strings.NewReader("tampered"), -1, "", digest)
+	if !errors.Is(err, blobsvc.ErrDigestMismatch) {
+		t.Fatalf("put tampered = %v, want ErrDigestMismatch", err)
+	}
+	if _, err = f.ReadObject(ctx, "f1/content/1.docx"); !errors.Is(err, blobsvc.ErrNotFound) {
+		t.Errorf("read after mismatch = %v, want ErrNotFound", err)
+	}
+
+	err = f.PutSdkObject(ctx, "f1", "/content/1.docx", strings.NewReader("original"), -1, "", "bm90IG1kNQ==")
+	if !errors.Is(err, blobsvc.ErrInvalidDigest) {
+		t.Errorf("put with invalid digest = %v, want ErrInvalidDigest", err)
+	}
+
+	if err = f.PutSdkObject(ctx, "f1", "/content/1.docx", strings.NewReader("original"), -1, "", digest); err != nil {
+		t.Fatalf("put original = %v", err)
+	}
+	data, err := f.ReadObject(ctx, "f1/content/1.docx")
+	if err != nil || string(data) != "original" {
+		t.Errorf("read = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,242 @@
+package importsvc
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+
+	"aichatoffice/pkg/models/dto"
+	docsvc "aichatoffice/pkg/services/doc"
+	filesvc "aichatoffice/pkg/services/file"
+	"aichatoffice/pkg/utils"
+)
+
+// officeExts 不能直接解析、由 office 服务提取文本的文档
+var officeExts = map[string]bool{
+	"pdf": true,
+	"doc": true,
+	"xls": true,
+	"ppt": true,
+}
+
+// Supported 是否为可以导入的文档
+func Supported(ext string) bool {
+	return docsvc.KindOf(ext) != "" || officeExts[strings.ToLower(strings.TrimPrefix(ext, "."))]
+}
+
+// ImportSvc 导入 zip 压缩包：先检查条目数、解压后的总大小及压缩比，再在指定文件夹下按压缩包的目录结构
+// 创建文件夹，支持的文档逐个登记为文件，每个条目单独报告结果，部分失败不影响其他条目
+type ImportSvc struct {
+	fileSvc      *filesvc.FileService
+	maxEntries   int
+	maxTotalSize int64
+	maxRatio     uint64
+}
+
+func NewImportSvc(fileSvc *filesvc.FileService) *ImportSvc {
+	s := &ImportSvc{
+		fileSvc:      fileSvc,
+		maxEntries:   econf.GetInt("import.maxEntries"),
+		maxTotalSize: econf.GetInt64("import.maxTotalSizeMB") << 20,
+		maxRatio:     uint64(econf.GetInt64("import.maxRatio")),
+	}
+	if s.maxEntries <= 0 {
+		s.maxEntries = 1000
+	}
+	if s.maxTotalSize <= 0 {
+		s.maxTotalSize = 1 << 30
+	}
+	if s.maxRatio == 0 {
+		s.maxRatio = 100
+	}
+	return s
+}
+
+// MaxArchiveSize 压缩包本身的大小上限，与解压后的总大小上限相同
+func (s *ImportSvc) MaxArchiveSize() int64 {
+	return s.maxTotalSize
+}
+
+// Import 把压缩包导入到 parentId 下以压缩包命名的新文件夹中，parentId 为空时导入到根目录，
+// 不为空时只能是 userId 创建的文件夹（admin 为 true 时不限）；
+// 压缩包无法读取或超过限制时返回 dto.ErrImportFile、dto.ErrImportFileMaxChildrenExceed，不创建任何内容
+func (s *ImportSvc) Import(ctx context.Context, r io.ReaderAt, size int64, name string, parentId string, userId string, admin bool) (*dto.ImportResult, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", dto.ErrImportFile, err)
+	}
+	if err = s.check(zr.File); err != nil {
+		return nil, err
+	}
+	if parentId != "" {
+		if _, err = s.fileSvc.GetWritableFolder(ctx, parentId, userId, admin); err != nil {
+			return nil, err
+		}
+	}
+	folderName := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if strings.TrimSpace(folderName) == "" || folderName == "." {
+		folderName = "import"
+	}
+	root, err := s.fileSvc.CreateFolder(ctx, folderName, parentId, userId, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &importer{svc: s, userId: userId, admin: admin, folders: map[string]string{".": root.FolderId}}
+	result := &dto.ImportResult{Folder: root, Entries: []dto.ImportEntry{}}
+	for _, f := range zr.File {
+		entry, ok := i.importEntry(ctx, f)
+		if !ok {
+			continue
+		}
+		if entry.Error != "" {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	elog.Info("archive imported", zap.String("folderId", root.FolderId), zap.String("userId", userId),
+		zap.Int("succeeded", result.Succeeded), zap.Int("failed", result.Failed))
+	return result, nil
+}
+
+// check 条目数及解压后的总大小按压缩包中记录的大小检查；解压时 archive/zip 会拒绝超过记录大小的内容，
+// 单个条目压缩比过高视为压缩炸弹（1MB 以下的条目不检查）
+func (s *ImportSvc) check(files []*zip.File) error {
+	if len(files) > s.maxEntries {
+		return fmt.Errorf("%w: %d entries, at most %d", dto.ErrImportFileMaxChildrenExceed, len(files), s.maxEntries)
+	}
+	var total uint64
+	for _, f := range files {
+		total += f.UncompressedSize64
+		if total > uint64(s.maxTotalSize) {
+			return fmt.Errorf("%w: uncompressed size exceeds %d bytes", dto.ErrImportFile, s.maxTotalSize)
+		}
+		if f.UncompressedSize64 > f.CompressedSize64*s.maxRatio && f.UncompressedSize64 > 1<<20 {
+			return fmt.Errorf("%w: compression ratio of %s exceeds %d", dto.ErrImportFile, f.Name, s.maxRatio)
+		}
+	}
+	return nil
+}
+
+// importer 一次导入中已创建的文件夹，key 为压缩包内的目录
+type importer struct {
+	svc     *ImportSvc
+	userId  string
+	admin   bool
+	folders map[string]string
+}
+
+// importEntry 导入一个条目，系统生成的条目（如 __MACOSX）跳过，不出现在结果中
+func (i *importer) importEntry(ctx context.Context, f *zip.File) (dto.ImportEntry, bool) {
+	name := entryName(f)
+	entry := dto.ImportEntry{Path: name, Size: int64(f.UncompressedSize64)}
+	if isJunk(name) {
+		return entry, false
+	}
+	p, ok := cleanPath(name)
+	if !ok {
+		entry.Error = "invalid path"
+		return entry, true
+	}
+	entry.Path = p
+	if f.FileInfo().IsDir() {
+		if _, err := i.folder(ctx, p); err != nil {
+			entry.Error = err.Error()
+			return entry, true
+		}
+		return entry, false
+	}
+	base := path.Base(p)
+	ext := filepath.Ext(base)
+	if !Supported(ext) {
+		entry.Error = "unsupported file type"
+		return entry, true
+	}
+	folderId, err := i.folder(ctx, path.Dir(p))
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, true
+	}
+	rc, err := f.Open()
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, true
+	}
+	defer rc.Close()
+	file := dto.FileMeta{
+		Name:       base,
+		FileID:     utils.GenFileGuid(),
+		CreateTime: time.Now().Unix(),
+		Ext:        ext,
+		CreatorId:  i.userId,
+		FolderId:   folderId,
+	}
+	if err = i.svc.fileSvc.UploadStream(ctx, &file, rc); err != nil {
+		elog.Warn("import entry failed", zap.Error(err), zap.String("path", p))
+		entry.Error = err.Error()
+		return entry, true
+	}
+	entry.FileId = file.FileID
+	entry.Size = file.Size
+	return entry, true
+}
+
+// folder 返回目录对应的文件夹，不存在时逐级创建
+func (i *importer) folder(ctx context.Context, dir string) (string, error) {
+	if id, ok := i.folders[dir]; ok {
+		return id, nil
+	}
+	parentId, err := i.folder(ctx, path.Dir(dir))
+	if err != nil {
+		return "", err
+	}
+	folder, err := i.svc.fileSvc.CreateFolder(ctx, path.Base(dir), parentId, i.userId, i.admin)
+	if err != nil {
+		return "", err
+	}
+	i.folders[dir] = folder.FolderId
+	return folder.FolderId, nil
+}
+
+// entryName 不是 UTF-8 的文件名多为 Windows 中文系统创建，按 GB18030 解码
+func entryName(f *zip.File) string {
+	if !f.NonUTF8 || utf8.ValidString(f.Name) {
+		return f.Name
+	}
+	name, err := simplifiedchinese.GB18030.NewDecoder().String(f.Name)
+	if err != nil {
+		return f.Name
+	}
+	return name
+}
+
+// cleanPath 统一为 / 分隔的相对路径，拒绝绝对路径及跳出压缩包的路径
+func cleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	p := path.Clean(name)
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+func isJunk(name string) bool {
+	base := path.Base(strings.TrimSuffix(name, "/"))
+	return strings.HasPrefix(name, "__MACOSX/") || base == ".DS_Store" || base == "Thumbs.db"
+}
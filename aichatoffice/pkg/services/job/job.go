@@ -0,0 +1,369 @@
+package jobsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	"aichatoffice/pkg/utils"
+)
+
+// maxRetryDelay 重试间隔的上限
+const maxRetryDelay = 10 * time.Minute
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrUnknownJobType = errors.New("unknown job type")
+)
+
+// permanentError 不需要重试的错误，例如参数错误
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 包装处理函数返回的错误，任务直接失败，不再重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var perm permanentError
+	return errors.As(err, &perm)
+}
+
+// Handler 执行一种类型的任务，ctx 在任务被取消时结束。失败后可能重试，每次都从头执行：
+// 进度、说明及结果在执行前清空，失败时已通过 AddResult 记录的文件会被删除，其他副作用需处理函数保证可以重复执行
+type Handler func(ctx context.Context, task *Task) error
+
+// Task 正在执行的任务，处理函数通过它读取参数、汇报进度及记录生成的文件
+type Task struct {
+	Job dto.Job
+	svc *JobSvc
+}
+
+// Decode 解析任务参数
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(t.Job.Payload), v)
+}
+
+// Progress 更新进度（0-100）及说明，同时通知订阅者
+func (t *Task) Progress(ctx context.Context, progress int, message string) {
+	t.Job.Progress = min(max(progress, 0), 100)
+	t.Job.Message = message
+	t.Job.UpdateTime = time.Now().Unix()
+	if err := t.svc.store.UpdateJobProgress(ctx, t.Job.JobId, t.Job.Progress, message, t.Job.UpdateTime); err != nil {
+		elog.Error("update job progress failed", zap.Error(err), zap.String("jobId", t.Job.JobId))
+	}
+	t.svc.publish(t.Job)
+}
+
+// AddResult 记录任务生成的文件，任务成功时保存，失败时删除
+func (t *Task) AddResult(fileId string) {
+	t.Job.ResultFileIds = append(t.Job.ResultFileIds, fileId)
+}
+
+// JobSvc 基于数据库的后台任务队列，进程重启后继续执行未完成的任务
+type JobSvc struct {
+	store       store.JobStore
+	handlers    map[string]Handler
+	concurrency int
+	interval    time.Duration
+	maxAttempts int
+	retryDelay  time.Duration
+
+	discard func(ctx context.Context, fileId string) error
+
+	wake    chan struct{}
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	subs    map[string]map[chan dto.Job]struct{}
+}
+
+func NewJobSvc(store store.JobStore) *JobSvc {
+	j := &JobSvc{
+		store:       store,
+		handlers:    map[string]Handler{},
+		concurrency: econf.GetInt("job.concurrency"),
+		interval:    econf.GetDuration("job.pollInterval"),
+		maxAttempts: econf.GetInt("job.maxAttempts"),
+		retryDelay:  econf.GetDuration("job.retryDelay"),
+		wake:        make(chan struct{}, 1),
+		running:     map[string]context.CancelFunc{},
+		subs:        map[string]map[chan dto.Job]struct{}{},
+	}
+	if j.concurrency <= 0 {
+		j.concurrency = 2
+	}
+	if j.interval <= 0 {
+		j.interval = 2 * time.Second
+	}
+	if j.maxAttempts <= 0 {
+		j.maxAttempts = 3
+	}
+	if j.retryDelay <= 0 {
+		j.retryDelay = 10 * time.Second
+	}
+	return j
+}
+
+// SetDiscard 设置删除失败任务已生成文件的方法，需要在 Start 之前调用；未设置时文件保留，只从结果中去掉
+func (j *JobSvc) SetDiscard(discard func(ctx context.Context, fileId string) error) {
+	j.discard = discard
+}
+
+// Register 注册任务类型的处理函数，需要在 Start 之前调用
+func (j *JobSvc) Register(jobType string, handler Handler) {
+	j.handlers[jobType] = handler
+}
+
+// Start 把上次进程中未完成的任务放回队列，并启动 concurrency 个 worker
+func (j *JobSvc) Start(ctx context.Context) error {
+	n, err := j.store.ResetRunningJobs(ctx, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		elog.Info("requeue interrupted jobs", zap.Int64("count", n))
+	}
+	for i := 0; i < j.concurrency; i++ {
+		go j.work(ctx)
+	}
+	return nil
+}
+
+// Enqueue 创建任务，payload 序列化为 JSON 保存
+func (j *JobSvc) Enqueue(ctx context.Context, userId string, jobType string, payload interface{}) (dto.Job, error) {
+	if _, ok := j.handlers[jobType]; !ok {
+		return dto.Job{}, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return dto.Job{}, err
+	}
+	jobId, err := utils.NewGuid(16)
+	if err != nil {
+		return dto.Job{}, err
+	}
+	now := time.Now().Unix()
+	job := dto.Job{
+		JobId:         jobId,
+		Type:          jobType,
+		Status:        dto.JobStatusPending,
+		Payload:       string(data),
+		MaxAttempts:   j.maxAttempts,
+		ResultFileIds: dto.StringList{},
+		CreatorId:     userId,
+		RunAt:         now,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	if err = j.store.AddJob(ctx, job); err != nil {
+		return dto.Job{}, err
+	}
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get 只能查看自己创建的任务
+func (j *JobSvc) Get(ctx context.Context, userId string, jobId string) (*dto.Job, error) {
+	job, err := j.store.GetJob(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.CreatorId != userId {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List 按创建时间倒序返回用户最近的任务
+func (j *JobSvc) List(ctx context.Context, userId string, limit int) ([]dto.Job, error) {
+	return j.store.ListJobs(ctx, userId, limit)
+}
+
+// Cancel 等待中的任务直接取消，执行中的任务结束其 ctx，由 worker 记为已取消
+func (j *JobSvc) Cancel(ctx context.Context, userId string, jobId string) (*dto.Job, error) {
+	if _, err := j.Get(ctx, userId, jobId); err != nil {
+		return nil, err
+	}
+	job, err := j.store.CancelJob(ctx, jobId, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	cancel := j.running[jobId]
+	j.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if job.Status == dto.JobStatusCanceled {
+		j.publish(*job)
+	}
+	return job, nil
+}
+
+// Subscribe 订阅任务的变化，只保留最新的状态；调用方结束时调用返回的函数取消订阅
+func (j *JobSvc) Subscribe(jobId string) (<-chan dto.Job, func()) {
+	ch := make(chan dto.Job, 1)
+	j.mu.Lock()
+	if j.subs[jobId] == nil {
+		j.subs[jobId] = map[chan dto.Job]struct{}{}
+	}
+	j.subs[jobId][ch] = struct{}{}
+	j.mu.Unlock()
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		delete(j.subs[jobId], ch)
+		if len(j.subs[jobId]) == 0 {
+			delete(j.subs, jobId)
+		}
+	}
+}
+
+func (j *JobSvc) publish(job dto.Job) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for ch := range j.subs[job.JobId] {
+		// 订阅者没有及时读取时丢弃旧的状态
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- job
+	}
+}
+
+func (j *JobSvc) work(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		job, err := j.store.ClaimJob(ctx, time.Now().Unix())
+		if err != nil {
+			elog.Error("claim job failed", zap.Error(err))
+		}
+		if job != nil {
+			j.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *JobSvc) run(ctx context.Context, job *dto.Job) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	j.mu.Lock()
+	j.running[job.JobId] = cancel
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		delete(j.running, job.JobId)
+		j.mu.Unlock()
+	}()
+	// 领取任务与登记之间收到的取消请求
+	if latest, err := j.store.GetJob(ctx, job.JobId); err == nil && latest != nil && latest.CancelRequested {
+		cancel()
+	}
+	// 上一次执行失败时的进度及结果不带入本次执行
+	attempt := *job
+	attempt.ResultFileIds, attempt.Progress, attempt.Message = nil, 0, ""
+	j.publish(attempt)
+
+	task := &Task{Job: attempt, svc: j}
+	err := j.handle(runCtx, task)
+	if err != nil {
+		j.discardResults(task.Job)
+		task.Job.ResultFileIds = nil
+	}
+
+	now := time.Now().Unix()
+	res := task.Job
+	res.UpdateTime = now
+	switch {
+	case err == nil:
+		res.Status, res.Progress, res.FinishTime = dto.JobStatusSucceeded, 100, now
+	case runCtx.Err() != nil && ctx.Err() == nil:
+		res.Status, res.Error, res.FinishTime = dto.JobStatusCanceled, context.Canceled.Error(), now
+	case ctx.Err() != nil:
+		// 进程退出，下次启动时重新执行
+		return
+	case !isPermanent(err) && res.Attempts < res.MaxAttempts:
+		res.Status, res.Error = dto.JobStatusPending, err.Error()
+		res.RunAt = now + int64(j.backoff(res.Attempts).Seconds())
+	default:
+		res.Status, res.Error, res.FinishTime = dto.JobStatusFailed, err.Error(), now
+	}
+	if err != nil {
+		elog.Warn("job failed", zap.Error(err), zap.String("jobId", res.JobId), zap.String("type", res.Type),
+			zap.Int("attempts", res.Attempts), zap.String("status", res.Status))
+	}
+	// 任务结束时不受取消影响，确保状态写入
+	if err := j.store.UpdateJobState(context.Background(), res); err != nil {
+		elog.Error("update job state failed", zap.Error(err), zap.String("jobId", res.JobId))
+	}
+	j.publish(res)
+}
+
+// discardResults 删除失败的执行已生成的文件，不受任务取消及进程退出影响
+func (j *JobSvc) discardResults(job dto.Job) {
+	if j.discard == nil {
+		return
+	}
+	for _, fileId := range job.ResultFileIds {
+		if err := j.discard(context.Background(), fileId); err != nil {
+			elog.Error("discard job result failed", zap.Error(err), zap.String("jobId", job.JobId), zap.String("fileId", fileId))
+		}
+	}
+}
+
+// handle 调用处理函数，处理函数 panic 时作为不可重试的错误
+func (j *JobSvc) handle(ctx context.Context, task *Task) (err error) {
+	handler, ok := j.handlers[task.Job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("%w: %s", ErrUnknownJobType, task.Job.Type))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("job panic: %v", r))
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// backoff 重试间隔按次数翻倍
+func (j *JobSvc) backoff(attempts int) time.Duration {
+	delay := j.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
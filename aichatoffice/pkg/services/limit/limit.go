@@ -0,0 +1,260 @@
+package limitsvc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+)
+
+const pruneInterval = time.Minute
+
+// LimitError 被限流时返回，RetryAfter 为建议的重试时间
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter)
+}
+
+// RetryAfterSeconds 用于 Retry-After 响应头，至少 1 秒
+func (e *LimitError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+type Config struct {
+	UserRate            float64 // 每个用户每秒补充的请求数，<= 0 不限制
+	UserBurst           float64
+	KeyRate             float64 // 每个 API Key 每秒补充的请求数，<= 0 不限制
+	KeyBurst            float64
+	ProviderConcurrency int // 每个服务方同时进行中的生成数，<= 0 不限制
+	MaxQueue            int // 排队等待的最大请求数
+	QueueTimeout        time.Duration
+}
+
+// LimitSvc 按用户、API Key 的令牌桶限流，以及按服务方的并发限制
+type LimitSvc struct {
+	config    Config
+	users     *bucketSet
+	keys      *bucketSet
+	mu        sync.Mutex
+	providers map[string]*concurrency
+}
+
+// Status 限流状态
+type Status struct {
+	User      *BucketStatus    `json:"user,omitempty"`
+	Providers []ProviderStatus `json:"providers"`
+}
+
+type BucketStatus struct {
+	Remaining float64 `json:"remaining"`
+	Burst     float64 `json:"burst"`
+	Rate      float64 `json:"rate"`
+}
+
+type ProviderStatus struct {
+	Provider string `json:"provider"`
+	InFlight int    `json:"inFlight"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+}
+
+func NewLimitSvc(config Config) *LimitSvc {
+	return &LimitSvc{
+		config:    config,
+		users:     newBucketSet(config.UserRate, config.UserBurst),
+		keys:      newBucketSet(config.KeyRate, config.KeyBurst),
+		providers: map[string]*concurrency{},
+	}
+}
+
+func NewLimitSvcFromConfig() *LimitSvc {
+	return NewLimitSvc(Config{
+		UserRate:            econf.GetFloat64("rateLimit.userRate"),
+		UserBurst:           econf.GetFloat64("rateLimit.userBurst"),
+		KeyRate:             econf.GetFloat64("rateLimit.keyRate"),
+		KeyBurst:            econf.GetFloat64("rateLimit.keyBurst"),
+		ProviderConcurrency: econf.GetInt("rateLimit.providerConcurrency"),
+		MaxQueue:            econf.GetInt("rateLimit.maxQueue"),
+		QueueTimeout:        econf.GetDuration("rateLimit.queueTimeout"),
+	})
+}
+
+// AllowUser 消耗用户的一个令牌
+func (s *LimitSvc) AllowUser(userId string) error {
+	if ok, retryAfter := s.users.take(userId, time.Now()); !ok {
+		return &LimitError{Reason: "user rate limit exceeded", RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// AllowKey 消耗 API Key 的一个令牌
+func (s *LimitSvc) AllowKey(keyId string) error {
+	if keyId == "" {
+		return nil
+	}
+	if ok, retryAfter := s.keys.take(keyId, time.Now()); !ok {
+		return &LimitError{Reason: "api key rate limit exceeded", RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Acquire 占用服务方的一个并发名额，满了则排队等待 QueueTimeout
+// 成功后必须调用 release 释放
+func (s *LimitSvc) Acquire(ctx context.Context, provider string) (release func(), err error) {
+	c := s.provider(provider)
+	if c == nil {
+		return func() {}, nil
+	}
+	var once sync.Once
+	release = func() {
+		once.Do(func() { <-c.slots })
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	saturated := &LimitError{Reason: "provider is saturated", RetryAfter: s.config.QueueTimeout}
+	if int(c.queued.Add(1)) > s.config.MaxQueue {
+		c.queued.Add(-1)
+		return nil, saturated
+	}
+	defer c.queued.Add(-1)
+
+	timer := time.NewTimer(s.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, saturated
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Status 当前用户的令牌桶及各服务方并发情况
+func (s *LimitSvc) Status(userId string) Status {
+	status := Status{Providers: []ProviderStatus{}}
+	if userId != "" && s.users.rate > 0 {
+		status.User = &BucketStatus{
+			Remaining: s.users.remaining(userId, time.Now()),
+			Burst:     s.users.burst,
+			Rate:      s.users.rate,
+		}
+	}
+	s.mu.Lock()
+	for name, c := range s.providers {
+		status.Providers = append(status.Providers, ProviderStatus{
+			Provider: name,
+			InFlight: len(c.slots),
+			Queued:   int(c.queued.Load()),
+			Capacity: cap(c.slots),
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(status.Providers, func(i, j int) bool {
+		return status.Providers[i].Provider < status.Providers[j].Provider
+	})
+	return status
+}
+
+func (s *LimitSvc) provider(name string) *concurrency {
+	if s.config.ProviderConcurrency <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.providers[name]
+	if !ok {
+		c = &concurrency{slots: make(chan struct{}, s.config.ProviderConcurrency)}
+		s.providers[name] = c
+	}
+	return c
+}
+
+type concurrency struct {
+	slots  chan struct{}
+	queued atomic.Int32
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type bucketSet struct {
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+func newBucketSet(rate float64, burst float64) *bucketSet {
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucketSet{
+		rate:    rate,
+		burst:   burst,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (b *bucketSet) take(key string, now time.Time) (bool, time.Duration) {
+	if b.rate <= 0 {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(now)
+	bk := b.refill(key, now)
+	if bk.tokens >= 1 {
+		bk.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bk.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+func (b *bucketSet) remaining(key string, now time.Time) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refill(key, now).tokens
+}
+
+func (b *bucketSet) refill(key string, now time.Time) *bucket {
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: b.burst, last: now}
+		b.buckets[key] = bk
+		return bk
+	}
+	bk.tokens = math.Min(b.burst, bk.tokens+now.Sub(bk.last).Seconds()*b.rate)
+	bk.last = now
+	return bk
+}
+
+// prune 删除已经补满的桶，避免 key 无限增长
+func (b *bucketSet) prune(now time.Time) {
+	if now.Sub(b.lastPrune) < pruneInterval {
+		return
+	}
+	b.lastPrune = now
+	for key, bk := range b.buckets {
+		if bk.tokens+now.Sub(bk.last).Seconds()*b.rate >= b.burst {
+			delete(b.buckets, key)
+		}
+	}
+}
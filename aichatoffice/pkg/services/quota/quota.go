@@ -0,0 +1,145 @@
+package quotasvc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/cetus/l"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	aisvc "aichatoffice/pkg/services/ai"
+)
+
+// QuotaSvc 本地试用额度，未配置 AI 模型时使用独立的 trial 配置
+type QuotaSvc struct {
+	store        store.QuotaStore
+	trial        aisvc.AiSvc
+	freeRequests int64
+	freeTokens   int64
+	// 匿名用户共用的额度，默认不能试用
+	anonymousRequests int64
+	anonymousTokens   int64
+}
+
+// QuotaStatus 返回给前端的额度状态
+type QuotaStatus struct {
+	UserId            string `json:"userId"`
+	FreeRequests      int64  `json:"freeRequests"`
+	UsedRequests      int64  `json:"usedRequests"`
+	RemainingRequests int64  `json:"remainingRequests"`
+	FreeTokens        int64  `json:"freeTokens"`
+	UsedTokens        int64  `json:"usedTokens"`
+	RemainingTokens   int64  `json:"remainingTokens"` // -1 表示不限制
+	TrialAvailable    bool   `json:"trialAvailable"`
+}
+
+func NewQuotaSvc(s store.QuotaStore) *QuotaSvc {
+	q := &QuotaSvc{
+		store:        s,
+		freeRequests: econf.GetInt64("quota.freeRequests"),
+		freeTokens:   econf.GetInt64("quota.freeTokens"),
+
+		anonymousRequests: econf.GetInt64("anonymous.freeRequests"),
+		anonymousTokens:   econf.GetInt64("anonymous.freeTokens"),
+	}
+	if econf.GetString("quota.trial.token") != "" {
+		q.trial = aisvc.NewOpenAIWithConfig(aisvc.OpenAiConfig{
+			BaseUrl:   econf.GetString("quota.trial.baseUrl"),
+			TextModel: econf.GetString("quota.trial.textModel"),
+			Token:     econf.GetString("quota.trial.token"),
+			ProxyUrl:  econf.GetString("quota.trial.proxyUrl"),
+		})
+	}
+	return q
+}
+
+// TrialAiSvc 试用使用的 ai 服务，未配置时返回 nil
+func (q *QuotaSvc) TrialAiSvc() aisvc.AiSvc {
+	return q.trial
+}
+
+// Status 获取用户额度，第一次访问时按默认值初始化
+func (q *QuotaSvc) Status(ctx context.Context, userId string) (*QuotaStatus, error) {
+	quota, err := q.getOrInit(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return q.toStatus(quota), nil
+}
+
+// Check 检查是否还有试用额度
+func (q *QuotaSvc) Check(ctx context.Context, userId string) error {
+	if userId == "" || q.trial == nil {
+		return dto.ErrQuotaExhausted
+	}
+	quota, err := q.getOrInit(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if quota.Exhausted() {
+		return dto.ErrQuotaExhausted
+	}
+	return nil
+}
+
+// Consume 成功完成一次对话后扣减额度
+func (q *QuotaSvc) Consume(ctx context.Context, userId string, usage aisvc.Usage) (*QuotaStatus, error) {
+	ok, err := q.store.ConsumeUserQuota(ctx, userId, int64(usage.TotalTokens))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// 并发请求时可能已被其他请求用完，本次不再重复扣减
+		elog.Warn("quota already exhausted when consuming", l.S("userId", userId))
+	}
+	return q.Status(ctx, userId)
+}
+
+// SetAllowance 管理员调整用户额度
+func (q *QuotaSvc) SetAllowance(ctx context.Context, userId string, freeRequests int64, freeTokens int64) (*QuotaStatus, error) {
+	err := q.store.SetUserQuotaAllowance(ctx, userId, freeRequests, freeTokens)
+	if err != nil {
+		return nil, err
+	}
+	return q.Status(ctx, userId)
+}
+
+func (q *QuotaSvc) getOrInit(ctx context.Context, userId string) (*dto.UserQuota, error) {
+	quota, err := q.store.GetUserQuota(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		return quota, nil
+	}
+	quota = &dto.UserQuota{
+		UserId:       userId,
+		FreeRequests: q.freeRequests,
+		FreeTokens:   q.freeTokens,
+		UpdateTime:   time.Now().Unix(),
+	}
+	if userId == dto.AnonymousUserId {
+		quota.FreeRequests, quota.FreeTokens = q.anonymousRequests, q.anonymousTokens
+	}
+	err = q.store.InitUserQuota(ctx, *quota)
+	if err != nil {
+		return nil, err
+	}
+	return q.store.GetUserQuota(ctx, userId)
+}
+
+func (q *QuotaSvc) toStatus(quota *dto.UserQuota) *QuotaStatus {
+	return &QuotaStatus{
+		UserId:            quota.UserId,
+		FreeRequests:      quota.FreeRequests,
+		UsedRequests:      quota.UsedRequests,
+		RemainingRequests: quota.RemainingRequests(),
+		FreeTokens:        quota.FreeTokens,
+		UsedTokens:        quota.UsedTokens,
+		RemainingTokens:   quota.RemainingTokens(),
+		TrialAvailable:    q.trial != nil,
+	}
+}
@@ -0,0 +1,108 @@
+package templatesvc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	docsvc "aichatoffice/pkg/services/doc"
+	filesvc "aichatoffice/pkg/services/file"
+	"aichatoffice/pkg/utils"
+)
+
+// TemplateExt 只支持 docx 模板，生成的报告同样为 docx
+const TemplateExt = ".docx"
+
+// TemplateKey 模板内容保存在存储的 templates 目录中
+func TemplateKey(templateId string) string {
+	return "templates/" + templateId + TemplateExt
+}
+
+type TemplateSvc struct {
+	store   store.TemplateStore
+	fileSvc *filesvc.FileService
+}
+
+func NewTemplateSvc(store store.TemplateStore, fileSvc *filesvc.FileService) *TemplateSvc {
+	return &TemplateSvc{
+		store:   store,
+		fileSvc: fileSvc,
+	}
+}
+
+// Create 校验模板语法，保存内容并记录模板中的字段
+func (t *TemplateSvc) Create(ctx context.Context, name string, creatorId string, content []byte) (*dto.Template, error) {
+	fields, err := docsvc.ParseTemplate(content)
+	if err != nil {
+		return nil, err
+	}
+	tpl := dto.Template{
+		TemplateId: utils.GenFileGuid(),
+		Name:       name,
+		Size:       int64(len(content)),
+		Fields:     fields,
+		CreatorId:  creatorId,
+		CreateTime: time.Now().Unix(),
+	}
+	if err = t.fileSvc.PutBytes(ctx, TemplateKey(tpl.TemplateId), content, ""); err != nil {
+		return nil, err
+	}
+	if err = t.store.AddTemplate(ctx, tpl); err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+func (t *TemplateSvc) List(ctx context.Context) ([]dto.Template, error) {
+	return t.store.ListTemplates(ctx)
+}
+
+// Get 模板不存在时返回 ErrTemplateNotFound
+func (t *TemplateSvc) Get(ctx context.Context, templateId string) (*dto.Template, error) {
+	tpl, err := t.store.GetTemplate(ctx, templateId)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, dto.ErrTemplateNotFound
+	}
+	return tpl, nil
+}
+
+func (t *TemplateSvc) Delete(ctx context.Context, templateId string) error {
+	if err := t.store.DeleteTemplate(ctx, templateId); err != nil {
+		return err
+	}
+	return t.fileSvc.DeleteObject(ctx, TemplateKey(templateId))
+}
+
+// Render 用数据填充模板，返回生成的 docx 内容
+func (t *TemplateSvc) Render(ctx context.Context, tpl *dto.Template, data map[string]interface{}) ([]byte, error) {
+	content, err := t.fileSvc.ReadObject(ctx, TemplateKey(tpl.TemplateId))
+	if err != nil {
+		return nil, err
+	}
+	res, err := docsvc.RenderTemplate(content, data)
+	if err != nil {
+		elog.Error("render template failed", zap.Error(err), zap.String("templateId", tpl.TemplateId))
+		return nil, err
+	}
+	return res, nil
+}
+
+// MissingFields 模板中数据未提供的字段，按顶层字段判断
+func MissingFields(fields []dto.TemplateField, data map[string]interface{}) []dto.TemplateField {
+	var res []dto.TemplateField
+	for _, f := range fields {
+		key := strings.SplitN(f.Name, ".", 2)[0]
+		if _, ok := data[key]; !ok {
+			res = append(res, f)
+		}
+	}
+	return res
+}
@@ -0,0 +1,198 @@
+package translatesvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/econf"
+
+	"aichatoffice/pkg/models/dto"
+	aisvc "aichatoffice/pkg/services/ai"
+	chatsvc "aichatoffice/pkg/services/chat"
+	docsvc "aichatoffice/pkg/services/doc"
+	filesvc "aichatoffice/pkg/services/file"
+	jobsvc "aichatoffice/pkg/services/job"
+)
+
+// JobType 翻译任务在任务队列中的类型
+const JobType = "translate"
+
+var (
+	ErrInvalidTargetLang = errors.New("invalid target language")
+
+	// 目标语言同时用作文件名后缀，只允许字母、数字、- 和 _
+	targetLangRe = regexp.MustCompile(`^[\p{L}\p{N}_-]{1,32}$`)
+)
+
+// Request 翻译任务的参数，Name 为生成文件的名称，为空时在原文件名后加上目标语言；Trial 表示使用试用额度
+type Request struct {
+	FileId     string            `json:"fileId"`
+	TargetLang string            `json:"targetLang"`
+	Glossary   map[string]string `json:"glossary,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Trial      bool              `json:"trial,omitempty"`
+}
+
+type TranslateSvc struct {
+	fileSvc *filesvc.FileService
+	docSvc  *docsvc.DocSvc
+	chatSvc *chatsvc.ChatSvc
+	jobSvc  *jobsvc.JobSvc
+}
+
+// NewTranslateSvc 同时注册翻译任务的处理函数
+func NewTranslateSvc(fileSvc *filesvc.FileService, docSvc *docsvc.DocSvc, chatSvc *chatsvc.ChatSvc, jobSvc *jobsvc.JobSvc) *TranslateSvc {
+	t := &TranslateSvc{
+		fileSvc: fileSvc,
+		docSvc:  docSvc,
+		chatSvc: chatSvc,
+		jobSvc:  jobSvc,
+	}
+	jobSvc.Register(JobType, t.handle)
+	return t
+}
+
+// Start 校验目标语言及文件格式后创建翻译任务
+func (t *TranslateSvc) Start(ctx context.Context, userId string, req Request) (dto.Job, error) {
+	if !targetLangRe.MatchString(req.TargetLang) {
+		return dto.Job{}, fmt.Errorf("%w: %q", ErrInvalidTargetLang, req.TargetLang)
+	}
+	file, err := t.fileSvc.GetFileMeta(ctx, req.FileId)
+	if err != nil {
+		return dto.Job{}, err
+	}
+	if kind := docsvc.KindOf(file.Ext); kind != docsvc.KindDocx && kind != docsvc.KindPptx && kind != docsvc.KindXlsx && kind != docsvc.KindText {
+		return dto.Job{}, fmt.Errorf("%w: %s", docsvc.ErrUnsupportedKind, file.Ext)
+	}
+	return t.jobSvc.Enqueue(ctx, userId, JobType, req)
+}
+
+// handle 抽取文本后分批翻译，写回原格式并保存为新文件；参数错误、额度不足等不会重试
+func (t *TranslateSvc) handle(ctx context.Context, task *jobsvc.Task) error {
+	var req Request
+	if err := task.Decode(&req); err != nil {
+		return jobsvc.Permanent(err)
+	}
+	userId := task.Job.CreatorId
+	opts, err := t.chatSvc.JobOptions(ctx, userId, req.Trial)
+	if err != nil {
+		return jobsvc.Permanent(err)
+	}
+	file, err := t.fileSvc.GetFileMeta(ctx, req.FileId)
+	if err != nil {
+		return jobsvc.Permanent(err)
+	}
+	content, err := t.fileSvc.GetFileContent(ctx, req.FileId)
+	if err != nil {
+		return err
+	}
+	translation, err := docsvc.ExtractTranslation(file.Ext, content)
+	if err != nil {
+		return jobsvc.Permanent(err)
+	}
+
+	texts := translation.Texts()
+	translated := make([]string, 0, len(texts))
+	for _, batch := range batches(texts) {
+		res, err := t.translate(ctx, userId, req, batch, opts)
+		if err != nil {
+			if dto.IsApiErr(err) || !aisvc.ClassifyError(err).Retryable() {
+				return jobsvc.Permanent(err)
+			}
+			return err
+		}
+		translated = append(translated, res...)
+		// 保存文件占最后一点进度
+		task.Progress(ctx, len(translated)*95/len(texts), fmt.Sprintf("%d/%d", len(translated), len(texts)))
+	}
+
+	content, err = translation.Apply(translated)
+	if err != nil {
+		return jobsvc.Permanent(err)
+	}
+	name := req.Name
+	if name == "" {
+		name = strings.TrimSuffix(file.Name, filepath.Ext(file.Name)) + "." + req.TargetLang
+	}
+	if !strings.EqualFold(filepath.Ext(name), file.Ext) {
+		name += file.Ext
+	}
+	res, err := t.docSvc.CreateFile(ctx, name, userId, content)
+	if err != nil {
+		return err
+	}
+	task.AddResult(res.FileID)
+	return nil
+}
+
+// translate 翻译一批文本，模型返回的条数不一致时拆成两半重试
+func (t *TranslateSvc) translate(ctx context.Context, userId string, req Request, texts []string, opts chatsvc.ChatOptions) ([]string, error) {
+	res, err := t.chatSvc.Translate(ctx, userId, chatsvc.TranslateBatch{
+		Texts:      texts,
+		TargetLang: req.TargetLang,
+		Glossary:   glossaryFor(req.Glossary, texts),
+	}, opts)
+	if err == nil || !errors.Is(err, chatsvc.ErrTranslationMismatch) || len(texts) == 1 {
+		return res, err
+	}
+	half := len(texts) / 2
+	first, err := t.translate(ctx, userId, req, texts[:half], opts)
+	if err != nil {
+		return nil, err
+	}
+	second, err := t.translate(ctx, userId, req, texts[half:], opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// glossaryFor 只保留本批文本中出现的术语，忽略大小写
+func glossaryFor(glossary map[string]string, texts []string) map[string]string {
+	if len(glossary) == 0 {
+		return nil
+	}
+	joined := strings.ToLower(strings.Join(texts, "\n"))
+	res := map[string]string{}
+	for term, target := range glossary {
+		if term != "" && strings.Contains(joined, strings.ToLower(term)) {
+			res[term] = target
+		}
+	}
+	return res
+}
+
+// batches 按条数及字数分批，单条超过字数上限时单独成批
+func batches(texts []string) [][]string {
+	maxItems := econf.GetInt("translate.batchSize")
+	if maxItems <= 0 {
+		maxItems = 40
+	}
+	maxRunes := econf.GetInt("translate.batchRunes")
+	if maxRunes <= 0 {
+		maxRunes = 3000
+	}
+	var (
+		res   [][]string
+		batch []string
+		runes int
+	)
+	for _, text := range texts {
+		n := utf8.RuneCountInString(text)
+		if len(batch) > 0 && (len(batch) >= maxItems || runes+n > maxRunes) {
+			res = append(res, batch)
+			batch, runes = nil, 0
+		}
+		batch = append(batch, text)
+		runes += n
+	}
+	if len(batch) > 0 {
+		res = append(res, batch)
+	}
+	return res
+}
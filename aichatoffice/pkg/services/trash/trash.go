@@ -0,0 +1,130 @@
+package trashsvc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	filesvc "aichatoffice/pkg/services/file"
+)
+
+// purgeBatch 每次清理过期文件的数量
+const purgeBatch = 100
+
+// TrashSvc 回收站：删除的文件先移入删除人的回收站，可以恢复；彻底删除或超过保留时间后，
+// 同时删除文件的版本、内容及所有用户关于该文件的对话
+type TrashSvc struct {
+	fileSvc   *filesvc.FileService
+	chatStore store.ChatStore
+	retention time.Duration
+}
+
+func NewTrashSvc(fileSvc *filesvc.FileService, chatStore store.ChatStore) *TrashSvc {
+	t := &TrashSvc{
+		fileSvc:   fileSvc,
+		chatStore: chatStore,
+		retention: econf.GetDuration("trash.retention"),
+	}
+	if t.retention <= 0 {
+		t.retention = 30 * 24 * time.Hour
+	}
+	return t
+}
+
+// Retention 文件在回收站中的保留时间
+func (t *TrashSvc) Retention() time.Duration {
+	return t.retention
+}
+
+// Start 定期彻底删除超过保留时间的文件
+func (t *TrashSvc) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(min(t.retention, time.Hour))
+		defer ticker.Stop()
+		for {
+			t.purgeExpired(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (t *TrashSvc) purgeExpired(ctx context.Context) {
+	for {
+		files, err := t.fileSvc.ListTrashedFiles(ctx, time.Now().Add(-t.retention), purgeBatch)
+		if err != nil {
+			elog.Error("list expired trash failed", zap.Error(err))
+			return
+		}
+		for _, file := range files {
+			if err := t.purge(ctx, file.FileID); err != nil {
+				elog.Error("purge expired trash failed", zap.Error(err), zap.String("fileId", file.FileID))
+				return
+			}
+		}
+		if len(files) < purgeBatch {
+			return
+		}
+	}
+}
+
+// Trash 把文件移入 userId 的回收站，admin 为 true 时可以删除其他用户的文件
+func (t *TrashSvc) Trash(ctx context.Context, fileId string, userId string, admin bool) (dto.FileMeta, error) {
+	return t.fileSvc.TrashFile(ctx, fileId, userId, admin)
+}
+
+// List 分页列出 userId 回收站中的文件，默认最近删除的在前
+func (t *TrashSvc) List(ctx context.Context, userId string, query dto.FileQuery, cursor string) (*dto.FileList, error) {
+	query.Trashed = true
+	query.DeleterId = userId
+	return t.fileSvc.QueryFiles(ctx, query, cursor)
+}
+
+// Restore 从 userId 的回收站恢复文件，对话随文件一起恢复
+func (t *TrashSvc) Restore(ctx context.Context, fileId string, userId string) (dto.FileMeta, error) {
+	return t.fileSvc.RestoreFile(ctx, fileId, userId)
+}
+
+// Purge 彻底删除 userId 回收站中的文件
+func (t *TrashSvc) Purge(ctx context.Context, fileId string, userId string) error {
+	if _, err := t.fileSvc.GetTrashedFile(ctx, fileId, userId); err != nil {
+		return err
+	}
+	return t.purge(ctx, fileId)
+}
+
+// Empty 清空 userId 的回收站，返回删除的文件数
+func (t *TrashSvc) Empty(ctx context.Context, userId string) (int, error) {
+	var n int
+	for {
+		list, err := t.List(ctx, userId, dto.FileQuery{Limit: purgeBatch}, "")
+		if err != nil {
+			return n, err
+		}
+		for _, file := range list.Files {
+			if err = t.purge(ctx, file.FileID); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if list.NextCursor == "" {
+			return n, nil
+		}
+	}
+}
+
+// purge 先删除对话再删除文件，中途失败时文件仍在回收站中，下次清理时重试
+func (t *TrashSvc) purge(ctx context.Context, fileId string) error {
+	if err := t.chatStore.DeleteFileConversations(ctx, fileId); err != nil {
+		return err
+	}
+	return t.fileSvc.DeleteFile(ctx, fileId)
+}
@@ -0,0 +1,374 @@
+package uploadsvc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"go.uber.org/zap"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	filesvc "aichatoffice/pkg/services/file"
+	"aichatoffice/pkg/utils"
+)
+
+// cleanupBatch 每轮清理的过期上传数
+const cleanupBatch = 100
+
+var (
+	ErrUploadNotFound  = errors.New("upload not found")
+	ErrOffsetMismatch  = errors.New("upload offset mismatch")
+	ErrChunkTooLarge   = errors.New("chunk exceeds upload length")
+	ErrInvalidLength   = errors.New("invalid upload length")
+	ErrUploadBusy      = errors.New("upload is being written")
+	ErrInvalidMetadata = errors.New("invalid upload metadata")
+)
+
+// UploadSvc tus 1.0 断点续传，每次 PATCH 接收的内容保存为一个分片，偏移量记录在数据库中，
+// 进程重启或切换实例后可以继续上传；全部接收后按顺序拼接分片登记为文件。
+// 创建时按总大小占用创建人的存储空间，登记为文件后转为文件的占用，取消或过期时释放
+type UploadSvc struct {
+	store   store.UploadStore
+	fileSvc *filesvc.FileService
+	expire  time.Duration
+
+	mu      sync.Mutex
+	writing map[string]struct{}
+}
+
+func NewUploadSvc(store store.UploadStore, fileSvc *filesvc.FileService) *UploadSvc {
+	u := &UploadSvc{
+		store:   store,
+		fileSvc: fileSvc,
+		expire:  econf.GetDuration("upload.expire"),
+		writing: map[string]struct{}{},
+	}
+	if u.expire <= 0 {
+		u.expire = 24 * time.Hour
+	}
+	return u
+}
+
+// chunkPrefix 分片的存储位置，key 中的偏移量补零，按 key 排序即为内容顺序
+func chunkPrefix(uploadId string) string {
+	return "uploads/" + uploadId + "/"
+}
+
+func chunkKey(uploadId string, offset int64) string {
+	return fmt.Sprintf("%s%020d", chunkPrefix(uploadId), offset)
+}
+
+// Start 定期清理过期未完成的上传
+func (u *UploadSvc) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(min(u.expire, time.Hour))
+		defer ticker.Stop()
+		for {
+			u.cleanup(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (u *UploadSvc) cleanup(ctx context.Context) {
+	for {
+		uploads, err := u.store.ListExpiredUploads(ctx, time.Now().Unix(), cleanupBatch)
+		if err != nil {
+			elog.Error("list expired uploads failed", zap.Error(err))
+			return
+		}
+		for _, upload := range uploads {
+			if err := u.remove(ctx, &upload); err != nil {
+				elog.Error("remove expired upload failed", zap.Error(err), zap.String("uploadId", upload.UploadId))
+				return
+			}
+		}
+		if len(uploads) < cleanupBatch {
+			return
+		}
+	}
+}
+
+// ParseMetadata 解析 Upload-Metadata：逗号分隔的键值对，值为 base64 编码，可以没有值
+func ParseMetadata(header string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, " ")
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil || key == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMetadata, pair)
+		}
+		res[key] = string(decoded)
+	}
+	return res, nil
+}
+
+// Create 创建上传，length 为文件的总大小，同时占用相应的存储空间；大小为 0 时直接登记为文件
+func (u *UploadSvc) Create(ctx context.Context, userId string, length int64, metadata string) (*dto.Upload, error) {
+	if length < 0 {
+		return nil, ErrInvalidLength
+	}
+	meta, err := ParseMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err = u.fileSvc.ReserveSize(ctx, userId, length); err != nil {
+		return nil, err
+	}
+	name := filepath.Base(meta["filename"])
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if name == "" {
+		name = "upload"
+	}
+	uploadId, err := utils.NewGuid(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	upload := dto.Upload{
+		UploadId:   uploadId,
+		Name:       name,
+		Length:     length,
+		Metadata:   metadata,
+		CreatorId:  userId,
+		CreateTime: now.Unix(),
+		UpdateTime: now.Unix(),
+		ExpireTime: now.Add(u.expire).Unix(),
+	}
+	if err = u.store.AddUpload(ctx, upload); err != nil {
+		u.fileSvc.ReleaseSize(ctx, userId, length)
+		return nil, err
+	}
+	if length == 0 {
+		return u.finish(ctx, &upload)
+	}
+	return &upload, nil
+}
+
+// Get 只能查看自己创建的上传，已过期的视为不存在
+func (u *UploadSvc) Get(ctx context.Context, userId string, uploadId string) (*dto.Upload, error) {
+	upload, err := u.store.GetUpload(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil || upload.CreatorId != userId || upload.ExpireTime < time.Now().Unix() {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// Append 从 offset 处追加内容，offset 必须等于已接收的大小。连接中断时保存已经收到的部分，
+// 返回更新后的上传及读取请求体时的错误；内容全部接收后登记为文件
+func (u *UploadSvc) Append(ctx context.Context, userId string, uploadId string, offset int64, body io.Reader) (*dto.Upload, error) {
+	if !u.lock(uploadId) {
+		return nil, ErrUploadBusy
+	}
+	defer u.unlock(uploadId)
+	upload, err := u.Get(ctx, userId, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	// 上次全部接收后登记文件失败（如空间不足），再次 PATCH 时重试
+	if upload.Offset == upload.Length {
+		if upload.Completed() {
+			return upload, nil
+		}
+		return u.finish(ctx, upload)
+	}
+
+	n, readErr := u.saveChunk(ctx, upload, body)
+	if errors.Is(readErr, ErrChunkTooLarge) {
+		return upload, readErr
+	}
+	if n > 0 {
+		now := time.Now()
+		ok, err := u.store.AdvanceUpload(ctx, uploadId, upload.Offset, upload.Offset+n, now.Add(u.expire).Unix(), now.Unix())
+		if err != nil {
+			return upload, err
+		}
+		if !ok {
+			// 其他请求已经先写入了这一段，客户端需要重新获取偏移量
+			return upload, ErrOffsetMismatch
+		}
+		upload.Offset += n
+		upload.UpdateTime = now.Unix()
+		upload.ExpireTime = now.Add(u.expire).Unix()
+	}
+	if readErr != nil {
+		return upload, readErr
+	}
+	if upload.Offset == upload.Length {
+		return u.finish(ctx, upload)
+	}
+	return upload, nil
+}
+
+// saveChunk 先把请求体写入本地临时文件，连接中断时也能保留已收到的部分，再保存为分片
+func (u *UploadSvc) saveChunk(ctx context.Context, upload *dto.Upload, body io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	remaining := upload.Length - upload.Offset
+	n, readErr := io.Copy(tmp, io.LimitReader(body, remaining+1))
+	if n > remaining {
+		return 0, ErrChunkTooLarge
+	}
+	if n == 0 {
+		return 0, readErr
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err = u.fileSvc.PutObject(ctx, chunkKey(upload.UploadId, upload.Offset), tmp, n, "application/octet-stream"); err != nil {
+		return 0, err
+	}
+	return n, readErr
+}
+
+// finish 按偏移量顺序拼接分片登记为文件，文件类型由内容识别
+func (u *UploadSvc) finish(ctx context.Context, upload *dto.Upload) (*dto.Upload, error) {
+	chunks, err := u.fileSvc.ListObjects(ctx, chunkPrefix(upload.UploadId))
+	if err != nil {
+		return upload, err
+	}
+	readers := make([]io.Reader, 0, len(chunks))
+	var offset int64
+	for _, chunk := range chunks {
+		start, err := strconv.ParseInt(strings.TrimPrefix(chunk.Key, chunkPrefix(upload.UploadId)), 10, 64)
+		if err != nil || start != offset {
+			return upload, fmt.Errorf("upload %s: missing chunk at offset %d", upload.UploadId, offset)
+		}
+		offset += chunk.Size
+		readers = append(readers, &chunkReader{ctx: ctx, fileSvc: u.fileSvc, key: chunk.Key})
+	}
+	if offset != upload.Length {
+		return upload, fmt.Errorf("upload %s: expect %d bytes, got %d", upload.UploadId, upload.Length, offset)
+	}
+	file := dto.FileMeta{
+		Name:       upload.Name,
+		FileID:     utils.GenFileGuid(),
+		CreateTime: time.Now().Unix(),
+		Ext:        filepath.Ext(upload.Name),
+		CreatorId:  upload.CreatorId,
+	}
+	// 创建时占用的空间转为文件的占用，失败时仍由上传持有，重试或取消时再处理
+	if err = u.fileSvc.UploadReservedStream(ctx, &file, io.MultiReader(readers...), upload.Length); err != nil {
+		return upload, err
+	}
+	if err = u.store.CompleteUpload(ctx, upload.UploadId, file.FileID, time.Now().Unix()); err != nil {
+		// 上传仍视为未完成，删除刚登记的文件，空间重新由上传占用，避免取消或过期时重复释放
+		if err := u.fileSvc.DeleteFile(ctx, file.FileID); err != nil {
+			elog.Error("delete file of incomplete upload failed", zap.Error(err), zap.String("uploadId", upload.UploadId), zap.String("fileId", file.FileID))
+		} else if err := u.fileSvc.ReserveSize(ctx, upload.CreatorId, upload.Length); err != nil {
+			elog.Error("reserve storage for upload failed", zap.Error(err), zap.String("uploadId", upload.UploadId))
+		}
+		return upload, err
+	}
+	upload.FileId = file.FileID
+	if err = u.fileSvc.DeleteObjects(ctx, chunkPrefix(upload.UploadId)); err != nil {
+		elog.Warn("delete upload chunks failed", zap.Error(err), zap.String("uploadId", upload.UploadId))
+	}
+	return upload, nil
+}
+
+// Terminate 取消上传，删除已接收的内容并释放占用的空间；已登记的文件不受影响
+func (u *UploadSvc) Terminate(ctx context.Context, userId string, uploadId string) error {
+	if !u.lock(uploadId) {
+		return ErrUploadBusy
+	}
+	defer u.unlock(uploadId)
+	upload, err := u.Get(ctx, userId, uploadId)
+	if err != nil {
+		return err
+	}
+	return u.remove(ctx, upload)
+}
+
+// remove 删除上传，未登记为文件时释放创建时占用的空间
+func (u *UploadSvc) remove(ctx context.Context, upload *dto.Upload) error {
+	if err := u.fileSvc.DeleteObjects(ctx, chunkPrefix(upload.UploadId)); err != nil {
+		return err
+	}
+	if err := u.store.DeleteUpload(ctx, upload.UploadId); err != nil {
+		return err
+	}
+	if !upload.Completed() {
+		u.fileSvc.ReleaseSize(ctx, upload.CreatorId, upload.Length)
+	}
+	return nil
+}
+
+// lock 同一个上传同时只允许一个请求写入
+func (u *UploadSvc) lock(uploadId string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.writing[uploadId]; ok {
+		return false
+	}
+	u.writing[uploadId] = struct{}{}
+	return true
+}
+
+func (u *UploadSvc) unlock(uploadId string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.writing, uploadId)
+}
+
+// chunkReader 读到该分片时才打开，避免同时打开所有分片
+type chunkReader struct {
+	ctx     context.Context
+	fileSvc *filesvc.FileService
+	key     string
+	rc      io.ReadCloser
+	done    bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.rc == nil {
+		rc, _, err := c.fileSvc.OpenObject(c.ctx, c.key)
+		if err != nil {
+			return 0, err
+		}
+		c.rc = rc
+	}
+	n, err := c.rc.Read(p)
+	if err != nil {
+		c.rc.Close()
+		c.done = true
+	}
+	return n, err
+}
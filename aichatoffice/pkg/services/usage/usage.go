@@ -0,0 +1,151 @@
+package usagesvc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/cetus/l"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	aisvc "aichatoffice/pkg/services/ai"
+)
+
+const dayLayout = "2006-01-02"
+
+// ModelPrice 模型单价，按每百万 token 计
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// BudgetDecision 请求前的预算检查结果
+type BudgetDecision struct {
+	Spent          float64 `json:"spent"`
+	MonthlySoft    float64 `json:"monthlySoft"`
+	MonthlyHard    float64 `json:"monthlyHard"`
+	Blocked        bool    `json:"blocked"`
+	Downgrade      bool    `json:"downgrade"`
+	DowngradeModel string  `json:"downgradeModel,omitempty"`
+}
+
+type UsageSvc struct {
+	store          store.UsageStore
+	prices         map[string]ModelPrice
+	monthlySoft    float64
+	monthlyHard    float64
+	downgradeModel string
+	// 匿名用户共用的预算
+	anonymousSoft float64
+	anonymousHard float64
+}
+
+func NewUsageSvc(s store.UsageStore) *UsageSvc {
+	prices := map[string]ModelPrice{}
+	if err := econf.UnmarshalKey("pricing.models", &prices); err != nil {
+		elog.Warn("no model pricing configured, cost will be 0", l.E(err))
+	}
+	return &UsageSvc{
+		store:          s,
+		prices:         prices,
+		monthlySoft:    econf.GetFloat64("budget.monthlySoft"),
+		monthlyHard:    econf.GetFloat64("budget.monthlyHard"),
+		downgradeModel: econf.GetString("budget.downgradeModel"),
+		anonymousSoft:  econf.GetFloat64("anonymous.monthlySoft"),
+		anonymousHard:  econf.GetFloat64("anonymous.monthlyHard"),
+	}
+}
+
+// Cost 按价格表计算费用，未配置价格的模型费用为 0
+func (s *UsageSvc) Cost(model string, usage aisvc.Usage) float64 {
+	price, ok := s.prices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+}
+
+// Record 记录一次调用，失败只打日志
+func (s *UsageSvc) Record(ctx context.Context, userId string, conversationId string, completion aisvc.Completion, trial bool) {
+	now := time.Now()
+	err := s.store.AddUsageRecord(ctx, dto.UsageRecord{
+		UserId:           userId,
+		ConversationId:   conversationId,
+		Model:            completion.Model,
+		PromptTokens:     int64(completion.Usage.PromptTokens),
+		CompletionTokens: int64(completion.Usage.CompletionTokens),
+		ReasoningTokens:  int64(completion.Usage.ReasoningTokens),
+		TotalTokens:      int64(completion.Usage.TotalTokens),
+		LatencyMs:        completion.Latency.Milliseconds(),
+		FinishReason:     completion.FinishReason,
+		Cost:             s.Cost(completion.Model, completion.Usage),
+		Trial:            trial,
+		Day:              now.Format(dayLayout),
+		CreateTime:       now.Unix(),
+	})
+	if err != nil {
+		elog.Error("add usage record failed", l.E(err), l.S("userId", userId), l.S("conversationId", conversationId))
+	}
+}
+
+func (s *UsageSvc) Aggregate(ctx context.Context, query dto.UsageQuery) ([]dto.UsageAggregate, error) {
+	return s.store.AggregateUsage(ctx, query)
+}
+
+// Budget 获取用户月度预算，没有单独设置时使用默认值，匿名用户使用 anonymous 中的预算
+func (s *UsageSvc) Budget(ctx context.Context, userId string) (dto.UserBudget, error) {
+	budget, err := s.store.GetUserBudget(ctx, userId)
+	if err != nil {
+		return dto.UserBudget{}, err
+	}
+	if budget == nil && userId == dto.AnonymousUserId {
+		return dto.UserBudget{UserId: userId, MonthlySoft: s.anonymousSoft, MonthlyHard: s.anonymousHard}, nil
+	}
+	if budget == nil {
+		return dto.UserBudget{UserId: userId, MonthlySoft: s.monthlySoft, MonthlyHard: s.monthlyHard}, nil
+	}
+	return *budget, nil
+}
+
+func (s *UsageSvc) SetBudget(ctx context.Context, userId string, monthlySoft float64, monthlyHard float64) (dto.UserBudget, error) {
+	budget := dto.UserBudget{
+		UserId:      userId,
+		MonthlySoft: monthlySoft,
+		MonthlyHard: monthlyHard,
+		UpdateTime:  time.Now().Unix(),
+	}
+	return budget, s.store.SetUserBudget(ctx, budget)
+}
+
+// CheckBudget 检查当月费用：超过硬预算拒绝，超过软预算降级模型
+func (s *UsageSvc) CheckBudget(ctx context.Context, userId string) (*BudgetDecision, error) {
+	budget, err := s.Budget(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	decision := &BudgetDecision{
+		MonthlySoft: budget.MonthlySoft,
+		MonthlyHard: budget.MonthlyHard,
+	}
+	if budget.MonthlySoft <= 0 && budget.MonthlyHard <= 0 {
+		return decision, nil
+	}
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	decision.Spent, err = s.store.SumUserCost(ctx, userId, monthStart.Format(dayLayout))
+	if err != nil {
+		return nil, err
+	}
+	if budget.MonthlyHard > 0 && decision.Spent >= budget.MonthlyHard {
+		decision.Blocked = true
+		return decision, nil
+	}
+	if budget.MonthlySoft > 0 && decision.Spent >= budget.MonthlySoft {
+		// 没有配置降级模型时，软预算只做提示
+		decision.Downgrade = s.downgradeModel != ""
+		decision.DowngradeModel = s.downgradeModel
+	}
+	return decision, nil
+}
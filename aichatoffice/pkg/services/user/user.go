@@ -0,0 +1,185 @@
+package usersvc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gotomicro/cetus/l"
+	"github.com/gotomicro/ego/core/elog"
+
+	"aichatoffice/pkg/models/dto"
+	"aichatoffice/pkg/models/store"
+	"aichatoffice/pkg/utils"
+)
+
+const tokenLength = 32
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrLastAdmin    = errors.New("at least one admin is required")
+)
+
+type UserSvc struct {
+	store store.UserStore
+}
+
+func NewUserSvc(s store.UserStore) *UserSvc {
+	return &UserSvc{
+		store: s,
+	}
+}
+
+// InitAdmin 没有任何管理员时创建一个初始管理员
+// adminToken 为空时随机生成并打印到日志，只会出现这一次
+func (s *UserSvc) InitAdmin(ctx context.Context, adminToken string) error {
+	count, err := s.store.CountUsersByRole(ctx, dto.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if adminToken == "" {
+		adminToken, err = utils.NewGuid(tokenLength)
+		if err != nil {
+			return err
+		}
+		elog.Warn("no admin configured, generated initial admin token", l.S("token", adminToken))
+	}
+	now := time.Now().Unix()
+	return s.store.SetUser(ctx, dto.User{
+		UserId:     utils.GenFileGuid(),
+		Name:       "admin",
+		Role:       dto.RoleAdmin,
+		TokenHash:  hashToken(adminToken),
+		CreateTime: now,
+		ModifyTime: now,
+	})
+}
+
+// Authenticate 根据 token 获取用户，token 无效时返回 nil
+func (s *UserSvc) Authenticate(ctx context.Context, token string) (*dto.User, error) {
+	if token == "" {
+		return nil, nil
+	}
+	return s.store.GetUserByTokenHash(ctx, hashToken(token))
+}
+
+func (s *UserSvc) GetUser(ctx context.Context, userId string) (*dto.User, error) {
+	user, err := s.store.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *UserSvc) ListUsers(ctx context.Context) ([]dto.User, error) {
+	return s.store.ListUsers(ctx)
+}
+
+// CreateUser 创建用户，返回用户及明文 token
+func (s *UserSvc) CreateUser(ctx context.Context, name string, role string) (*dto.User, string, error) {
+	if !dto.IsValidRole(role) {
+		return nil, "", ErrInvalidRole
+	}
+	token, err := utils.NewGuid(tokenLength)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().Unix()
+	user := dto.User{
+		UserId:     utils.GenFileGuid(),
+		Name:       name,
+		Role:       role,
+		TokenHash:  hashToken(token),
+		CreateTime: now,
+		ModifyTime: now,
+	}
+	err = s.store.SetUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, token, nil
+}
+
+// UpdateUser 修改用户名称和角色，为空的不修改，返回修改前后的用户
+func (s *UserSvc) UpdateUser(ctx context.Context, userId string, name string, role string) (before dto.User, after dto.User, err error) {
+	if role != "" && !dto.IsValidRole(role) {
+		return before, after, ErrInvalidRole
+	}
+	user, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return before, after, err
+	}
+	before = *user
+	if role == "" {
+		role = user.Role
+	}
+	if user.Role == dto.RoleAdmin && role != dto.RoleAdmin {
+		if err = s.checkNotLastAdmin(ctx); err != nil {
+			return before, after, err
+		}
+	}
+	if name != "" {
+		user.Name = name
+	}
+	user.Role = role
+	user.ModifyTime = time.Now().Unix()
+	err = s.store.SetUser(ctx, *user)
+	return before, *user, err
+}
+
+func (s *UserSvc) DeleteUser(ctx context.Context, userId string) (*dto.User, error) {
+	user, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == dto.RoleAdmin {
+		if err = s.checkNotLastAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return user, s.store.DeleteUser(ctx, userId)
+}
+
+// ResetToken 重新生成 token，旧 token 立即失效
+func (s *UserSvc) ResetToken(ctx context.Context, userId string) (*dto.User, string, error) {
+	user, err := s.GetUser(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := utils.NewGuid(tokenLength)
+	if err != nil {
+		return nil, "", err
+	}
+	user.TokenHash = hashToken(token)
+	user.ModifyTime = time.Now().Unix()
+	err = s.store.SetUser(ctx, *user)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+func (s *UserSvc) checkNotLastAdmin(ctx context.Context) error {
+	count, err := s.store.CountUsersByRole(ctx, dto.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}